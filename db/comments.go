@@ -0,0 +1,296 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/VolticFroogo/Bernies-Busy-Bees/helpers"
+	"github.com/VolticFroogo/Bernies-Busy-Bees/models"
+)
+
+/*
+	Comment related functions
+*/
+
+// getComments returns the threads of comments on a post along with their authors.
+// Threads are newest first and the replies within a thread are oldest first.
+func (s *sqlStore) getComments(postID int) (comments []models.DisplayComment, err error) {
+	rows, err := s.db.Query(`SELECT c.uuid, c.parent, c.deleted, c.useruuid, c.timestamp, c.edited, c.comment, COALESCE(u.uuid, 0), COALESCE(u.fname, ''), COALESCE(u.lname, ''), COALESCE(u.role, 0)
+		FROM comments c LEFT JOIN users u ON u.uuid = c.useruuid
+		WHERE c.postid=? ORDER BY c.id`, postID)
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	var all []models.DisplayComment
+	for rows.Next() {
+		comment := models.DisplayComment{} // Create struct to store a comment in.
+
+		err = rows.Scan(&comment.ID, &comment.ParentID, &comment.Deleted, &comment.UserUUID, &comment.Timestamp, &comment.Edited, &comment.Comment, &comment.User.UUID, &comment.User.Fname, &comment.User.Lname, &comment.User.Role.ID) // Scan data from query.
+		if err != nil {
+			return
+		}
+
+		all = append(all, comment) // Append just read comment into the comments.
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return
+	}
+
+	revisions, err := s.getRevisions(postID)
+	if err != nil {
+		return
+	}
+
+	replies := make(map[string][]models.DisplayComment)
+	for _, comment := range all {
+		comment.Revisions = revisions[comment.ID]
+		replies[comment.ParentID] = append(replies[comment.ParentID], comment)
+	}
+
+	comments = buildThread(replies, "")
+
+	// Reverse the threads (newest first).
+	for i, j := 0, len(comments)-1; i < j; i, j = i+1, j-1 {
+		comments[i], comments[j] = comments[j], comments[i]
+	}
+
+	return
+}
+
+// buildThread returns the replies to a comment with their own replies filled in.
+func buildThread(replies map[string][]models.DisplayComment, parentID string) (thread []models.DisplayComment) {
+	thread = replies[parentID]
+	for i := range thread {
+		thread[i].Replies = buildThread(replies, thread[i].ID)
+	}
+
+	return
+}
+
+// getRevisions returns the previous versions of every edited comment on a post, oldest first, mapped by comment ID.
+func (s *sqlStore) getRevisions(postID int) (revisions map[string][]models.CommentRevision, err error) {
+	revisions = make(map[string][]models.CommentRevision)
+
+	rows, err := s.db.Query("SELECT commentuuid, timestamp, comment FROM comment_revisions WHERE postid=? ORDER BY id", postID)
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var commentID string
+		revision := models.CommentRevision{} // Create struct to store a revision in.
+
+		err = rows.Scan(&commentID, &revision.Timestamp, &revision.Comment) // Scan data from query.
+		if err != nil {
+			return
+		}
+
+		revisions[commentID] = append(revisions[commentID], revision)
+	}
+
+	err = rows.Err()
+	return
+}
+
+// AddCommentPost adds a comment to a post, or a reply to a comment if a parent is specified.
+func (s *sqlStore) AddCommentPost(comment models.NewComment) (id string, err error) {
+	exists, err := s.rowExists("SELECT id FROM posts WHERE id=?", comment.ID)
+	if err != nil {
+		return
+	}
+	if !exists {
+		return "", fmt.Errorf("post %v doesn't exist", comment.ID)
+	}
+
+	if comment.ParentID != "" {
+		exists, err = s.rowExists("SELECT id FROM comments WHERE uuid=? AND postid=? AND deleted=0", comment.ParentID, comment.ID)
+		if err != nil {
+			return
+		}
+		if !exists {
+			return "", fmt.Errorf("comment %v doesn't exist on post %v", comment.ParentID, comment.ID)
+		}
+	}
+
+	id, err = helpers.GenerateRandomString(32)
+	if err != nil {
+		return
+	}
+
+	_, err = s.db.Exec("INSERT INTO comments (uuid, parent, postid, useruuid, timestamp, comment) VALUES (?, ?, ?, ?, ?, ?)", id, comment.ParentID, comment.ID, comment.UserUUID, comment.Timestamp, comment.Comment)
+	return
+}
+
+// EditCommentPost replaces the text of a comment, keeping the old text as a revision.
+func (s *sqlStore) EditCommentPost(commentID string, postID int, comment string, timestamp int64) (err error) {
+	_, err = s.editComment(commentID, postID, 0, false, comment, timestamp)
+	return
+}
+
+// EditCommentPostIfOwner edits a comment if the comment owner matches a specified UUID.
+func (s *sqlStore) EditCommentPostIfOwner(commentID string, postID, userUUID int, comment string, timestamp int64) (owner bool, err error) {
+	return s.editComment(commentID, postID, userUUID, true, comment, timestamp)
+}
+
+// editComment edits a comment, saving the text it replaces as a revision.
+func (s *sqlStore) editComment(commentID string, postID, userUUID int, checkOwner bool, comment string, timestamp int64) (owner bool, err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+
+		err = tx.Commit()
+	}()
+
+	var ownerUUID int
+	var deleted bool
+	var created, edited int64
+	var previous string
+	err = tx.QueryRow("SELECT useruuid, deleted, timestamp, edited, comment FROM comments WHERE uuid=? AND postid=?", commentID, postID).Scan(&ownerUUID, &deleted, &created, &edited, &previous)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return
+	}
+
+	// Deleted comments can't be brought back by editing them.
+	if deleted || (checkOwner && ownerUUID != userUUID) {
+		return
+	}
+
+	owner = true
+
+	if previous == comment {
+		return
+	}
+
+	// The revision is timestamped with when its text was written.
+	written := created
+	if edited != 0 {
+		written = edited
+	}
+
+	_, err = tx.Exec("INSERT INTO comment_revisions (commentuuid, postid, timestamp, comment) VALUES (?, ?, ?, ?)", commentID, postID, written, previous)
+	if err != nil {
+		return
+	}
+
+	_, err = tx.Exec("UPDATE comments SET comment=?, edited=? WHERE uuid=?", comment, timestamp, commentID)
+	return
+}
+
+// DeleteCommentPost deletes a comment to a post.
+func (s *sqlStore) DeleteCommentPost(commentID string, postID int) (err error) {
+	_, err = s.deleteComment(commentID, postID, 0, false)
+	return
+}
+
+// DeleteCommentPostIfOwner deletes a comment to a post if the comment owner matches a specified UUID.
+func (s *sqlStore) DeleteCommentPostIfOwner(commentID string, postID, userUUID int) (owner bool, err error) {
+	return s.deleteComment(commentID, postID, userUUID, true)
+}
+
+// deleteComment deletes a comment, leaving a placeholder behind if it has replies so the thread stays readable.
+// Placeholders are removed once their last reply is deleted.
+func (s *sqlStore) deleteComment(commentID string, postID, userUUID int, checkOwner bool) (owner bool, err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+
+		err = tx.Commit()
+	}()
+
+	var ownerUUID int
+	var parentID string
+	err = tx.QueryRow("SELECT useruuid, parent FROM comments WHERE uuid=? AND postid=?", commentID, postID).Scan(&ownerUUID, &parentID)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return
+	}
+
+	if checkOwner && ownerUUID != userUUID {
+		return
+	}
+
+	owner = true
+
+	// The history of a deleted comment shouldn't outlive it.
+	_, err = tx.Exec("DELETE FROM comment_revisions WHERE commentuuid=?", commentID)
+	if err != nil {
+		return
+	}
+
+	hasReplies, err := commentHasReplies(tx, commentID)
+	if err != nil {
+		return
+	}
+
+	if hasReplies {
+		_, err = tx.Exec("UPDATE comments SET deleted=1, comment='', edited=0 WHERE uuid=?", commentID)
+		return
+	}
+
+	_, err = tx.Exec("DELETE FROM comments WHERE uuid=?", commentID)
+	if err != nil {
+		return
+	}
+
+	// Clean up any placeholders left without replies.
+	for parentID != "" {
+		var deleted bool
+		var grandparentID string
+		err = tx.QueryRow("SELECT deleted, parent FROM comments WHERE uuid=?", parentID).Scan(&deleted, &grandparentID)
+		if err == sql.ErrNoRows {
+			return true, nil
+		}
+		if err != nil {
+			return
+		}
+
+		if !deleted {
+			return
+		}
+
+		hasReplies, err = commentHasReplies(tx, parentID)
+		if err != nil || hasReplies {
+			return
+		}
+
+		_, err = tx.Exec("DELETE FROM comments WHERE uuid=?", parentID)
+		if err != nil {
+			return
+		}
+
+		parentID = grandparentID
+	}
+
+	return
+}
+
+func commentHasReplies(tx *sql.Tx, commentID string) (exists bool, err error) {
+	err = tx.QueryRow("SELECT exists (SELECT id FROM comments WHERE parent=?)", commentID).Scan(&exists)
+	return
+}
@@ -1,16 +1,13 @@
 package db
 
 import (
-	"database/sql"
-	"encoding/json"
-	"fmt"
 	"log"
+	"os"
+	"sync"
 	"time"
 
 	"github.com/VolticFroogo/Bernies-Busy-Bees/db/dbCredentials"
-	"github.com/VolticFroogo/Bernies-Busy-Bees/helpers"
 	"github.com/VolticFroogo/Bernies-Busy-Bees/models"
-	_ "github.com/go-sql-driver/mysql" // Necessary for connecting to MySQL.
 )
 
 /*
@@ -18,88 +15,121 @@ import (
 */
 
 var (
-	db *sql.DB
-	// Users is a struct for the admin Users.
-	Users models.Users
-	// IndexPosts are the posts for the index page to prevent an attacker flooding our DB.
-	IndexPosts models.Posts
+	store Store
+	// cachedUsers is a struct for the admin Users.
+	cachedUsers models.Users
+	// cachedRoles are every role along with their permissions, as every request needs them.
+	cachedRoles models.Roles
+	// cachedIndexPosts are the posts for the index page to prevent an attacker flooding our DB.
+	cachedIndexPosts models.Posts
+	// postsUpdated is when the posts last changed, so caches of them know when they're stale.
+	postsUpdated time.Time
+	// cacheLock guards the cached users, roles and posts, which are read by every request
+	// while role edits and the post scheduler replace them.
+	cacheLock sync.RWMutex
 )
 
+// Users returns every user, as last read from the database.
+// The slice is replaced rather than changed when the users are updated, so it mustn't be modified.
+func Users() models.Users {
+	cacheLock.RLock()
+	defer cacheLock.RUnlock()
+	return cachedUsers
+}
+
+// Roles returns every role along with their permissions, as last read from the database.
+// The slice is replaced rather than changed when the roles are updated, so it mustn't be modified.
+func Roles() models.Roles {
+	cacheLock.RLock()
+	defer cacheLock.RUnlock()
+	return cachedRoles
+}
+
+// IndexPosts returns the posts for the index page.
+func IndexPosts() models.Posts {
+	cacheLock.RLock()
+	defer cacheLock.RUnlock()
+	return cachedIndexPosts
+}
+
+// PostsUpdated returns when the posts last changed, so caches of them know when they're stale.
+func PostsUpdated() time.Time {
+	cacheLock.RLock()
+	defer cacheLock.RUnlock()
+	return postsUpdated
+}
+
 // InitDB initializes the Database.
 func InitDB() (err error) {
-	db, err = sql.Open(dbCredentials.Type, dbCredentials.ConnString)
+	s, err := OpenDefault()
 	if err != nil {
 		return
 	}
 
-	err = UpdateUsers()
-	if err != nil {
-		return
-	}
+	return InitStore(s)
+}
 
-	err = UpdateIndexPosts()
-	if err != nil {
-		return
+// OpenDefault opens the Store from the credentials file.
+// The DB_TYPE and DB_CONN_STRING environment variables override the credentials file,
+// e.g. DB_TYPE=sqlite3 DB_CONN_STRING=:memory: runs the site without a MySQL server.
+func OpenDefault() (Store, error) {
+	dbType := os.Getenv("DB_TYPE")
+	if dbType == "" {
+		dbType = dbCredentials.Type
 	}
 
-	go jtiGarbageCollector()
-	return
-}
-
-/*
-	Helper functions
-*/
+	connString := os.Getenv("DB_CONN_STRING")
+	if connString == "" {
+		connString = dbCredentials.ConnString
+	}
 
-func rowExists(query string, args ...interface{}) (exists bool, err error) {
-	query = fmt.Sprintf("SELECT exists (%s)", query)
-	err = db.QueryRow(query, args...).Scan(&exists)
-	return
+	return Open(dbType, connString)
 }
 
-/*
-	MySQL DataBase related functions
-*/
+// InitStore initializes the Database using an already opened Store.
+// Any pending migrations are applied before the caches are filled.
+func InitStore(s Store) (err error) {
+	store = s
 
-// StoreRefreshToken generates, stores and then returns a JTI.
-func StoreRefreshToken() (jti models.JTI, err error) {
-	// No need to duplication check as the JTI takes input from time and are unique.
-	jti.JTI, err = helpers.GenerateRandomString(32)
+	err = store.MigrateUp()
 	if err != nil {
 		return
 	}
 
-	jti.Expiry = time.Now().Add(models.RefreshTokenValidTime).Unix()
-
-	_, err = db.Exec("INSERT INTO jti (jti, expiry) VALUES (?, ?)", jti.JTI, jti.Expiry)
+	err = updateRolesAndUsers()
 	if err != nil {
 		return
 	}
 
-	rows, err := db.Query("SELECT id FROM jti WHERE jti=? AND expiry=?", jti.JTI, jti.Expiry)
+	// Publish anything which was due while the server was down before filling the index posts.
+	_, err = store.PublishScheduledPosts(time.Now().Unix())
 	if err != nil {
 		return
 	}
 
-	defer rows.Close()
+	err = UpdateIndexPosts()
+	if err != nil {
+		return
+	}
 
-	rows.Next()
-	err = rows.Scan(&jti.ID) // Scan data from query.
+	go jtiGarbageCollector()
+	go loginFailureGarbageCollector()
+	go postScheduler()
 	return
 }
 
-// GetJTI takes a JTI string and returns the JTI struct.
-func GetJTI(jti string) (jtiStruct models.JTI, err error) {
-	rows, err := db.Query("SELECT id, expiry FROM jti WHERE jti=?", jti)
-	if err != nil {
-		return
-	}
+/*
+	JTI related functions
+*/
 
-	defer rows.Close()
+// StoreRefreshToken generates, stores and then returns a JTI in a family of refresh tokens.
+func StoreRefreshToken(userUUID int, family, userAgent, ip string) (jti models.JTI, err error) {
+	return store.StoreRefreshToken(userUUID, family, userAgent, ip)
+}
 
-	jtiStruct.JTI = jti
-	rows.Next()
-	err = rows.Scan(&jtiStruct.ID, &jtiStruct.Expiry) // Scan data from query.
-	return
+// GetJTI takes a JTI string and returns the JTI struct.
+func GetJTI(jti string) (jtiStruct models.JTI, err error) {
+	return store.GetJTI(jti)
 }
 
 // CheckJTI returns the validity of a JTI.
@@ -108,7 +138,7 @@ func CheckJTI(jti models.JTI) (valid bool, err error) {
 		return true, nil // Token is valid.
 	}
 
-	_, err = db.Exec("DELETE FROM jti WHERE id=?", jti.ID)
+	err = store.DeleteJTIFromID(jti.ID)
 	if err != nil {
 		return false, err
 	}
@@ -116,208 +146,209 @@ func CheckJTI(jti models.JTI) (valid bool, err error) {
 	return false, nil // Token is invalid.
 }
 
-// DeleteJTI deletes a JTI based on a jti key.
-func DeleteJTI(jti string) (err error) {
-	_, err = db.Exec("DELETE FROM jti WHERE jti=?", jti)
-	return
+// RotateJTI marks a JTI as used once its refresh token has been swapped for a new one.
+// rotated is false if the JTI had already been rotated, meaning its refresh token has been reused.
+func RotateJTI(jti models.JTI) (rotated bool, err error) {
+	return store.RotateJTI(jti.ID, time.Now().Unix())
+}
+
+// DeleteJTIFamily deletes every JTI in a family, logging out whoever used it.
+func DeleteJTIFamily(family string) (err error) {
+	return store.DeleteJTIFamily(family)
 }
 
 func jtiGarbageCollector() {
 	ticker := time.NewTicker(5 * time.Minute) // Tick every five minutes.
 	for {
 		<-ticker.C
-		rows, err := db.Query("SELECT id, jti, expiry FROM jti")
+		err := store.DeleteExpiredJTIs(time.Now().Unix())
 		if err != nil {
-			log.Printf("Error querying JTI DB in JTI garbage collector: %v", err)
+			log.Printf("Error deleting expired JTIs in JTI garbage collector: %v", err)
 			return
 		}
-
-		defer rows.Close()
-
-		jti := models.JTI{} // Create struct to store a JTI in.
-		for rows.Next() {
-			err = rows.Scan(&jti.ID, &jti.JTI, &jti.Expiry) // Scan data from query.
-			if err != nil {
-				log.Printf("Error scanning rows in JTI garbage collector: %v", err)
-				return
-			}
-
-			_, err := CheckJTI(jti)
-			if err != nil {
-				log.Printf("Error checking in JTI garbage collector: %v", err)
-				return
-			}
-		}
 	}
 }
 
-// GetUserFromID retrieves a user from the MySQL database.
-func GetUserFromID(uuid int) (user models.User, err error) {
-	rows, err := db.Query("SELECT email, password, fname, lname, priv, create_time FROM users WHERE uuid=?", uuid)
-	if err != nil {
-		return
-	}
+/*
+	Session related functions
+*/
 
-	defer rows.Close()
+// GetSessions returns every session a user is logged in with, most recently seen first.
+func GetSessions(userUUID int) (sessions []models.Session, err error) {
+	return store.GetSessions(userUUID, time.Now().Unix())
+}
 
-	user.UUID = uuid
-	for rows.Next() {
-		err = rows.Scan(&user.Email, &user.Password, &user.Fname, &user.Lname, &user.Priv, &user.CreateTime) // Scan data from query.
-		if err != nil {
-			return
-		}
-	}
+// DeleteSession logs out one of a user's sessions, deleted is false if they don't have it.
+func DeleteSession(family string, userUUID int) (deleted bool, err error) {
+	return store.DeleteSession(family, userUUID)
+}
 
-	return
+// DeleteSessions logs a user out everywhere.
+func DeleteSessions(userUUID int) (err error) {
+	return logOutEverywhere(userUUID)
 }
 
-// GetUserFromEmail retrieves a user's ID from the MySQL database.
-func GetUserFromEmail(email string) (user models.User, err error) {
-	rows, err := db.Query("SELECT uuid, password, fname, lname, priv, create_time FROM users WHERE email=?", email)
+// logOutEverywhere deletes every session a user has and revokes their auth tokens.
+func logOutEverywhere(userUUID int) (err error) {
+	err = store.DeleteSessions(userUUID)
 	if err != nil {
 		return
 	}
 
-	defer rows.Close()
-
-	user.Email = email
-	for rows.Next() {
-		err = rows.Scan(&user.UUID, &user.Password, &user.Fname, &user.Lname, &user.Priv, &user.CreateTime) // Scan data from query.
-		if err != nil {
-			return
-		}
-	}
-
+	err = RevokeTokens(userUUID)
 	return
 }
 
-// UpdateUsers updates the users by querying the MySQL DataBase.
-func UpdateUsers() (err error) {
-	rows, err := db.Query("SELECT uuid, email, fname, lname, password, priv, create_time FROM users")
-	if err != nil {
-		return
-	}
+/*
+	Token version related functions
+*/
 
-	defer rows.Close()
+// tokenVersionCacheTime is how long a token version is cached for,
+// which is the longest another server can take to notice tokens were revoked.
+const tokenVersionCacheTime = time.Minute
 
-	users := models.Users{} // Create struct to store slides in.
-	user := models.User{}   // Create struct to store a slide in.
-	for rows.Next() {
-		err = rows.Scan(&user.UUID, &user.Email, &user.Fname, &user.Lname, &user.Password, &user.Priv, &user.CreateTime) // Scan data from query.
-		if err != nil {
-			return
-		}
+type cachedTokenVersion struct {
+	version int
+	exists  bool
+	expiry  time.Time
+}
 
-		users = append(users, user) // Append just read slide into the slides.
-	}
+var (
+	tokenVersions     = map[int]cachedTokenVersion{}
+	tokenVersionsLock sync.RWMutex
+	// tokenVersionsGeneration changes whenever tokens are revoked, so a version read before then isn't cached.
+	tokenVersionsGeneration int
+)
 
-	Users = users // Replace the old menu with the newly read struct.
-	return
-}
+// TokenVersion returns the version a user's auth tokens must have, exists is false if there is no user.
+// Versions are cached so checking a token doesn't need the database.
+func TokenVersion(uuid int) (version int, exists bool, err error) {
+	tokenVersionsLock.RLock()
+	cached, ok := tokenVersions[uuid]
+	generation := tokenVersionsGeneration
+	tokenVersionsLock.RUnlock()
 
-// UpdateIndexPosts updates the index posts by querying the MySQL DataBase.
-func UpdateIndexPosts() (err error) {
-	rows, err := db.Query("SELECT id, title, description, images, comments, create_time FROM posts ORDER BY id DESC LIMIT 3")
+	if ok && time.Now().Before(cached.expiry) {
+		return cached.version, cached.exists, nil
+	}
+
+	version, exists, err = store.GetTokenVersion(uuid)
 	if err != nil {
 		return
 	}
 
-	defer rows.Close()
+	tokenVersionsLock.Lock()
+	if generation == tokenVersionsGeneration {
+		tokenVersions[uuid] = cachedTokenVersion{version, exists, time.Now().Add(tokenVersionCacheTime)}
+	}
+	tokenVersionsLock.Unlock()
+	return
+}
 
-	posts := models.Posts{} // Create struct to store posts in.
-	for rows.Next() {
-		post := models.Post{} // Create struct to store a post in.
+// RevokeTokens stops every auth token a user has from working, their refresh tokens can still get new ones.
+func RevokeTokens(uuid int) (err error) {
+	err = store.BumpTokenVersion(uuid)
+	forgetTokenVersions()
+	return
+}
 
-		err = rows.Scan(&post.ID, &post.Title, &post.Description, &post.ImagesJSON, &post.CommentsJSON, &post.CreateTime) // Scan data from query.
-		if err != nil {
-			return
-		}
+// revokeRoleTokens stops the auth tokens of every user with a role from working.
+func revokeRoleTokens(roleID int) (err error) {
+	err = store.BumpRoleTokenVersions(roleID)
+	forgetTokenVersions()
+	return
+}
 
-		err = json.Unmarshal([]byte(post.ImagesJSON), &post.Images)
-		if err != nil {
-			return
-		}
+// forgetTokenVersions empties the token version cache.
+func forgetTokenVersions() {
+	tokenVersionsLock.Lock()
+	tokenVersions = map[int]cachedTokenVersion{}
+	tokenVersionsGeneration++
+	tokenVersionsLock.Unlock()
+}
 
-		err = json.Unmarshal([]byte(post.CommentsJSON), &post.Comments)
-		if err != nil {
-			return
-		}
+/*
+	User related functions
+*/
 
-		posts = append(posts, post) // Append just read post into the posts.
-	}
+// GetUserFromID retrieves a user from the database.
+func GetUserFromID(uuid int) (user models.User, err error) {
+	user, err = store.GetUserFromID(uuid)
+	user.Role = GetRole(user.Role.ID)
+	return
+}
 
-	IndexPosts = posts // Replace the old menu with the newly read struct.
+// GetUserFromEmail retrieves a user's ID from the database.
+func GetUserFromEmail(email string) (user models.User, err error) {
+	user, err = store.GetUserFromEmail(email)
+	user.Role = GetRole(user.Role.ID)
 	return
 }
 
-// GetPosts returns a specified amount of posts.
-func GetPosts(amount, perPage, page int) (posts models.Posts, err error) {
-	rows, err := db.Query("SELECT id, title, description, images, comments, create_time FROM posts ORDER BY id DESC LIMIT ?,?", perPage*(page-1), amount)
+// UpdateUsers updates the users by querying the database.
+func UpdateUsers() (err error) {
+	users, err := store.GetUsers()
 	if err != nil {
 		return
 	}
 
-	defer rows.Close()
-
-	post := models.Post{} // Create struct to store a post in.
-	for rows.Next() {
-		err = rows.Scan(&post.ID, &post.Title, &post.Description, &post.ImagesJSON, &post.CommentsJSON, &post.CreateTime) // Scan data from query.
-		if err != nil {
-			return
-		}
-
-		posts = append(posts, post) // Append just read post into the posts.
+	for i := range users {
+		users[i].Role = GetRole(users[i].Role.ID)
 	}
 
+	cacheLock.Lock()
+	cachedUsers = users // Replace the old users with the newly read struct.
+	cacheLock.Unlock()
 	return
 }
 
-// GetPost returns a post with a specified ID.
-func GetPost(id int) (post models.Post, exists bool, err error) {
-	rows, err := db.Query("SELECT title, description, images, comments, create_time FROM posts WHERE id=?", id)
+// EditUser updates a user, logging them out everywhere as their password has changed.
+func EditUser(ID int, Email, Password, Fname, Lname string, Role int) (err error) {
+	err = store.EditUser(ID, Email, Password, Fname, Lname, Role)
 	if err != nil {
 		return
 	}
 
-	defer rows.Close()
-
-	exists = rows.Next()
-	if !exists {
+	err = logOutEverywhere(ID)
+	if err != nil {
 		return
 	}
 
-	post.ID = id
-	err = rows.Scan(&post.Title, &post.Description, &post.ImagesJSON, &post.CommentsJSON, &post.CreateTime) // Scan data from query.
-
-	exists = true
+	err = UpdateUsers()
 	return
 }
 
-// EditUser updates a user.
-func EditUser(ID int, Email, Password, Fname, Lname string, Privileges int) (err error) {
-	_, err = db.Exec("UPDATE users SET email=?, password=?, fname=?, lname=?, priv=? WHERE uuid=?", Email, Password, Fname, Lname, Privileges, ID)
+// EditUserNoPassword updates a user without changing the password, revoking their auth tokens if their role changed.
+func EditUserNoPassword(ID int, Email, Fname, Lname string, Role int) (err error) {
+	user, err := store.GetUserFromID(ID)
 	if err != nil {
 		return
 	}
 
-	err = UpdateUsers()
-	return
-}
-
-// EditUserNoPassword updates a user without changing the password.
-func EditUserNoPassword(ID int, Email, Fname, Lname string, Privileges int) (err error) {
-	_, err = db.Exec("UPDATE users SET email=?, fname=?, lname=?, priv=? WHERE uuid=?", Email, Fname, Lname, Privileges, ID)
+	err = store.EditUserNoPassword(ID, Email, Fname, Lname, Role)
 	if err != nil {
 		return
 	}
 
+	if user.Role.ID != Role {
+		err = RevokeTokens(ID)
+		if err != nil {
+			return
+		}
+	}
+
 	err = UpdateUsers()
 	return
 }
 
-// EditSelf updates a user from settings.
+// EditSelf updates a user from settings, logging them out everywhere as their password has changed.
 func EditSelf(ID int, Password, Fname, Lname string) (err error) {
-	_, err = db.Exec("UPDATE users SET password=?, fname=?, lname=? WHERE uuid=?", Password, Fname, Lname, ID)
+	err = store.EditSelf(ID, Password, Fname, Lname)
+	if err != nil {
+		return
+	}
+
+	err = logOutEverywhere(ID)
 	if err != nil {
 		return
 	}
@@ -328,7 +359,7 @@ func EditSelf(ID int, Password, Fname, Lname string) (err error) {
 
 // EditSelfNoPassword updates a user from settings without changing the password.
 func EditSelfNoPassword(ID int, Fname, Lname string) (err error) {
-	_, err = db.Exec("UPDATE users SET fname=?, lname=? WHERE uuid=?", Fname, Lname, ID)
+	err = store.EditSelfNoPassword(ID, Fname, Lname)
 	if err != nil {
 		return
 	}
@@ -338,21 +369,24 @@ func EditSelfNoPassword(ID int, Fname, Lname string) (err error) {
 }
 
 // NewUser creates a new user.
-func NewUser(Email, Password, Fname, Lname string, Privileges int) (id int, err error) {
-	_, err = db.Exec("INSERT INTO users (email, password, fname, lname, priv) VALUES (?, ?, ?, ?, ?)", Email, Password, Fname, Lname, Privileges)
+func NewUser(Email, Password, Fname, Lname string, Role int) (id int, err error) {
+	id, err = store.NewUser(Email, Password, Fname, Lname, Role)
 	if err != nil {
 		return
 	}
 
-	rows, err := db.Query("SELECT uuid FROM users WHERE email=? AND password=? AND fname=? AND lname=? AND priv=? ORDER BY uuid DESC", Email, Password, Fname, Lname, Privileges)
+	err = UpdateUsers()
+	return
+}
+
+// DeleteUser deletes a user along with their sessions.
+func DeleteUser(ID int) (err error) {
+	err = store.DeleteUser(ID)
 	if err != nil {
 		return
 	}
 
-	defer rows.Close()
-
-	rows.Next()
-	err = rows.Scan(&id)
+	err = logOutEverywhere(ID)
 	if err != nil {
 		return
 	}
@@ -361,9 +395,9 @@ func NewUser(Email, Password, Fname, Lname string, Privileges int) (id int, err
 	return
 }
 
-// DeleteUser deletes a user.
-func DeleteUser(ID int) (err error) {
-	_, err = db.Exec("DELETE FROM users WHERE uuid=?", ID)
+// NewRegistration creates a user who signed up themselves, who has no access until they are approved.
+func NewRegistration(Email, Password, Fname, Lname string) (id int, err error) {
+	id, err = store.NewRegistration(Email, Password, Fname, Lname)
 	if err != nil {
 		return
 	}
@@ -372,298 +406,538 @@ func DeleteUser(ID int) (err error) {
 	return
 }
 
-// NewPost creates a new post.
-func NewPost(title, description string, fileLocations []string) (err error) {
-	fileLocationBytes, err := json.Marshal(fileLocations)
-	if err != nil {
+// RenewRegistration replaces the details of a user who hasn't verified their email with those of a new sign up,
+// so old verification links stop working. renewed is false if they aren't unverified.
+func RenewRegistration(uuid int, Password, Fname, Lname string) (renewed bool, err error) {
+	renewed, err = store.RenewRegistration(uuid, Password, Fname, Lname)
+	if err != nil || !renewed {
 		return
 	}
 
-	_, err = db.Exec("INSERT INTO posts (title, description, images, comments) VALUES (?, ?, ?, ?)", title, description, string(fileLocationBytes[:]), "[]")
-	if err != nil {
+	err = UpdateUsers()
+	return
+}
+
+// VerifyRegistration puts a user who signed up themselves in the approval queue once they verify their email.
+// verified is false if they weren't waiting to verify it.
+func VerifyRegistration(uuid int) (verified bool, err error) {
+	verified, err = store.EditRegistration(uuid, models.RegistrationUnverified, models.RegistrationPending)
+	if err != nil || !verified {
 		return
 	}
 
-	err = UpdateIndexPosts()
+	err = UpdateUsers()
 	return
 }
 
-// EditPost updates a post.
-func EditPost(ID int, Title, Description string) (err error) {
-	_, err = db.Exec("UPDATE posts SET title=?, description=? WHERE id=?", Title, Description, ID)
+// ApproveRegistration gives a user in the approval queue a role, returning them as they were approved.
+// approved is false if they weren't in it or the role doesn't exist.
+func ApproveRegistration(uuid, role int) (user models.User, approved bool, err error) {
+	user, approved, err = store.ApproveRegistration(uuid, role)
+	if err != nil || !approved {
+		return
+	}
+
+	err = RevokeTokens(uuid)
 	if err != nil {
 		return
 	}
 
-	err = UpdateIndexPosts()
+	err = UpdateUsers()
 	return
 }
 
-// DeletePost deletes a post and returns all of the images.
-func DeletePost(ID int) (images []string, err error) {
-	rows, err := db.Query("SELECT images FROM posts WHERE id=?", ID)
+// EditSelfEmail updates a user's email after verification.
+func EditSelfEmail(uuid int, email string) (err error) {
+	err = store.EditSelfEmail(uuid, email)
 	if err != nil {
 		return
 	}
 
-	defer rows.Close()
+	err = UpdateUsers()
+	return
+}
 
-	rows.Next()
-	var imagesJSON string
-	err = rows.Scan(&imagesJSON)
+// EditPassword updates a user's password after password recovery, logging them out everywhere.
+func EditPassword(uuid int, password string) (err error) {
+	err = store.EditPassword(uuid, password)
 	if err != nil {
 		return
 	}
 
-	err = json.Unmarshal([]byte(imagesJSON), &images)
+	err = logOutEverywhere(uuid)
 	if err != nil {
 		return
 	}
 
-	_, err = db.Exec("DELETE FROM posts WHERE id=?", ID)
+	err = UpdateUsers()
+	return
+}
+
+/*
+	Two-factor authentication related functions
+*/
+
+// GetTwoFactor returns a user's TOTP secret and the last time step a code was used for.
+func GetTwoFactor(uuid int) (secret string, lastStep int64, err error) {
+	return store.GetTwoFactor(uuid)
+}
+
+// EnableTwoFactor gives a user a TOTP secret and replaces their recovery codes.
+func EnableTwoFactor(uuid int, secret string, step int64, recoveryCodeHashes []string) (err error) {
+	err = store.EnableTwoFactor(uuid, secret, step, recoveryCodeHashes)
 	if err != nil {
 		return
 	}
 
-	err = UpdateIndexPosts()
+	err = UpdateUsers()
 	return
 }
 
-// AddCommentPost adds a comment to a post.
-func AddCommentPost(comment models.NewComment) (id string, err error) {
-	rows, err := db.Query("SELECT comments FROM posts WHERE id=?", comment.ID)
+// DisableTwoFactor removes a user's TOTP secret and recovery codes.
+func DisableTwoFactor(uuid int) (err error) {
+	err = store.DisableTwoFactor(uuid)
 	if err != nil {
 		return
 	}
 
-	defer rows.Close()
+	err = UpdateUsers()
+	return
+}
 
-	rows.Next()
-	var commentsJSONOld string
-	err = rows.Scan(&commentsJSONOld)
-	if err != nil {
-		return
-	}
+// UseTOTPStep records a code being used for a time step, used is false if the code is a replay.
+func UseTOTPStep(uuid int, step int64) (used bool, err error) {
+	return store.UseTOTPStep(uuid, step)
+}
 
-	var comments models.Comments
-	err = json.Unmarshal([]byte(commentsJSONOld), &comments)
-	if err != nil {
-		return
-	}
+// UseRecoveryCode deletes a user's recovery code, used is false if they didn't have it.
+func UseRecoveryCode(uuid int, hash string) (used bool, err error) {
+	return store.UseRecoveryCode(uuid, hash)
+}
 
-	unique := false
-	for !unique {
-		id, err = helpers.GenerateRandomString(32)
-		if err != nil {
+// ReplaceRecoveryCodes replaces every recovery code a user has.
+func ReplaceRecoveryCodes(uuid int, recoveryCodeHashes []string) (err error) {
+	return store.ReplaceRecoveryCodes(uuid, recoveryCodeHashes)
+}
+
+// CountRecoveryCodes returns how many unused recovery codes a user has.
+func CountRecoveryCodes(uuid int) (count int, err error) {
+	return store.CountRecoveryCodes(uuid)
+}
+
+/*
+	Role related functions
+*/
+
+// GetRole returns a role from the cached roles.
+// A role which doesn't exist has no name or permissions.
+func GetRole(ID int) (role models.Role) {
+	for _, role = range Roles() {
+		if role.ID == ID {
 			return
 		}
+	}
 
-		uniqueTemp := true
-		for _, a := range comments {
-			if a.ID == id {
-				uniqueTemp = false
-				break
-			}
-		}
+	return models.Role{ID: ID}
+}
 
-		if uniqueTemp {
-			unique = true
+// RoleExists returns if a role exists.
+func RoleExists(ID int) bool {
+	for _, role := range Roles() {
+		if role.ID == ID {
+			return true
 		}
 	}
 
-	comments = append(comments, models.Comment{
-		ID:        id,
-		UserUUID:  comment.UserUUID,
-		Timestamp: comment.Timestamp,
-		Comment:   comment.Comment,
-	})
+	return false
+}
 
-	commentsBytes, err := json.Marshal(comments)
+// UpdateRoles updates the roles by querying the database.
+func UpdateRoles() (err error) {
+	roles, err := store.GetRoles()
 	if err != nil {
 		return
 	}
 
-	_, err = db.Exec("UPDATE posts SET comments=? WHERE id=?", string(commentsBytes[:]), comment.ID)
+	cacheLock.Lock()
+	cachedRoles = roles // Replace the old roles with the newly read struct.
+	cacheLock.Unlock()
 	return
 }
 
-// DeleteCommentPost deletes a comment to a post.
-func DeleteCommentPost(commentID string, postID int) (err error) {
-	rows, err := db.Query("SELECT comments FROM posts WHERE id=?", postID)
+// NewRole creates a new role.
+func NewRole(name string, permissions []string, requireTwoFactor bool) (id int, err error) {
+	id, err = store.NewRole(name, permissions, requireTwoFactor)
 	if err != nil {
 		return
 	}
 
-	defer rows.Close()
+	err = updateRolesAndUsers()
+	return
+}
 
-	rows.Next()
-	var commentsJSONOld string
-	err = rows.Scan(&commentsJSONOld)
+// EditRole renames a role and replaces its permissions and two-factor policy, revoking the auth tokens of users with it.
+func EditRole(ID int, name string, permissions []string, requireTwoFactor bool) (err error) {
+	err = store.EditRole(ID, name, permissions, requireTwoFactor)
 	if err != nil {
 		return
 	}
 
-	var comments models.Comments
-	err = json.Unmarshal([]byte(commentsJSONOld), &comments)
+	err = revokeRoleTokens(ID)
 	if err != nil {
 		return
 	}
 
-	for i, a := range comments {
-		if a.ID == commentID {
-			comments = append(comments[:i], comments[i+1:]...) // Delete comment.
-			break
-		}
-	}
+	err = updateRolesAndUsers()
+	return
+}
 
-	commentsBytes, err := json.Marshal(comments)
-	if err != nil {
+// DeleteRole deletes a role, unless any users or invitations still have it.
+func DeleteRole(ID int) (inUse bool, err error) {
+	inUse, err = store.DeleteRole(ID)
+	if err != nil || inUse {
 		return
 	}
 
-	_, err = db.Exec("UPDATE posts SET comments=? WHERE id=?", string(commentsBytes[:]), postID)
+	err = updateRolesAndUsers()
 	return
 }
 
-// DeleteCommentPostIfOwner deletes a comment to a post if the comment owner matches a specified UUID.
-func DeleteCommentPostIfOwner(commentID string, postID, userUUID int) (owner bool, err error) {
-	rows, err := db.Query("SELECT comments FROM posts WHERE id=?", postID)
+// updateRolesAndUsers updates the roles and then the users who have them.
+func updateRolesAndUsers() (err error) {
+	err = UpdateRoles()
 	if err != nil {
 		return
 	}
 
-	defer rows.Close()
+	err = UpdateUsers()
+	return
+}
+
+/*
+	Access token related functions
+*/
 
-	rows.Next()
-	var commentsJSONOld string
-	err = rows.Scan(&commentsJSONOld)
-	if err != nil {
-		return
-	}
+// NewAccessToken stores a new personal access token by its hash.
+func NewAccessToken(token models.AccessToken, hash string) (id int, err error) {
+	return store.NewAccessToken(token, hash)
+}
 
-	var comments models.Comments
-	err = json.Unmarshal([]byte(commentsJSONOld), &comments)
-	if err != nil {
-		return
-	}
+// GetAccessTokens returns every access token a user has, newest first.
+func GetAccessTokens(userUUID int) (tokens []models.AccessToken, err error) {
+	return store.GetAccessTokens(userUUID)
+}
 
-	for i, a := range comments {
-		if a.ID == commentID {
-			if a.UserUUID == userUUID {
-				comments = append(comments[:i], comments[i+1:]...) // Delete comment.
-				owner = true
-				break
-			} else {
-				return
-			}
+// GetAccessTokenFromHash returns the access token with a hash.
+func GetAccessTokenFromHash(hash string) (token models.AccessToken, exists bool, err error) {
+	return store.GetAccessTokenFromHash(hash)
+}
+
+// UseAccessToken records when an access token was last used.
+func UseAccessToken(ID int, lastUsed int64) (err error) {
+	return store.UseAccessToken(ID, lastUsed)
+}
+
+// DeleteAccessToken deletes one of a user's access tokens, deleted is false if they don't have it.
+func DeleteAccessToken(ID, userUUID int) (deleted bool, err error) {
+	return store.DeleteAccessToken(ID, userUUID)
+}
+
+/*
+	Passkey related functions
+*/
+
+// NewPasskey stores a new passkey by the hash of its credential ID.
+func NewPasskey(passkey models.Passkey, hash string) (id int, err error) {
+	return store.NewPasskey(passkey, hash)
+}
+
+// GetPasskeys returns every passkey a user has, oldest first.
+func GetPasskeys(userUUID int) (passkeys []models.Passkey, err error) {
+	return store.GetPasskeys(userUUID)
+}
+
+// GetPasskeyFromHash returns the passkey with the hash of a credential ID.
+func GetPasskeyFromHash(hash string) (passkey models.Passkey, exists bool, err error) {
+	return store.GetPasskeyFromHash(hash)
+}
+
+// UsePasskey records a passkey being used, used is false if its signature counter hasn't gone up.
+func UsePasskey(ID int, signCount, lastUsed int64) (used bool, err error) {
+	return store.UsePasskey(ID, signCount, lastUsed)
+}
+
+// DeletePasskey deletes one of a user's passkeys, deleted is false if they don't have it.
+func DeletePasskey(ID, userUUID int) (deleted bool, err error) {
+	return store.DeletePasskey(ID, userUUID)
+}
+
+/*
+	Login failure related functions
+*/
+
+// AddLoginFailure counts a failed login for an email or IP address, returning how many failures it now has.
+func AddLoginFailure(kind, subject string) (failures int, err error) {
+	now := time.Now()
+	return store.AddLoginFailure(kind, subject, now.Unix(), now.Add(-models.LoginFailureResetTime).Unix())
+}
+
+// LockLogin stops an email or IP address logging in until lockedUntil.
+func LockLogin(kind, subject string, lockedUntil int64) (err error) {
+	return store.LockLogin(kind, subject, lockedUntil)
+}
+
+// GetLockedUntil returns when an email or IP address can log in again.
+func GetLockedUntil(kind, subject string) (lockedUntil int64, err error) {
+	return store.GetLockedUntil(kind, subject)
+}
+
+// MarkLoginFailureNotified marks the owner of an email address as told about its failures, marked is false if they already were.
+func MarkLoginFailureNotified(kind, subject string) (marked bool, err error) {
+	return store.MarkLoginFailureNotified(kind, subject)
+}
+
+// GetLoginFailures returns every email and IP address whose failures haven't been forgotten yet.
+func GetLoginFailures() (failures []models.LoginFailure, err error) {
+	return store.GetLoginFailures(time.Now().Add(-models.LoginFailureResetTime).Unix())
+}
+
+// ClearLoginFailures forgets the failures of an email or IP address, unlocking it.
+func ClearLoginFailures(kind, subject string) (err error) {
+	return store.ClearLoginFailures(kind, subject)
+}
+
+// DeleteLoginFailure forgets the failures with an ID, deleted is false if there weren't any.
+func DeleteLoginFailure(ID int) (deleted bool, err error) {
+	return store.DeleteLoginFailure(ID)
+}
+
+func loginFailureGarbageCollector() {
+	ticker := time.NewTicker(time.Hour) // Tick every hour.
+	for {
+		<-ticker.C
+		now := time.Now()
+		err := store.DeleteOldLoginFailures(now.Add(-models.LoginFailureResetTime).Unix(), now.Unix())
+		if err != nil {
+			log.Printf("Error deleting old login failures in login failure garbage collector: %v", err)
+			return
 		}
 	}
+}
+
+/*
+	Invitation related functions
+*/
 
-	commentsBytes, err := json.Marshal(comments)
+// NewInvitation invites an email address to create an account with a role, returning the invitation.
+func NewInvitation(email string, role, invitedBy int) (invitation models.Invitation, err error) {
+	now := time.Now()
+	id, err := store.NewInvitation(email, role, invitedBy, now.Unix(), now.Add(models.InvitationValidTime).Unix())
 	if err != nil {
 		return
 	}
 
-	_, err = db.Exec("UPDATE posts SET comments=? WHERE id=?", string(commentsBytes[:]), postID)
+	return GetInvitation(id)
+}
+
+// GetInvitation returns an invitation, its ID is 0 if there isn't one.
+func GetInvitation(ID int) (invitation models.Invitation, err error) {
+	invitation, err = store.GetInvitation(ID)
+	invitation.Role = GetRole(invitation.Role.ID)
 	return
 }
 
-// AddEmailVerification adds an email verification code to the DB.
-func AddEmailVerification(id string, userUUID int, email string) (err error) {
-	exists, err := rowExists("SELECT id FROM email WHERE useruuid=?", userUUID)
-	if err != nil {
-		return
-	}
-	if exists {
-		_, err = db.Exec("DELETE FROM email WHERE useruuid=?", userUUID)
-		if err != nil {
-			return
-		}
+// GetInvitations returns every invitation which hasn't been accepted or revoked, including expired ones.
+func GetInvitations() (invitations []models.Invitation, err error) {
+	invitations, err = store.GetInvitations()
+	for i := range invitations {
+		invitations[i].Role = GetRole(invitations[i].Role.ID)
 	}
 
-	_, err = db.Exec("INSERT INTO email (uuid, useruuid, email) VALUES (?, ?, ?)", id, userUUID, email)
 	return
 }
 
-// GetEmailVerification retrieves an email verification information.
-func GetEmailVerification(id string) (userUUID int, email string, err error) {
-	rows, err := db.Query("SELECT useruuid, email FROM email WHERE uuid=?", id)
-	if err != nil {
+// ResendInvitation makes a new link for an invitation, which stops its old links working, and returns the invitation.
+// Its ID is 0 if there is no invitation with the ID.
+func ResendInvitation(ID int) (invitation models.Invitation, err error) {
+	resent, err := store.ResendInvitation(ID, time.Now().Add(models.InvitationValidTime).Unix())
+	if err != nil || !resent {
 		return
 	}
 
-	defer rows.Close()
+	return GetInvitation(ID)
+}
 
-	rows.Next()
-	err = rows.Scan(&userUUID, &email)
-	if err != nil {
-		return
-	}
+// DeleteInvitation revokes an invitation, deleted is false if there wasn't one.
+func DeleteInvitation(ID int) (deleted bool, err error) {
+	return store.DeleteInvitation(ID)
+}
 
-	if userUUID != 0 && email != "" {
-		_, err = db.Exec("DELETE FROM email WHERE uuid=?", id)
+// AcceptInvitation uses up an invitation to create its user, accepted is false if the link no longer works.
+func AcceptInvitation(ID, version int, Password, Fname, Lname string) (uuid int, accepted bool, err error) {
+	uuid, accepted, err = store.AcceptInvitation(ID, version, time.Now().Unix(), Password, Fname, Lname)
+	if err != nil || !accepted {
+		return
 	}
 
+	err = UpdateUsers()
 	return
 }
 
-// EditSelfEmail updates a user's email after verification.
-func EditSelfEmail(uuid int, email string) (err error) {
-	_, err = db.Exec("UPDATE users SET email=? WHERE uuid=?", email, uuid)
+/*
+	Post related functions
+*/
+
+// UpdateIndexPosts updates the index posts by querying the database.
+func UpdateIndexPosts() (err error) {
+	posts, err := store.GetPosts(3, 3, 1, false)
 	if err != nil {
 		return
 	}
 
-	err = UpdateUsers()
+	cacheLock.Lock()
+	cachedIndexPosts = posts // Replace the old posts with the newly read struct.
+	postsUpdated = time.Now()
+	cacheLock.Unlock()
 	return
 }
 
-// AddRecovery adds a password recovery code to the DB.
-func AddRecovery(id string, userUUID int, email string) (err error) {
-	exists, err := rowExists("SELECT id FROM recovery WHERE useruuid=?", userUUID)
+// GetPosts returns a specified amount of posts.
+// Drafts and scheduled posts are only included if includeUnpublished is set.
+func GetPosts(amount, perPage, page int, includeUnpublished bool) (posts models.Posts, err error) {
+	return store.GetPosts(amount, perPage, page, includeUnpublished)
+}
+
+// GetPost returns a post with a specified ID.
+func GetPost(id int) (post models.Post, exists bool, err error) {
+	return store.GetPost(id)
+}
+
+// NewPost creates a new post.
+func NewPost(title, description string, images []models.Image, status int, publishTime int64) (id int, err error) {
+	id, err = store.NewPost(title, description, images, status, publishTime)
 	if err != nil {
 		return
 	}
-	if exists {
-		_, err = db.Exec("DELETE FROM recovery WHERE useruuid=?", userUUID)
-		if err != nil {
-			return
-		}
-	}
 
-	_, err = db.Exec("INSERT INTO recovery (uuid, useruuid, email) VALUES (?, ?, ?)", id, userUUID, email)
+	err = UpdateIndexPosts()
 	return
 }
 
-// GetRecovery retrieves a password recovery code from the DB.
-func GetRecovery(id string) (userUUID int, email string, err error) {
-	rows, err := db.Query("SELECT useruuid, email FROM recovery WHERE uuid=?", id)
+// EditPost updates a post.
+func EditPost(ID int, Title, Description string) (err error) {
+	err = store.EditPost(ID, Title, Description)
 	if err != nil {
 		return
 	}
 
-	defer rows.Close()
+	err = UpdateIndexPosts()
+	return
+}
 
-	rows.Next()
-	err = rows.Scan(&userUUID, &email)
+// EditPostStatus changes whether a post is a draft, scheduled or published.
+func EditPostStatus(ID, status int, publishTime int64) (err error) {
+	err = store.EditPostStatus(ID, status, publishTime)
 	if err != nil {
 		return
 	}
 
-	if userUUID != 0 && email != "" {
-		_, err = db.Exec("DELETE FROM recovery WHERE uuid=?", id)
+	err = UpdateIndexPosts()
+	return
+}
+
+func postScheduler() {
+	ticker := time.NewTicker(time.Minute) // Tick every minute.
+	for {
+		<-ticker.C
+		published, err := store.PublishScheduledPosts(time.Now().Unix())
+		if err != nil {
+			log.Printf("Error publishing scheduled posts in post scheduler: %v", err)
+			continue
+		}
+
+		if published == 0 {
+			continue
+		}
+
+		err = UpdateIndexPosts()
+		if err != nil {
+			log.Printf("Error updating index posts in post scheduler: %v", err)
+		}
 	}
+}
 
+// DeletePost deletes a post and returns all of the images.
+func DeletePost(ID int) (images []models.Image, err error) {
+	images, err = store.DeletePost(ID)
+	if err != nil {
+		return
+	}
+
+	err = UpdateIndexPosts()
 	return
 }
 
-// EditPassword updates a user's password after password recovery.
-func EditPassword(uuid int, password string) (err error) {
-	_, err = db.Exec("UPDATE users SET password=? WHERE uuid=?", password, uuid)
+// EditImage moves an image to a new position within its post and updates its caption.
+func EditImage(ID, Position int, Caption string) (err error) {
+	err = store.EditImage(ID, Position, Caption)
 	if err != nil {
 		return
 	}
 
-	err = UpdateUsers()
+	err = UpdateIndexPosts()
 	return
 }
+
+/*
+	Comment related functions
+*/
+
+// AddCommentPost adds a comment to a post.
+func AddCommentPost(comment models.NewComment) (id string, err error) {
+	return store.AddCommentPost(comment)
+}
+
+// EditCommentPost replaces the text of a comment, keeping the old text as a revision.
+func EditCommentPost(commentID string, postID int, comment string, timestamp int64) (err error) {
+	return store.EditCommentPost(commentID, postID, comment, timestamp)
+}
+
+// EditCommentPostIfOwner edits a comment if the comment owner matches a specified UUID.
+func EditCommentPostIfOwner(commentID string, postID, userUUID int, comment string, timestamp int64) (owner bool, err error) {
+	return store.EditCommentPostIfOwner(commentID, postID, userUUID, comment, timestamp)
+}
+
+// DeleteCommentPost deletes a comment to a post.
+func DeleteCommentPost(commentID string, postID int) (err error) {
+	return store.DeleteCommentPost(commentID, postID)
+}
+
+// DeleteCommentPostIfOwner deletes a comment to a post if the comment owner matches a specified UUID.
+func DeleteCommentPostIfOwner(commentID string, postID, userUUID int) (owner bool, err error) {
+	return store.DeleteCommentPostIfOwner(commentID, postID, userUUID)
+}
+
+/*
+	Email verification and recovery related functions
+*/
+
+// AddEmailVerification adds an email verification code to the DB.
+func AddEmailVerification(id string, userUUID int, email string) (err error) {
+	return store.AddEmailVerification(id, userUUID, email)
+}
+
+// GetEmailVerification retrieves an email verification information.
+func GetEmailVerification(id string) (userUUID int, email string, err error) {
+	return store.GetEmailVerification(id)
+}
+
+// AddRecovery adds a password recovery code to the DB.
+func AddRecovery(id string, userUUID int, email string) (err error) {
+	return store.AddRecovery(id, userUUID, email)
+}
+
+// GetRecovery retrieves a password recovery code from the DB.
+func GetRecovery(id string) (userUUID int, email string, err error) {
+	return store.GetRecovery(id)
+}
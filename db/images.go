@@ -0,0 +1,99 @@
+package db
+
+import (
+	"strings"
+
+	"github.com/VolticFroogo/Bernies-Busy-Bees/models"
+)
+
+/*
+	Image related functions
+*/
+
+// getImages returns the images of each post, in order, mapped by post ID.
+func (s *sqlStore) getImages(postIDs ...int) (images map[int][]models.Image, err error) {
+	images = make(map[int][]models.Image)
+	if len(postIDs) == 0 {
+		return
+	}
+
+	args := make([]interface{}, len(postIDs))
+	for i, id := range postIDs {
+		args[i] = id
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(postIDs)), ",")
+	rows, err := s.db.Query("SELECT id, postid, position, s3key, filename, contenttype, size, width, height, caption FROM post_images WHERE postid IN ("+placeholders+") ORDER BY postid, position, id", args...)
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		image := models.Image{} // Create struct to store an image in.
+
+		err = rows.Scan(&image.ID, &image.PostID, &image.Position, &image.Key, &image.Filename, &image.ContentType, &image.Size, &image.Width, &image.Height, &image.Caption) // Scan data from query.
+		if err != nil {
+			return
+		}
+
+		images[image.PostID] = append(images[image.PostID], image)
+	}
+
+	return
+}
+
+// EditImage moves an image to a new position within its post and updates its caption.
+func (s *sqlStore) EditImage(ID, Position int, Caption string) (err error) {
+	var postID int
+	err = s.db.QueryRow("SELECT postid FROM post_images WHERE id=?", ID).Scan(&postID)
+	if err != nil {
+		return
+	}
+
+	images, err := s.getImages(postID)
+	if err != nil {
+		return
+	}
+
+	// Take the image out of the order and put it back in at its new position.
+	order := make([]int, 0, len(images[postID]))
+	for _, image := range images[postID] {
+		if image.ID != ID {
+			order = append(order, image.ID)
+		}
+	}
+
+	if Position < 0 {
+		Position = 0
+	} else if Position > len(order) {
+		Position = len(order)
+	}
+
+	order = append(order[:Position], append([]int{ID}, order[Position:]...)...)
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+
+		err = tx.Commit()
+	}()
+
+	for position, id := range order {
+		_, err = tx.Exec("UPDATE post_images SET position=? WHERE id=?", position, id)
+		if err != nil {
+			return
+		}
+	}
+
+	_, err = tx.Exec("UPDATE post_images SET caption=? WHERE id=?", Caption, ID)
+	return
+}
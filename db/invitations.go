@@ -0,0 +1,144 @@
+package db
+
+import (
+	"database/sql"
+
+	"github.com/VolticFroogo/Bernies-Busy-Bees/models"
+)
+
+/*
+	Invitation related functions
+*/
+
+// NewInvitation stores an invitation for an email address to create an account with a role.
+func (s *sqlStore) NewInvitation(email string, role, invitedBy int, now, expiry int64) (id int, err error) {
+	res, err := s.db.Exec("INSERT INTO invitations (email, role, invited_by, create_time, expiry) VALUES (?, ?, ?, ?, ?)",
+		email, role, invitedBy, now, expiry)
+	if err != nil {
+		return
+	}
+
+	lastID, err := res.LastInsertId()
+	if err != nil {
+		return
+	}
+
+	id = int(lastID)
+	return
+}
+
+// GetInvitation returns an invitation, its ID is 0 if there isn't one.
+func (s *sqlStore) GetInvitation(ID int) (invitation models.Invitation, err error) {
+	err = s.db.QueryRow("SELECT id, email, role, version, invited_by, create_time, expiry FROM invitations WHERE id=?", ID).Scan(
+		&invitation.ID, &invitation.Email, &invitation.Role.ID, &invitation.Version, &invitation.InvitedBy, &invitation.CreateTime, &invitation.Expiry) // Scan data from query.
+	if err == sql.ErrNoRows {
+		return invitation, nil
+	}
+
+	return
+}
+
+// GetInvitations returns every invitation which hasn't been accepted or revoked, newest first.
+func (s *sqlStore) GetInvitations() (invitations []models.Invitation, err error) {
+	rows, err := s.db.Query("SELECT id, email, role, version, invited_by, create_time, expiry FROM invitations ORDER BY id DESC")
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var invitation models.Invitation
+		err = rows.Scan(&invitation.ID, &invitation.Email, &invitation.Role.ID, &invitation.Version, &invitation.InvitedBy, &invitation.CreateTime, &invitation.Expiry) // Scan data from query.
+		if err != nil {
+			return
+		}
+
+		invitations = append(invitations, invitation)
+	}
+
+	err = rows.Err()
+	return
+}
+
+// ResendInvitation gives an invitation a new expiry and version, which stops its old links working.
+// resent is false if there is no invitation with the ID.
+func (s *sqlStore) ResendInvitation(ID int, expiry int64) (resent bool, err error) {
+	res, err := s.db.Exec("UPDATE invitations SET version=version+1, expiry=? WHERE id=?", expiry, ID)
+	if err != nil {
+		return
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return
+	}
+
+	return affected != 0, nil
+}
+
+// DeleteInvitation revokes an invitation, deleted is false if there wasn't one.
+func (s *sqlStore) DeleteInvitation(ID int) (deleted bool, err error) {
+	res, err := s.db.Exec("DELETE FROM invitations WHERE id=?", ID)
+	if err != nil {
+		return
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return
+	}
+
+	return affected != 0, nil
+}
+
+// AcceptInvitation uses up an invitation to create its user, accepted is false if the invitation's version
+// has been resent, revoked, already accepted or has expired.
+func (s *sqlStore) AcceptInvitation(ID, version int, now int64, Password, Fname, Lname string) (uuid int, accepted bool, err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return
+	}
+
+	defer func() {
+		if err != nil || !accepted {
+			tx.Rollback()
+			return
+		}
+
+		err = tx.Commit()
+	}()
+
+	var email string
+	var role int
+	err = tx.QueryRow("SELECT email, role FROM invitations WHERE id=? AND version=? AND expiry>?", ID, version, now).Scan(&email, &role) // Scan data from query.
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return
+	}
+
+	// Only one request can delete the invitation, so it can't be accepted twice at once.
+	res, err := tx.Exec("DELETE FROM invitations WHERE id=? AND version=?", ID, version)
+	if err != nil {
+		return
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil || affected == 0 {
+		return
+	}
+
+	res, err = tx.Exec("INSERT INTO users (email, password, fname, lname, role) VALUES (?, ?, ?, ?, ?)", email, Password, Fname, Lname, role)
+	if err != nil {
+		return
+	}
+
+	lastID, err := res.LastInsertId()
+	if err != nil {
+		return
+	}
+
+	return int(lastID), true, nil
+}
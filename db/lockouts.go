@@ -0,0 +1,131 @@
+package db
+
+import (
+	"database/sql"
+
+	"github.com/VolticFroogo/Bernies-Busy-Bees/models"
+)
+
+/*
+	Login failure related functions
+*/
+
+// AddLoginFailure counts a failed login for an email or IP address, returning how many failures it now has.
+// Failures from before resetBefore are forgotten first.
+func (s *sqlStore) AddLoginFailure(kind, subject string, now, resetBefore int64) (failures int, err error) {
+	// last_failure is set last as MySQL uses the new value of a column in later assignments.
+	update := func() (updated bool, err error) {
+		res, err := s.db.Exec(`UPDATE login_failures SET
+			failures = CASE WHEN last_failure < ? THEN 1 ELSE failures + 1 END,
+			notified = CASE WHEN last_failure < ? THEN 0 ELSE notified END,
+			last_failure = ?
+			WHERE kind=? AND subject=?`, resetBefore, resetBefore, now, kind, subject)
+		if err != nil {
+			return
+		}
+
+		affected, err := res.RowsAffected()
+		return affected != 0, err
+	}
+
+	updated, err := update()
+	if err != nil {
+		return
+	}
+
+	if !updated {
+		_, err = s.db.Exec("INSERT INTO login_failures (kind, subject, failures, last_failure) VALUES (?, ?, 1, ?)", kind, subject, now)
+		if err != nil {
+			// Another failure may have inserted it first.
+			_, err = update()
+			if err != nil {
+				return
+			}
+		}
+	}
+
+	err = s.db.QueryRow("SELECT failures FROM login_failures WHERE kind=? AND subject=?", kind, subject).Scan(&failures) // Scan data from query.
+	return
+}
+
+// LockLogin stops an email or IP address logging in until lockedUntil.
+func (s *sqlStore) LockLogin(kind, subject string, lockedUntil int64) (err error) {
+	_, err = s.db.Exec("UPDATE login_failures SET locked_until=? WHERE kind=? AND subject=?", lockedUntil, kind, subject)
+	return
+}
+
+// GetLockedUntil returns when an email or IP address can log in again, which is 0 if it has never been locked.
+func (s *sqlStore) GetLockedUntil(kind, subject string) (lockedUntil int64, err error) {
+	err = s.db.QueryRow("SELECT locked_until FROM login_failures WHERE kind=? AND subject=?", kind, subject).Scan(&lockedUntil) // Scan data from query.
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+
+	return
+}
+
+// MarkLoginFailureNotified marks the owner of an email address as told about its failures.
+// marked is false if they already had been since its failures were last cleared.
+func (s *sqlStore) MarkLoginFailureNotified(kind, subject string) (marked bool, err error) {
+	res, err := s.db.Exec("UPDATE login_failures SET notified=1 WHERE kind=? AND subject=? AND notified=0", kind, subject)
+	if err != nil {
+		return
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return
+	}
+
+	return affected != 0, nil
+}
+
+// GetLoginFailures returns every email and IP address which has failed to log in since a time, the latest first.
+func (s *sqlStore) GetLoginFailures(since int64) (failures []models.LoginFailure, err error) {
+	rows, err := s.db.Query("SELECT id, kind, subject, failures, last_failure, locked_until FROM login_failures WHERE last_failure>=? ORDER BY last_failure DESC", since)
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var failure models.LoginFailure
+		err = rows.Scan(&failure.ID, &failure.Kind, &failure.Subject, &failure.Failures, &failure.LastFailure, &failure.LockedUntil) // Scan data from query.
+		if err != nil {
+			return
+		}
+
+		failures = append(failures, failure)
+	}
+
+	err = rows.Err()
+	return
+}
+
+// ClearLoginFailures forgets the failures of an email or IP address, unlocking it.
+func (s *sqlStore) ClearLoginFailures(kind, subject string) (err error) {
+	_, err = s.db.Exec("DELETE FROM login_failures WHERE kind=? AND subject=?", kind, subject)
+	return
+}
+
+// DeleteLoginFailure forgets the failures with an ID, deleted is false if there weren't any.
+func (s *sqlStore) DeleteLoginFailure(ID int) (deleted bool, err error) {
+	res, err := s.db.Exec("DELETE FROM login_failures WHERE id=?", ID)
+	if err != nil {
+		return
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return
+	}
+
+	return affected != 0, nil
+}
+
+// DeleteOldLoginFailures deletes failures from before a time which are no longer locked.
+func (s *sqlStore) DeleteOldLoginFailures(before, now int64) (err error) {
+	_, err = s.db.Exec("DELETE FROM login_failures WHERE last_failure<? AND locked_until<?", before, now)
+	return
+}
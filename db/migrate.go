@@ -0,0 +1,348 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/VolticFroogo/Bernies-Busy-Bees/models"
+)
+
+/*
+	Structs and variables
+*/
+
+// migration is a single versioned change to the schema, made of steps which are run in order.
+type migration struct {
+	Version     int
+	Description string
+	Up, Down    []step
+}
+
+// step is part of a migration, which can have at most one DDL statement as MySQL commits after each one.
+type step func(tx *sql.Tx, d dialect) error
+
+// dialect holds the differences in SQL between the supported databases.
+type dialect struct {
+	name     string
+	replacer *strings.Replacer
+}
+
+var (
+	mysqlDialect = dialect{
+		name: TypeMySQL,
+		replacer: strings.NewReplacer(
+			"{{pk}}", "INT NOT NULL AUTO_INCREMENT PRIMARY KEY",
+		),
+	}
+
+	sqliteDialect = dialect{
+		name: TypeSQLite,
+		replacer: strings.NewReplacer(
+			"{{pk}}", "INTEGER PRIMARY KEY AUTOINCREMENT",
+		),
+	}
+)
+
+// exec executes each statement in order after replacing the dialect specific placeholders.
+func (d dialect) exec(tx *sql.Tx, statements ...string) (err error) {
+	for _, statement := range statements {
+		_, err = tx.Exec(d.replacer.Replace(statement))
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// statement returns a step which executes a statement.
+func statement(statement string) step {
+	return func(tx *sql.Tx, d dialect) error {
+		return d.exec(tx, statement)
+	}
+}
+
+// statements returns a step for each statement.
+func statements(statements ...string) (steps []step) {
+	for _, s := range statements {
+		steps = append(steps, statement(s))
+	}
+
+	return
+}
+
+// dropIndex returns a step which drops an index from a table.
+func dropIndex(table, index string) step {
+	return func(tx *sql.Tx, d dialect) error {
+		return d.dropIndex(tx, table, index)
+	}
+}
+
+// dropIndex drops an index from a table.
+func (d dialect) dropIndex(tx *sql.Tx, table, index string) (err error) {
+	if d.name == TypeMySQL {
+		_, err = tx.Exec(fmt.Sprintf("DROP INDEX %s ON %s", index, table))
+		return
+	}
+
+	_, err = tx.Exec(fmt.Sprintf("DROP INDEX %s", index))
+	return
+}
+
+// unixTime returns an expression converting a TIMESTAMP column to unix time.
+func (d dialect) unixTime(column string) string {
+	if d.name == TypeMySQL {
+		return fmt.Sprintf("UNIX_TIMESTAMP(%s)", column)
+	}
+
+	return fmt.Sprintf("CAST(strftime('%%s', %s) AS INTEGER)", column)
+}
+
+/*
+	Migration functions
+*/
+
+func latestVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+func (s *sqlStore) createMigrationsTable() (err error) {
+	_, err = s.db.Exec("CREATE TABLE IF NOT EXISTS schema_migrations (version INT NOT NULL PRIMARY KEY, description VARCHAR(256) NOT NULL, applied_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP)")
+	if err != nil {
+		return
+	}
+
+	// schema_migration_steps records how far through a migration MySQL got before it failed.
+	_, err = s.db.Exec("CREATE TABLE IF NOT EXISTS schema_migration_steps (version INT NOT NULL PRIMARY KEY, direction VARCHAR(4) NOT NULL, steps INT NOT NULL)")
+	return
+}
+
+func (s *sqlStore) currentVersion() (version int, err error) {
+	err = s.createMigrationsTable()
+	if err != nil {
+		return
+	}
+
+	var max sql.NullInt64
+	err = s.db.QueryRow("SELECT MAX(version) FROM schema_migrations").Scan(&max)
+	if err != nil {
+		return
+	}
+
+	version = int(max.Int64)
+	if version > latestVersion() {
+		err = fmt.Errorf("database schema version %v is newer than the latest known version %v", version, latestVersion())
+	}
+
+	return
+}
+
+// unfinishedMigration returns the migration which failed part way through, version is 0 if there isn't one.
+func (s *sqlStore) unfinishedMigration() (version int, direction string, steps int, err error) {
+	err = s.db.QueryRow("SELECT version, direction, steps FROM schema_migration_steps").Scan(&version, &direction, &steps) // Scan data from query.
+	if err == sql.ErrNoRows {
+		return 0, "", 0, nil
+	}
+
+	return
+}
+
+// transaction runs fn in a transaction, which is committed unless fn returns an error.
+func (s *sqlStore) transaction(fn func(tx *sql.Tx) error) (err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+
+		err = tx.Commit()
+	}()
+
+	return fn(tx)
+}
+
+// runMigration applies or reverts a migration.
+// SQLite runs the whole migration in one transaction, so it is either fully run or not at all.
+// MySQL commits after every DDL statement, so a failed migration can't be rolled back. Instead each step is
+// committed along with how many steps have been run, and running the migration again carries on from the step
+// which failed once the cause has been fixed.
+func (s *sqlStore) runMigration(m migration, up bool) (err error) {
+	steps, direction, action := m.Down, "down", fmt.Sprintf("migrating down from version %v", m.Version)
+	if up {
+		steps, direction, action = m.Up, "up", fmt.Sprintf("migrating up to version %v", m.Version)
+	}
+
+	if s.dialect.name != TypeMySQL {
+		return s.transaction(func(tx *sql.Tx) (err error) {
+			for i, step := range steps {
+				err = step(tx, s.dialect)
+				if err != nil {
+					return fmt.Errorf("%s, step %v: %v", action, i+1, err)
+				}
+			}
+
+			return finishMigration(tx, m, up)
+		})
+	}
+
+	version, unfinishedDirection, done, err := s.unfinishedMigration()
+	if err != nil {
+		return
+	}
+
+	if version != m.Version || unfinishedDirection != direction {
+		done = 0
+	}
+
+	for i := done; i < len(steps); i++ {
+		err = s.transaction(func(tx *sql.Tx) (err error) {
+			err = steps[i](tx, s.dialect)
+			if err != nil {
+				return
+			}
+
+			_, err = tx.Exec("DELETE FROM schema_migration_steps")
+			if err != nil {
+				return
+			}
+
+			_, err = tx.Exec("INSERT INTO schema_migration_steps (version, direction, steps) VALUES (?, ?, ?)", m.Version, direction, i+1)
+			return
+		})
+		if err != nil {
+			return fmt.Errorf("%s, step %v of %v (run the migration again to carry on from this step): %v", action, i+1, len(steps), err)
+		}
+	}
+
+	return s.transaction(func(tx *sql.Tx) error {
+		return finishMigration(tx, m, up)
+	})
+}
+
+// finishMigration records that a migration has been applied or reverted.
+func finishMigration(tx *sql.Tx, m migration, up bool) (err error) {
+	_, err = tx.Exec("DELETE FROM schema_migration_steps")
+	if err != nil {
+		return
+	}
+
+	if up {
+		_, err = tx.Exec("INSERT INTO schema_migrations (version, description) VALUES (?, ?)", m.Version, m.Description)
+		return
+	}
+
+	_, err = tx.Exec("DELETE FROM schema_migrations WHERE version=?", m.Version)
+	return
+}
+
+// MigrateUp applies every migration newer than the current schema version.
+func (s *sqlStore) MigrateUp() (err error) {
+	version, err := s.currentVersion()
+	if err != nil {
+		return
+	}
+
+	_, direction, _, err := s.unfinishedMigration()
+	if err != nil {
+		return
+	}
+
+	if direction == "down" {
+		return fmt.Errorf("a migration failed part way through migrating down, run migrate down to finish it first")
+	}
+
+	for _, m := range migrations {
+		if m.Version <= version {
+			continue
+		}
+
+		err = s.runMigration(m, true)
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// MigrateDown reverts the most recently applied migration.
+func (s *sqlStore) MigrateDown() (err error) {
+	version, err := s.currentVersion()
+	if err != nil {
+		return
+	}
+
+	_, direction, _, err := s.unfinishedMigration()
+	if err != nil {
+		return
+	}
+
+	if direction == "up" {
+		return fmt.Errorf("a migration failed part way through migrating up, run migrate up to finish it first")
+	}
+
+	for i := len(migrations) - 1; i >= 0; i-- {
+		if migrations[i].Version == version {
+			return s.runMigration(migrations[i], false)
+		}
+	}
+
+	return fmt.Errorf("no migrations have been applied")
+}
+
+// MigrationStatus returns every known migration and whether it has been applied.
+func (s *sqlStore) MigrationStatus() (status models.Migrations, err error) {
+	err = s.createMigrationsTable()
+	if err != nil {
+		return
+	}
+
+	rows, err := s.db.Query("SELECT version, description, applied_time FROM schema_migrations ORDER BY version")
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	applied := make(map[int]models.Migration)
+	for rows.Next() {
+		m := models.Migration{Applied: true}
+		err = rows.Scan(&m.Version, &m.Description, &m.AppliedTime) // Scan data from query.
+		if err != nil {
+			return
+		}
+
+		applied[m.Version] = m
+	}
+
+	for _, m := range migrations {
+		if a, ok := applied[m.Version]; ok {
+			status = append(status, a)
+			delete(applied, m.Version)
+			continue
+		}
+
+		status = append(status, models.Migration{
+			Version:     m.Version,
+			Description: m.Description,
+		})
+	}
+
+	// Anything left over was applied by a newer version of the site.
+	var unknown models.Migrations
+	for _, a := range applied {
+		unknown = append(unknown, a)
+	}
+
+	sort.Slice(unknown, func(i, j int) bool { return unknown[i].Version < unknown[j].Version })
+	status = append(status, unknown...)
+
+	return
+}
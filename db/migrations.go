@@ -0,0 +1,564 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"mime"
+	"path"
+
+	"github.com/VolticFroogo/Bernies-Busy-Bees/models"
+)
+
+// migrations are every schema change in the order they are applied.
+// Never edit or reorder a migration once it has been released, add a new one instead.
+// Each step may only have one DDL statement, see runMigration.
+var migrations = []migration{
+	{
+		Version:     1,
+		Description: "create users, posts, jti, email and recovery tables",
+		// The tables may already exist on servers created before migrations were introduced.
+		Up: statements(
+			`CREATE TABLE IF NOT EXISTS users (
+				uuid {{pk}},
+				email VARCHAR(256) NOT NULL,
+				password VARCHAR(256) NOT NULL,
+				fname VARCHAR(16) NOT NULL,
+				lname VARCHAR(16) NOT NULL,
+				priv INT NOT NULL DEFAULT 0,
+				create_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+			)`,
+			`CREATE TABLE IF NOT EXISTS posts (
+				id {{pk}},
+				title VARCHAR(128) NOT NULL,
+				description TEXT NOT NULL,
+				images TEXT NOT NULL,
+				comments TEXT NOT NULL,
+				create_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+			)`,
+			`CREATE TABLE IF NOT EXISTS jti (
+				id {{pk}},
+				jti VARCHAR(64) NOT NULL,
+				expiry BIGINT NOT NULL
+			)`,
+			`CREATE TABLE IF NOT EXISTS email (
+				id {{pk}},
+				uuid VARCHAR(64) NOT NULL,
+				useruuid INT NOT NULL,
+				email VARCHAR(256) NOT NULL
+			)`,
+			`CREATE TABLE IF NOT EXISTS recovery (
+				id {{pk}},
+				uuid VARCHAR(64) NOT NULL,
+				useruuid INT NOT NULL,
+				email VARCHAR(256) NOT NULL
+			)`,
+		),
+		Down: statements(
+			"DROP TABLE recovery",
+			"DROP TABLE email",
+			"DROP TABLE jti",
+			"DROP TABLE posts",
+			"DROP TABLE users",
+		),
+	},
+	{
+		Version:     2,
+		Description: "index token and code lookups",
+		Up: statements(
+			"CREATE INDEX jti_jti ON jti (jti)",
+			"CREATE INDEX jti_expiry ON jti (expiry)",
+			"CREATE INDEX email_uuid ON email (uuid)",
+			"CREATE INDEX email_useruuid ON email (useruuid)",
+			"CREATE INDEX recovery_uuid ON recovery (uuid)",
+			"CREATE INDEX recovery_useruuid ON recovery (useruuid)",
+			"CREATE INDEX users_email ON users (email)",
+		),
+		Down: []step{
+			dropIndex("users", "users_email"),
+			dropIndex("recovery", "recovery_useruuid"),
+			dropIndex("recovery", "recovery_uuid"),
+			dropIndex("email", "email_useruuid"),
+			dropIndex("email", "email_uuid"),
+			dropIndex("jti", "jti_expiry"),
+			dropIndex("jti", "jti_jti"),
+		},
+	},
+	{
+		Version:     3,
+		Description: "move post comments from a JSON column into the comments table",
+		Up: []step{
+			statement(`CREATE TABLE comments (
+				id {{pk}},
+				uuid VARCHAR(64) NOT NULL,
+				postid INT NOT NULL,
+				useruuid INT NOT NULL,
+				timestamp BIGINT NOT NULL,
+				comment TEXT NOT NULL
+			)`),
+			statement("CREATE UNIQUE INDEX comments_uuid ON comments (uuid)"),
+			statement("CREATE INDEX comments_postid ON comments (postid)"),
+			func(tx *sql.Tx, d dialect) (err error) {
+				rows, err := tx.Query("SELECT id, comments FROM posts ORDER BY id")
+				if err != nil {
+					return
+				}
+
+				// Read every post before inserting as a connection can't run a query while another is being read.
+				commentsJSON := make(map[int]string)
+				var postIDs []int
+				for rows.Next() {
+					var id int
+					var blob string
+					err = rows.Scan(&id, &blob)
+					if err != nil {
+						rows.Close()
+						return
+					}
+
+					postIDs = append(postIDs, id)
+					commentsJSON[id] = blob
+				}
+
+				rows.Close()
+				err = rows.Err()
+				if err != nil {
+					return
+				}
+
+				for _, postID := range postIDs {
+					var comments models.Comments
+					err = json.Unmarshal([]byte(commentsJSON[postID]), &comments)
+					if err != nil {
+						return
+					}
+
+					for _, c := range comments {
+						_, err = tx.Exec("INSERT INTO comments (uuid, postid, useruuid, timestamp, comment) VALUES (?, ?, ?, ?, ?)", c.ID, postID, c.UserUUID, c.Timestamp, c.Comment)
+						if err != nil {
+							return
+						}
+					}
+				}
+
+				return
+			},
+			statement("ALTER TABLE posts DROP COLUMN comments"),
+		},
+		Down: []step{
+			statement("ALTER TABLE posts ADD comments TEXT"),
+			func(tx *sql.Tx, d dialect) (err error) {
+				_, err = tx.Exec("UPDATE posts SET comments='[]'")
+				if err != nil {
+					return
+				}
+
+				rows, err := tx.Query("SELECT uuid, postid, useruuid, timestamp, comment FROM comments ORDER BY id")
+				if err != nil {
+					return
+				}
+
+				comments := make(map[int]models.Comments)
+				for rows.Next() {
+					var postID int
+					c := models.Comment{}
+					err = rows.Scan(&c.ID, &postID, &c.UserUUID, &c.Timestamp, &c.Comment)
+					if err != nil {
+						rows.Close()
+						return
+					}
+
+					comments[postID] = append(comments[postID], c)
+				}
+
+				rows.Close()
+				err = rows.Err()
+				if err != nil {
+					return
+				}
+
+				for postID, postComments := range comments {
+					var commentsBytes []byte
+					commentsBytes, err = json.Marshal(postComments)
+					if err != nil {
+						return
+					}
+
+					_, err = tx.Exec("UPDATE posts SET comments=? WHERE id=?", string(commentsBytes), postID)
+					if err != nil {
+						return
+					}
+				}
+
+				return
+			},
+			statement("DROP TABLE comments"),
+		},
+	},
+	{
+		Version:     4,
+		Description: "move post images from a JSON column into the post_images table",
+		Up: []step{
+			statement(`CREATE TABLE post_images (
+				id {{pk}},
+				postid INT NOT NULL,
+				position INT NOT NULL,
+				s3key VARCHAR(256) NOT NULL,
+				filename VARCHAR(256) NOT NULL,
+				contenttype VARCHAR(128) NOT NULL,
+				size BIGINT NOT NULL,
+				width INT NOT NULL,
+				height INT NOT NULL,
+				caption VARCHAR(256) NOT NULL
+			)`),
+			statement("CREATE INDEX post_images_postid ON post_images (postid, position)"),
+			func(tx *sql.Tx, d dialect) (err error) {
+				rows, err := tx.Query("SELECT id, images FROM posts ORDER BY id")
+				if err != nil {
+					return
+				}
+
+				imagesJSON := make(map[int]string)
+				var postIDs []int
+				for rows.Next() {
+					var id int
+					var blob string
+					err = rows.Scan(&id, &blob)
+					if err != nil {
+						rows.Close()
+						return
+					}
+
+					postIDs = append(postIDs, id)
+					imagesJSON[id] = blob
+				}
+
+				rows.Close()
+				err = rows.Err()
+				if err != nil {
+					return
+				}
+
+				for _, postID := range postIDs {
+					var fileNames []string
+					err = json.Unmarshal([]byte(imagesJSON[postID]), &fileNames)
+					if err != nil {
+						return
+					}
+
+					// The original file name, size and dimensions of old images were never recorded.
+					for position, fileName := range fileNames {
+						_, err = tx.Exec("INSERT INTO post_images (postid, position, s3key, filename, contenttype, size, width, height, caption) VALUES (?, ?, ?, ?, ?, 0, 0, 0, '')",
+							postID, position, models.ImageKeyPrefix+fileName, fileName, mime.TypeByExtension(path.Ext(fileName)))
+						if err != nil {
+							return
+						}
+					}
+				}
+
+				return
+			},
+			statement("ALTER TABLE posts DROP COLUMN images"),
+		},
+		Down: []step{
+			statement("ALTER TABLE posts ADD images TEXT"),
+			func(tx *sql.Tx, d dialect) (err error) {
+				_, err = tx.Exec("UPDATE posts SET images='[]'")
+				if err != nil {
+					return
+				}
+
+				rows, err := tx.Query("SELECT postid, s3key FROM post_images ORDER BY postid, position, id")
+				if err != nil {
+					return
+				}
+
+				fileNames := make(map[int][]string)
+				for rows.Next() {
+					var postID int
+					var key string
+					err = rows.Scan(&postID, &key)
+					if err != nil {
+						rows.Close()
+						return
+					}
+
+					fileNames[postID] = append(fileNames[postID], path.Base(key))
+				}
+
+				rows.Close()
+				err = rows.Err()
+				if err != nil {
+					return
+				}
+
+				for postID, postFileNames := range fileNames {
+					var imagesBytes []byte
+					imagesBytes, err = json.Marshal(postFileNames)
+					if err != nil {
+						return
+					}
+
+					_, err = tx.Exec("UPDATE posts SET images=? WHERE id=?", string(imagesBytes), postID)
+					if err != nil {
+						return
+					}
+				}
+
+				return
+			},
+			statement("DROP TABLE post_images"),
+		},
+	},
+	{
+		Version:     5,
+		Description: "add threaded replies to comments",
+		Up: statements(
+			"ALTER TABLE comments ADD parent VARCHAR(64) NOT NULL DEFAULT ''",
+			"ALTER TABLE comments ADD deleted INT NOT NULL DEFAULT 0",
+			"CREATE INDEX comments_parent ON comments (parent)",
+		),
+		// Replies become top level comments and placeholders have nothing left to show.
+		Down: []step{
+			dropIndex("comments", "comments_parent"),
+			statement("DELETE FROM comments WHERE deleted=1"),
+			statement("ALTER TABLE comments DROP COLUMN deleted"),
+			statement("ALTER TABLE comments DROP COLUMN parent"),
+		},
+	},
+	{
+		Version:     6,
+		Description: "add comment edits and the comment_revisions table",
+		Up: statements(
+			"ALTER TABLE comments ADD edited BIGINT NOT NULL DEFAULT 0",
+			`CREATE TABLE comment_revisions (
+				id {{pk}},
+				commentuuid VARCHAR(64) NOT NULL,
+				postid INT NOT NULL,
+				timestamp BIGINT NOT NULL,
+				comment TEXT NOT NULL
+			)`,
+			"CREATE INDEX comment_revisions_commentuuid ON comment_revisions (commentuuid)",
+			"CREATE INDEX comment_revisions_postid ON comment_revisions (postid)",
+		),
+		Down: statements(
+			"DROP TABLE comment_revisions",
+			"ALTER TABLE comments DROP COLUMN edited",
+		),
+	},
+	{
+		Version:     7,
+		Description: "add draft, scheduled and published post statuses",
+		// Every existing post was published when it was created.
+		Up: []step{
+			statement("ALTER TABLE posts ADD status INT NOT NULL DEFAULT 2"),
+			statement("ALTER TABLE posts ADD publish_time BIGINT NOT NULL DEFAULT 0"),
+			func(tx *sql.Tx, d dialect) error {
+				return d.exec(tx, "UPDATE posts SET publish_time="+d.unixTime("create_time"))
+			},
+			statement("CREATE INDEX posts_status ON posts (status, publish_time)"),
+		},
+		// Drafts and scheduled posts become visible once statuses are removed.
+		Down: []step{
+			dropIndex("posts", "posts_status"),
+			statement("ALTER TABLE posts DROP COLUMN publish_time"),
+			statement("ALTER TABLE posts DROP COLUMN status"),
+		},
+	},
+	{
+		Version:     8,
+		Description: "add the access_tokens table for personal access tokens",
+		Up: statements(
+			`CREATE TABLE access_tokens (
+				id {{pk}},
+				useruuid INT NOT NULL,
+				name VARCHAR(64) NOT NULL,
+				prefix VARCHAR(16) NOT NULL,
+				hash VARCHAR(64) NOT NULL,
+				scopes VARCHAR(256) NOT NULL,
+				create_time BIGINT NOT NULL,
+				last_used BIGINT NOT NULL DEFAULT 0
+			)`,
+			"CREATE UNIQUE INDEX access_tokens_hash ON access_tokens (hash)",
+			"CREATE INDEX access_tokens_useruuid ON access_tokens (useruuid)",
+		),
+		Down: statements("DROP TABLE access_tokens"),
+	},
+	{
+		Version:     9,
+		Description: "replace user privileges with roles made of permissions",
+		// The old privileges 0 to 3 become the default roles 1 to 4, which have the same permissions.
+		Up: []step{
+			statement(`CREATE TABLE roles (
+				id {{pk}},
+				name VARCHAR(64) NOT NULL
+			)`),
+			statement("CREATE UNIQUE INDEX roles_name ON roles (name)"),
+			statement(`CREATE TABLE role_permissions (
+				roleid INT NOT NULL,
+				permission VARCHAR(64) NOT NULL
+			)`),
+			statement("CREATE INDEX role_permissions_roleid ON role_permissions (roleid)"),
+			func(tx *sql.Tx, d dialect) (err error) {
+				_, err = tx.Exec("INSERT INTO roles (id, name) VALUES (1, 'No access'), (2, 'Parent'), (3, 'Moderator'), (4, 'Admin')")
+				if err != nil {
+					return
+				}
+
+				parent := []string{"panel.access", "comments.create"}
+				moderator := append(parent, "comments.edit-any", "comments.delete-any", "posts.view-unpublished", "posts.create", "posts.edit", "posts.delete")
+				admin := append(moderator, "users.manage", "roles.manage")
+
+				for role, permissions := range map[int][]string{2: parent, 3: moderator, 4: admin} {
+					for _, permission := range permissions {
+						_, err = tx.Exec("INSERT INTO role_permissions (roleid, permission) VALUES (?, ?)", role, permission)
+						if err != nil {
+							return
+						}
+					}
+				}
+
+				return
+			},
+			statement("ALTER TABLE users ADD role INT NOT NULL DEFAULT 1"),
+			statement("UPDATE users SET role = CASE WHEN priv BETWEEN 0 AND 3 THEN priv + 1 ELSE 1 END"),
+			statement("ALTER TABLE users DROP COLUMN priv"),
+		},
+		// Custom roles become the highest privilege whose powers they have.
+		Down: statements(
+			"ALTER TABLE users ADD priv INT NOT NULL DEFAULT 0",
+			`UPDATE users SET priv = CASE
+				WHEN EXISTS (SELECT 1 FROM role_permissions p WHERE p.roleid = users.role AND p.permission = 'users.manage') THEN 3
+				WHEN EXISTS (SELECT 1 FROM role_permissions p WHERE p.roleid = users.role AND p.permission = 'posts.edit') THEN 2
+				WHEN EXISTS (SELECT 1 FROM role_permissions p WHERE p.roleid = users.role AND p.permission = 'panel.access') THEN 1
+				ELSE 0 END`,
+			"ALTER TABLE users DROP COLUMN role",
+			"DROP TABLE role_permissions",
+			"DROP TABLE roles",
+		),
+	},
+	{
+		Version:     10,
+		Description: "group refresh tokens into families and record who they were issued to",
+		// Existing refresh tokens don't belong to a user or family, so they are logged out.
+		Up: statements(
+			"DELETE FROM jti",
+			"ALTER TABLE jti ADD useruuid INT NOT NULL DEFAULT 0",
+			"ALTER TABLE jti ADD family VARCHAR(64) NOT NULL DEFAULT ''",
+			"ALTER TABLE jti ADD issued_at BIGINT NOT NULL DEFAULT 0",
+			"ALTER TABLE jti ADD user_agent VARCHAR(256) NOT NULL DEFAULT ''",
+			"ALTER TABLE jti ADD rotated_at BIGINT NOT NULL DEFAULT 0",
+			"CREATE INDEX jti_family ON jti (family)",
+			"CREATE INDEX jti_useruuid ON jti (useruuid)",
+		),
+		// Rotated tokens are only kept to catch reuse, without that they would be valid again.
+		Down: []step{
+			dropIndex("jti", "jti_useruuid"),
+			dropIndex("jti", "jti_family"),
+			statement("DELETE FROM jti WHERE rotated_at<>0"),
+			statement("ALTER TABLE jti DROP COLUMN rotated_at"),
+			statement("ALTER TABLE jti DROP COLUMN user_agent"),
+			statement("ALTER TABLE jti DROP COLUMN issued_at"),
+			statement("ALTER TABLE jti DROP COLUMN family"),
+			statement("ALTER TABLE jti DROP COLUMN useruuid"),
+		},
+	},
+	{
+		Version:     11,
+		Description: "record the IP address refresh tokens were issued to",
+		Up:          statements("ALTER TABLE jti ADD ip VARCHAR(64) NOT NULL DEFAULT ''"),
+		Down:        statements("ALTER TABLE jti DROP COLUMN ip"),
+	},
+	{
+		Version:     12,
+		Description: "add token versions to users so their auth tokens can be revoked",
+		Up:          statements("ALTER TABLE users ADD token_version INT NOT NULL DEFAULT 0"),
+		Down:        statements("ALTER TABLE users DROP COLUMN token_version"),
+	},
+	{
+		Version:     13,
+		Description: "add two-factor authentication to users and a policy to require it to roles",
+		Up: statements(
+			"ALTER TABLE users ADD totp_secret VARCHAR(64) NOT NULL DEFAULT ''",
+			// totp_step is the last time step a code was used for, so codes can't be replayed.
+			"ALTER TABLE users ADD totp_step BIGINT NOT NULL DEFAULT 0",
+			`CREATE TABLE recovery_codes (
+				id {{pk}},
+				useruuid INT NOT NULL,
+				hash VARCHAR(64) NOT NULL
+			)`,
+			"CREATE INDEX recovery_codes_useruuid ON recovery_codes (useruuid, hash)",
+			"ALTER TABLE roles ADD require_two_factor INT NOT NULL DEFAULT 0",
+		),
+		Down: statements(
+			"ALTER TABLE roles DROP COLUMN require_two_factor",
+			"DROP TABLE recovery_codes",
+			"ALTER TABLE users DROP COLUMN totp_step",
+			"ALTER TABLE users DROP COLUMN totp_secret",
+		),
+	},
+	{
+		Version:     14,
+		Description: "add the passkeys table for WebAuthn logins",
+		Up: statements(
+			`CREATE TABLE passkeys (
+				id {{pk}},
+				useruuid INT NOT NULL,
+				credential_id VARCHAR(1400) NOT NULL,
+				credential_hash VARCHAR(64) NOT NULL,
+				public_key VARCHAR(1024) NOT NULL,
+				sign_count BIGINT NOT NULL DEFAULT 0,
+				name VARCHAR(64) NOT NULL,
+				create_time BIGINT NOT NULL,
+				last_used BIGINT NOT NULL DEFAULT 0
+			)`,
+			// Credential IDs can be too long to index, so they are found by their hash.
+			"CREATE UNIQUE INDEX passkeys_credential_hash ON passkeys (credential_hash)",
+			"CREATE INDEX passkeys_useruuid ON passkeys (useruuid)",
+		),
+		Down: statements("DROP TABLE passkeys"),
+	},
+	{
+		Version:     15,
+		Description: "add the login_failures table for login lockouts and let admins manage lockouts",
+		Up: statements(
+			`CREATE TABLE login_failures (
+				id {{pk}},
+				kind VARCHAR(8) NOT NULL,
+				subject VARCHAR(255) NOT NULL,
+				failures INT NOT NULL DEFAULT 0,
+				last_failure BIGINT NOT NULL DEFAULT 0,
+				locked_until BIGINT NOT NULL DEFAULT 0,
+				notified INT NOT NULL DEFAULT 0
+			)`,
+			"CREATE UNIQUE INDEX login_failures_subject ON login_failures (kind, subject)",
+			// Roles which manage roles could give themselves the permission anyway.
+			"INSERT INTO role_permissions (roleid, permission) SELECT roleid, 'lockouts.manage' FROM role_permissions WHERE permission = 'roles.manage'",
+		),
+		Down: statements(
+			"DELETE FROM role_permissions WHERE permission = 'lockouts.manage'",
+			"DROP TABLE login_failures",
+		),
+	},
+	{
+		Version:     16,
+		Description: "add registration states to users who sign up themselves",
+		Up:          statements("ALTER TABLE users ADD registration INT NOT NULL DEFAULT 0"),
+		Down:        statements("ALTER TABLE users DROP COLUMN registration"),
+	},
+	{
+		Version:     17,
+		Description: "add the invitations table for inviting users by email",
+		Up: statements(
+			`CREATE TABLE invitations (
+				id {{pk}},
+				email VARCHAR(256) NOT NULL,
+				role INT NOT NULL,
+				version INT NOT NULL DEFAULT 1,
+				invited_by INT NOT NULL,
+				create_time BIGINT NOT NULL,
+				expiry BIGINT NOT NULL
+			)`,
+		),
+		Down: statements("DROP TABLE invitations"),
+	},
+}
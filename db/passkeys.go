@@ -0,0 +1,107 @@
+package db
+
+import (
+	"database/sql"
+
+	"github.com/VolticFroogo/Bernies-Busy-Bees/models"
+)
+
+/*
+	Passkey related functions
+*/
+
+// NewPasskey stores a new passkey, hash is the hash of its credential ID which it is found by.
+func (s *sqlStore) NewPasskey(passkey models.Passkey, hash string) (id int, err error) {
+	res, err := s.db.Exec("INSERT INTO passkeys (useruuid, credential_id, credential_hash, public_key, sign_count, name, create_time) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		passkey.UserUUID, passkey.CredentialID, hash, passkey.PublicKey, passkey.SignCount, passkey.Name, passkey.CreateTime)
+	if err != nil {
+		return
+	}
+
+	lastID, err := res.LastInsertId()
+	if err != nil {
+		return
+	}
+
+	id = int(lastID)
+	return
+}
+
+// GetPasskeys returns every passkey a user has, oldest first.
+func (s *sqlStore) GetPasskeys(userUUID int) (passkeys []models.Passkey, err error) {
+	rows, err := s.db.Query("SELECT id, useruuid, credential_id, public_key, sign_count, name, create_time, last_used FROM passkeys WHERE useruuid=? ORDER BY id", userUUID)
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var passkey models.Passkey
+		passkey, err = scanPasskey(rows)
+		if err != nil {
+			return
+		}
+
+		passkeys = append(passkeys, passkey)
+	}
+
+	err = rows.Err()
+	return
+}
+
+// GetPasskeyFromHash returns the passkey with the hash of a credential ID.
+func (s *sqlStore) GetPasskeyFromHash(hash string) (passkey models.Passkey, exists bool, err error) {
+	row := s.db.QueryRow("SELECT id, useruuid, credential_id, public_key, sign_count, name, create_time, last_used FROM passkeys WHERE credential_hash=?", hash)
+
+	passkey, err = scanPasskey(row)
+	if err == sql.ErrNoRows {
+		return passkey, false, nil
+	}
+	if err != nil {
+		return
+	}
+
+	return passkey, true, nil
+}
+
+// UsePasskey records a passkey being used along with its new signature counter.
+// used is false if the counter hasn't gone up, which means the passkey may have been cloned.
+// Authenticators without a counter always send 0.
+func (s *sqlStore) UsePasskey(ID int, signCount, lastUsed int64) (used bool, err error) {
+	res, err := s.db.Exec("UPDATE passkeys SET sign_count=?, last_used=? WHERE id=? AND (sign_count<? OR (sign_count=0 AND ?=0))",
+		signCount, lastUsed, ID, signCount, signCount)
+	if err != nil {
+		return
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return
+	}
+
+	return affected != 0, nil
+}
+
+// DeletePasskey deletes one of a user's passkeys, deleted is false if they don't have it.
+func (s *sqlStore) DeletePasskey(ID, userUUID int) (deleted bool, err error) {
+	res, err := s.db.Exec("DELETE FROM passkeys WHERE id=? AND useruuid=?", ID, userUUID)
+	if err != nil {
+		return
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return
+	}
+
+	return affected != 0, nil
+}
+
+// scanPasskey scans a passkey from a row.
+func scanPasskey(row interface {
+	Scan(dest ...interface{}) error
+}) (passkey models.Passkey, err error) {
+	err = row.Scan(&passkey.ID, &passkey.UserUUID, &passkey.CredentialID, &passkey.PublicKey, &passkey.SignCount, &passkey.Name, &passkey.CreateTime, &passkey.LastUsed) // Scan data from query.
+	return
+}
@@ -0,0 +1,175 @@
+package db
+
+import (
+	"database/sql"
+
+	"github.com/VolticFroogo/Bernies-Busy-Bees/models"
+)
+
+/*
+	Role related functions
+*/
+
+// GetRoles returns every role along with its permissions.
+func (s *sqlStore) GetRoles() (roles models.Roles, err error) {
+	rows, err := s.db.Query("SELECT id, name, require_two_factor FROM roles ORDER BY id")
+	if err != nil {
+		return
+	}
+
+	for rows.Next() {
+		var role models.Role
+		err = rows.Scan(&role.ID, &role.Name, &role.RequireTwoFactor) // Scan data from query.
+		if err != nil {
+			rows.Close()
+			return
+		}
+
+		roles = append(roles, role)
+	}
+
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return
+	}
+
+	// Read the permissions once the roles have been closed, SQLite only has one connection.
+	rows, err = s.db.Query("SELECT roleid, permission FROM role_permissions ORDER BY permission")
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var roleID int
+		var permission string
+		err = rows.Scan(&roleID, &permission) // Scan data from query.
+		if err != nil {
+			return
+		}
+
+		for i := range roles {
+			if roles[i].ID == roleID {
+				roles[i].Permissions = append(roles[i].Permissions, permission)
+			}
+		}
+	}
+
+	err = rows.Err()
+	return
+}
+
+// NewRole creates a new role with some permissions.
+func (s *sqlStore) NewRole(name string, permissions []string, requireTwoFactor bool) (id int, err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+
+		err = tx.Commit()
+	}()
+
+	res, err := tx.Exec("INSERT INTO roles (name, require_two_factor) VALUES (?, ?)", name, requireTwoFactor)
+	if err != nil {
+		return
+	}
+
+	lastID, err := res.LastInsertId()
+	if err != nil {
+		return
+	}
+
+	id = int(lastID)
+	err = insertPermissions(tx, id, permissions)
+	return
+}
+
+// EditRole renames a role and replaces its permissions and two-factor policy.
+func (s *sqlStore) EditRole(ID int, name string, permissions []string, requireTwoFactor bool) (err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+
+		err = tx.Commit()
+	}()
+
+	_, err = tx.Exec("UPDATE roles SET name=?, require_two_factor=? WHERE id=?", name, requireTwoFactor, ID)
+	if err != nil {
+		return
+	}
+
+	_, err = tx.Exec("DELETE FROM role_permissions WHERE roleid=?", ID)
+	if err != nil {
+		return
+	}
+
+	err = insertPermissions(tx, ID, permissions)
+	return
+}
+
+// DeleteRole deletes a role, inUse is true and nothing is deleted if any users or invitations still have it.
+func (s *sqlStore) DeleteRole(ID int) (inUse bool, err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+
+		err = tx.Commit()
+	}()
+
+	var users, invitations int
+	err = tx.QueryRow("SELECT COUNT(*) FROM users WHERE role=?", ID).Scan(&users)
+	if err != nil {
+		return
+	}
+
+	err = tx.QueryRow("SELECT COUNT(*) FROM invitations WHERE role=?", ID).Scan(&invitations)
+	if err != nil {
+		return
+	}
+
+	if users != 0 || invitations != 0 {
+		return true, nil
+	}
+
+	_, err = tx.Exec("DELETE FROM role_permissions WHERE roleid=?", ID)
+	if err != nil {
+		return
+	}
+
+	_, err = tx.Exec("DELETE FROM roles WHERE id=?", ID)
+	return
+}
+
+// insertPermissions gives a role some permissions.
+func insertPermissions(tx *sql.Tx, roleID int, permissions []string) (err error) {
+	for _, permission := range permissions {
+		_, err = tx.Exec("INSERT INTO role_permissions (roleid, permission) VALUES (?, ?)", roleID, permission)
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
@@ -0,0 +1,700 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/VolticFroogo/Bernies-Busy-Bees/helpers"
+	"github.com/VolticFroogo/Bernies-Busy-Bees/models"
+	_ "github.com/go-sql-driver/mysql" // Necessary for connecting to MySQL.
+	_ "github.com/mattn/go-sqlite3"    // Necessary for connecting to SQLite.
+)
+
+/*
+	Structs and variables
+*/
+
+// Database types supported by Open.
+const (
+	TypeMySQL  = "mysql"
+	TypeSQLite = "sqlite3"
+)
+
+// sqlStore is a Store backed by a SQL database.
+type sqlStore struct {
+	db      *sql.DB
+	dialect dialect
+}
+
+// Open opens a Store of the specified database type.
+func Open(dbType, connString string) (Store, error) {
+	switch dbType {
+	case TypeMySQL:
+		return NewMySQL(connString)
+
+	case TypeSQLite:
+		return NewSQLite(connString)
+
+	default:
+		return nil, fmt.Errorf("unknown database type: %v", dbType)
+	}
+}
+
+// NewMySQL opens a Store backed by a MySQL server.
+func NewMySQL(connString string) (Store, error) {
+	db, err := sql.Open(TypeMySQL, connString)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sqlStore{db: db, dialect: mysqlDialect}, nil
+}
+
+// NewSQLite opens a Store backed by an embedded SQLite database.
+// Use ":memory:" as the path for a database which only lives as long as the process.
+func NewSQLite(path string) (Store, error) {
+	db, err := sql.Open(TypeSQLite, path)
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite only allows one writer, and every connection to ":memory:" is a new database.
+	db.SetMaxOpenConns(1)
+
+	return &sqlStore{db: db, dialect: sqliteDialect}, nil
+}
+
+// Close closes the underlying database.
+func (s *sqlStore) Close() error {
+	return s.db.Close()
+}
+
+/*
+	Helper functions
+*/
+
+func (s *sqlStore) rowExists(query string, args ...interface{}) (exists bool, err error) {
+	query = fmt.Sprintf("SELECT exists (%s)", query)
+	err = s.db.QueryRow(query, args...).Scan(&exists)
+	return
+}
+
+/*
+	JTI related functions
+*/
+
+// StoreRefreshToken generates, stores and then returns a JTI in a family of refresh tokens.
+func (s *sqlStore) StoreRefreshToken(userUUID int, family, userAgent, ip string) (jti models.JTI, err error) {
+	// No need to duplication check as the JTI takes input from time and are unique.
+	jti.JTI, err = helpers.GenerateRandomString(32)
+	if err != nil {
+		return
+	}
+
+	jti.UserUUID = userUUID
+	jti.Family = family
+	jti.UserAgent = userAgent
+	jti.IP = ip
+	jti.IssuedAt = time.Now().Unix()
+	jti.Expiry = time.Now().Add(models.RefreshTokenValidTime).Unix()
+
+	_, err = s.db.Exec("INSERT INTO jti (jti, expiry, useruuid, family, issued_at, user_agent, ip) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		jti.JTI, jti.Expiry, jti.UserUUID, jti.Family, jti.IssuedAt, jti.UserAgent, jti.IP)
+	if err != nil {
+		return
+	}
+
+	err = s.db.QueryRow("SELECT id FROM jti WHERE jti=? AND expiry=?", jti.JTI, jti.Expiry).Scan(&jti.ID) // Scan data from query.
+	return
+}
+
+// GetJTI takes a JTI string and returns the JTI struct.
+func (s *sqlStore) GetJTI(jti string) (jtiStruct models.JTI, err error) {
+	jtiStruct.JTI = jti
+	err = s.db.QueryRow("SELECT id, expiry, useruuid, family, issued_at, user_agent, ip, rotated_at FROM jti WHERE jti=?", jti).Scan(
+		&jtiStruct.ID, &jtiStruct.Expiry, &jtiStruct.UserUUID, &jtiStruct.Family, &jtiStruct.IssuedAt, &jtiStruct.UserAgent, &jtiStruct.IP, &jtiStruct.RotatedAt) // Scan data from query.
+	return
+}
+
+// DeleteJTIFromID deletes a JTI based on its ID.
+func (s *sqlStore) DeleteJTIFromID(id int) (err error) {
+	_, err = s.db.Exec("DELETE FROM jti WHERE id=?", id)
+	return
+}
+
+// RotateJTI marks a JTI as rotated, rotated is false if it already had been.
+func (s *sqlStore) RotateJTI(id int, now int64) (rotated bool, err error) {
+	res, err := s.db.Exec("UPDATE jti SET rotated_at=? WHERE id=? AND rotated_at=0", now, id)
+	if err != nil {
+		return
+	}
+
+	rows, err := res.RowsAffected()
+	rotated = rows == 1
+	return
+}
+
+// DeleteJTIFamily deletes every JTI in a family.
+func (s *sqlStore) DeleteJTIFamily(family string) (err error) {
+	_, err = s.db.Exec("DELETE FROM jti WHERE family=?", family)
+	return
+}
+
+// GetSessions returns every session a user is logged in with, most recently seen first.
+// Each family's newest refresh token says where and when the session was last seen.
+func (s *sqlStore) GetSessions(userUUID int, now int64) (sessions []models.Session, err error) {
+	rows, err := s.db.Query("SELECT family, user_agent, ip, issued_at FROM jti WHERE useruuid=? AND expiry>? ORDER BY issued_at DESC, id DESC", userUUID, now)
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	seen := map[string]bool{}
+	for rows.Next() {
+		var session models.Session
+		err = rows.Scan(&session.Family, &session.UserAgent, &session.IP, &session.LastSeen) // Scan data from query.
+		if err != nil {
+			return
+		}
+
+		if seen[session.Family] {
+			continue
+		}
+
+		seen[session.Family] = true
+		sessions = append(sessions, session)
+	}
+
+	err = rows.Err()
+	return
+}
+
+// DeleteSession deletes one of a user's sessions, deleted is false if they don't have it.
+func (s *sqlStore) DeleteSession(family string, userUUID int) (deleted bool, err error) {
+	res, err := s.db.Exec("DELETE FROM jti WHERE family=? AND useruuid=?", family, userUUID)
+	if err != nil {
+		return
+	}
+
+	rows, err := res.RowsAffected()
+	deleted = rows != 0
+	return
+}
+
+// DeleteSessions deletes every session a user has.
+func (s *sqlStore) DeleteSessions(userUUID int) (err error) {
+	_, err = s.db.Exec("DELETE FROM jti WHERE useruuid=?", userUUID)
+	return
+}
+
+// DeleteExpiredJTIs deletes every JTI which expired before now.
+func (s *sqlStore) DeleteExpiredJTIs(now int64) (err error) {
+	_, err = s.db.Exec("DELETE FROM jti WHERE expiry<=?", now)
+	return
+}
+
+/*
+	User related functions
+*/
+
+// GetUserFromID retrieves a user from the database.
+func (s *sqlStore) GetUserFromID(uuid int) (user models.User, err error) {
+	rows, err := s.db.Query("SELECT email, password, fname, lname, role, create_time, totp_secret<>'', EXISTS (SELECT id FROM passkeys WHERE passkeys.useruuid=users.uuid), registration FROM users WHERE uuid=?", uuid)
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	user.UUID = uuid
+	for rows.Next() {
+		err = rows.Scan(&user.Email, &user.Password, &user.Fname, &user.Lname, &user.Role.ID, &user.CreateTime, &user.TwoFactor, &user.Passkeys, &user.Registration) // Scan data from query.
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// GetUserFromEmail retrieves a user's ID from the database.
+func (s *sqlStore) GetUserFromEmail(email string) (user models.User, err error) {
+	rows, err := s.db.Query("SELECT uuid, password, fname, lname, role, create_time, totp_secret<>'', EXISTS (SELECT id FROM passkeys WHERE passkeys.useruuid=users.uuid), registration FROM users WHERE email=?", email)
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	user.Email = email
+	for rows.Next() {
+		err = rows.Scan(&user.UUID, &user.Password, &user.Fname, &user.Lname, &user.Role.ID, &user.CreateTime, &user.TwoFactor, &user.Passkeys, &user.Registration) // Scan data from query.
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// GetUsers returns every user.
+func (s *sqlStore) GetUsers() (users models.Users, err error) {
+	rows, err := s.db.Query("SELECT uuid, email, fname, lname, password, role, create_time, totp_secret<>'', EXISTS (SELECT id FROM passkeys WHERE passkeys.useruuid=users.uuid), registration FROM users")
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	users = models.Users{} // Create struct to store users in.
+	user := models.User{}  // Create struct to store a user in.
+	for rows.Next() {
+		err = rows.Scan(&user.UUID, &user.Email, &user.Fname, &user.Lname, &user.Password, &user.Role.ID, &user.CreateTime, &user.TwoFactor, &user.Passkeys, &user.Registration) // Scan data from query.
+		if err != nil {
+			return
+		}
+
+		users = append(users, user) // Append just read user into the users.
+	}
+
+	return
+}
+
+// EditUser updates a user.
+func (s *sqlStore) EditUser(ID int, Email, Password, Fname, Lname string, Role int) (err error) {
+	_, err = s.db.Exec("UPDATE users SET email=?, password=?, fname=?, lname=?, role=? WHERE uuid=?", Email, Password, Fname, Lname, Role, ID)
+	return
+}
+
+// EditUserNoPassword updates a user without changing the password.
+func (s *sqlStore) EditUserNoPassword(ID int, Email, Fname, Lname string, Role int) (err error) {
+	_, err = s.db.Exec("UPDATE users SET email=?, fname=?, lname=?, role=? WHERE uuid=?", Email, Fname, Lname, Role, ID)
+	return
+}
+
+// EditSelf updates a user from settings.
+func (s *sqlStore) EditSelf(ID int, Password, Fname, Lname string) (err error) {
+	_, err = s.db.Exec("UPDATE users SET password=?, fname=?, lname=? WHERE uuid=?", Password, Fname, Lname, ID)
+	return
+}
+
+// EditSelfNoPassword updates a user from settings without changing the password.
+func (s *sqlStore) EditSelfNoPassword(ID int, Fname, Lname string) (err error) {
+	_, err = s.db.Exec("UPDATE users SET fname=?, lname=? WHERE uuid=?", Fname, Lname, ID)
+	return
+}
+
+// EditSelfEmail updates a user's email after verification.
+func (s *sqlStore) EditSelfEmail(uuid int, email string) (err error) {
+	_, err = s.db.Exec("UPDATE users SET email=? WHERE uuid=?", email, uuid)
+	return
+}
+
+// EditPassword updates a user's password after password recovery.
+func (s *sqlStore) EditPassword(uuid int, password string) (err error) {
+	_, err = s.db.Exec("UPDATE users SET password=? WHERE uuid=?", password, uuid)
+	return
+}
+
+// NewUser creates a new user.
+func (s *sqlStore) NewUser(Email, Password, Fname, Lname string, Role int) (id int, err error) {
+	_, err = s.db.Exec("INSERT INTO users (email, password, fname, lname, role) VALUES (?, ?, ?, ?, ?)", Email, Password, Fname, Lname, Role)
+	if err != nil {
+		return
+	}
+
+	err = s.db.QueryRow("SELECT uuid FROM users WHERE email=? AND password=? AND fname=? AND lname=? AND role=? ORDER BY uuid DESC", Email, Password, Fname, Lname, Role).Scan(&id)
+	return
+}
+
+// NewRegistration creates a user who signed up themselves, who has no access until they are approved.
+func (s *sqlStore) NewRegistration(Email, Password, Fname, Lname string) (id int, err error) {
+	res, err := s.db.Exec("INSERT INTO users (email, password, fname, lname, role, registration) VALUES (?, ?, ?, ?, ?, ?)",
+		Email, Password, Fname, Lname, models.RoleNone, models.RegistrationUnverified)
+	if err != nil {
+		return
+	}
+
+	lastID, err := res.LastInsertId()
+	if err != nil {
+		return
+	}
+
+	id = int(lastID)
+	return
+}
+
+// RenewRegistration replaces the details of a user who hasn't verified their email with those of a new sign up,
+// deleting their email verification codes. renewed is false if they aren't unverified.
+func (s *sqlStore) RenewRegistration(uuid int, Password, Fname, Lname string) (renewed bool, err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return
+	}
+
+	defer func() {
+		if err != nil || !renewed {
+			tx.Rollback()
+			return
+		}
+
+		err = tx.Commit()
+	}()
+
+	res, err := tx.Exec("UPDATE users SET password=?, fname=?, lname=? WHERE uuid=? AND registration=?", Password, Fname, Lname, uuid, models.RegistrationUnverified)
+	if err != nil {
+		return
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil || affected == 0 {
+		return
+	}
+
+	// Links sent for the old details mustn't verify the new ones.
+	_, err = tx.Exec("DELETE FROM email WHERE useruuid=?", uuid)
+	if err != nil {
+		return
+	}
+
+	renewed = true
+	return
+}
+
+// EditRegistration moves a user from one registration state to another, edited is false if they weren't in it.
+func (s *sqlStore) EditRegistration(uuid, from, to int) (edited bool, err error) {
+	res, err := s.db.Exec("UPDATE users SET registration=? WHERE uuid=? AND registration=?", to, uuid, from)
+	if err != nil {
+		return
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return
+	}
+
+	return affected != 0, nil
+}
+
+// ApproveRegistration gives a user waiting for approval a role which exists, returning the approved user.
+// approved is false if they weren't waiting or the role doesn't exist.
+func (s *sqlStore) ApproveRegistration(uuid, role int) (user models.User, approved bool, err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return
+	}
+
+	defer func() {
+		if err != nil || !approved {
+			tx.Rollback()
+			return
+		}
+
+		err = tx.Commit()
+	}()
+
+	// Only one request can move the user out of the queue, so they can't be approved twice at once.
+	res, err := tx.Exec("UPDATE users SET role=?, registration=? WHERE uuid=? AND registration=? AND EXISTS (SELECT id FROM roles WHERE id=?)",
+		role, models.RegistrationNone, uuid, models.RegistrationPending, role)
+	if err != nil {
+		return
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil || affected == 0 {
+		return
+	}
+
+	user = models.User{UUID: uuid}
+	user.Role.ID = role
+	err = tx.QueryRow("SELECT email, fname, lname FROM users WHERE uuid=?", uuid).Scan(&user.Email, &user.Fname, &user.Lname) // Scan data from query.
+	if err != nil {
+		return
+	}
+
+	approved = true
+	return
+}
+
+// DeleteUser deletes a user along with their access tokens.
+func (s *sqlStore) DeleteUser(ID int) (err error) {
+	_, err = s.db.Exec("DELETE FROM email WHERE useruuid=?", ID)
+	if err != nil {
+		return
+	}
+
+	_, err = s.db.Exec("DELETE FROM access_tokens WHERE useruuid=?", ID)
+	if err != nil {
+		return
+	}
+
+	_, err = s.db.Exec("DELETE FROM recovery_codes WHERE useruuid=?", ID)
+	if err != nil {
+		return
+	}
+
+	_, err = s.db.Exec("DELETE FROM passkeys WHERE useruuid=?", ID)
+	if err != nil {
+		return
+	}
+
+	_, err = s.db.Exec("DELETE FROM users WHERE uuid=?", ID)
+	return
+}
+
+// GetTokenVersion returns the version a user's auth tokens must have, exists is false if there is no user.
+func (s *sqlStore) GetTokenVersion(uuid int) (version int, exists bool, err error) {
+	err = s.db.QueryRow("SELECT token_version FROM users WHERE uuid=?", uuid).Scan(&version) // Scan data from query.
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+
+	return version, err == nil, err
+}
+
+// BumpTokenVersion changes a user's token version so none of their auth tokens work.
+func (s *sqlStore) BumpTokenVersion(uuid int) (err error) {
+	_, err = s.db.Exec("UPDATE users SET token_version=token_version+1 WHERE uuid=?", uuid)
+	return
+}
+
+// BumpRoleTokenVersions changes the token version of every user with a role.
+func (s *sqlStore) BumpRoleTokenVersions(roleID int) (err error) {
+	_, err = s.db.Exec("UPDATE users SET token_version=token_version+1 WHERE role=?", roleID)
+	return
+}
+
+/*
+	Post related functions
+*/
+
+// GetPosts returns a specified amount of posts, newest first.
+// Drafts and scheduled posts are only included if includeUnpublished is set.
+func (s *sqlStore) GetPosts(amount, perPage, page int, includeUnpublished bool) (posts models.Posts, err error) {
+	query := "SELECT id, status, publish_time, title, description, create_time FROM posts WHERE status=? ORDER BY publish_time DESC, id DESC LIMIT ?,?"
+	args := []interface{}{models.PostPublished, perPage * (page - 1), amount}
+	if includeUnpublished {
+		query = "SELECT id, status, publish_time, title, description, create_time FROM posts ORDER BY id DESC LIMIT ?,?"
+		args = args[1:]
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return
+	}
+
+	var ids []int
+	post := models.Post{} // Create struct to store a post in.
+	for rows.Next() {
+		err = rows.Scan(&post.ID, &post.Status, &post.PublishTime, &post.Title, &post.Description, &post.CreateTime) // Scan data from query.
+		if err != nil {
+			rows.Close()
+			return
+		}
+
+		posts = append(posts, post) // Append just read post into the posts.
+		ids = append(ids, post.ID)
+	}
+
+	rows.Close()
+	err = rows.Err()
+	if err != nil {
+		return
+	}
+
+	images, err := s.getImages(ids...)
+	if err != nil {
+		return
+	}
+
+	for i := range posts {
+		posts[i].Images = images[posts[i].ID]
+	}
+
+	return
+}
+
+// GetPost returns a post with a specified ID, its images and its comments.
+func (s *sqlStore) GetPost(id int) (post models.Post, exists bool, err error) {
+	post.ID = id
+	err = s.db.QueryRow("SELECT status, publish_time, title, description, create_time FROM posts WHERE id=?", id).Scan(&post.Status, &post.PublishTime, &post.Title, &post.Description, &post.CreateTime) // Scan data from query.
+	if err == sql.ErrNoRows {
+		return post, false, nil
+	}
+	if err != nil {
+		return
+	}
+
+	exists = true
+
+	images, err := s.getImages(id)
+	if err != nil {
+		return
+	}
+
+	post.Images = images[id]
+	post.Comments, err = s.getComments(id)
+	return
+}
+
+// NewPost creates a new post with its images in order.
+func (s *sqlStore) NewPost(title, description string, images []models.Image, status int, publishTime int64) (id int, err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+
+		err = tx.Commit()
+	}()
+
+	res, err := tx.Exec("INSERT INTO posts (title, description, status, publish_time) VALUES (?, ?, ?, ?)", title, description, status, publishTime)
+	if err != nil {
+		return
+	}
+
+	lastID, err := res.LastInsertId()
+	if err != nil {
+		return
+	}
+
+	id = int(lastID)
+	for i, image := range images {
+		_, err = tx.Exec("INSERT INTO post_images (postid, position, s3key, filename, contenttype, size, width, height, caption) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			id, i, image.Key, image.Filename, image.ContentType, image.Size, image.Width, image.Height, image.Caption)
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// EditPost updates a post.
+func (s *sqlStore) EditPost(ID int, Title, Description string) (err error) {
+	_, err = s.db.Exec("UPDATE posts SET title=?, description=? WHERE id=?", Title, Description, ID)
+	return
+}
+
+// EditPostStatus changes whether a post is a draft, scheduled or published.
+func (s *sqlStore) EditPostStatus(ID, status int, publishTime int64) (err error) {
+	_, err = s.db.Exec("UPDATE posts SET status=?, publish_time=? WHERE id=?", status, publishTime, ID)
+	return
+}
+
+// PublishScheduledPosts publishes every scheduled post whose publish time has passed.
+func (s *sqlStore) PublishScheduledPosts(now int64) (published int64, err error) {
+	res, err := s.db.Exec("UPDATE posts SET status=? WHERE status=? AND publish_time<=?", models.PostPublished, models.PostScheduled, now)
+	if err != nil {
+		return
+	}
+
+	return res.RowsAffected()
+}
+
+// DeletePost deletes a post and returns all of the images.
+func (s *sqlStore) DeletePost(ID int) (images []models.Image, err error) {
+	postImages, err := s.getImages(ID)
+	if err != nil {
+		return
+	}
+
+	images = postImages[ID]
+
+	_, err = s.db.Exec("DELETE FROM post_images WHERE postid=?", ID)
+	if err != nil {
+		return
+	}
+
+	_, err = s.db.Exec("DELETE FROM comment_revisions WHERE postid=?", ID)
+	if err != nil {
+		return
+	}
+
+	_, err = s.db.Exec("DELETE FROM comments WHERE postid=?", ID)
+	if err != nil {
+		return
+	}
+
+	_, err = s.db.Exec("DELETE FROM posts WHERE id=?", ID)
+	return
+}
+
+/*
+	Email verification and recovery related functions
+*/
+
+// AddEmailVerification adds an email verification code to the DB.
+func (s *sqlStore) AddEmailVerification(id string, userUUID int, email string) (err error) {
+	exists, err := s.rowExists("SELECT id FROM email WHERE useruuid=?", userUUID)
+	if err != nil {
+		return
+	}
+	if exists {
+		_, err = s.db.Exec("DELETE FROM email WHERE useruuid=?", userUUID)
+		if err != nil {
+			return
+		}
+	}
+
+	_, err = s.db.Exec("INSERT INTO email (uuid, useruuid, email) VALUES (?, ?, ?)", id, userUUID, email)
+	return
+}
+
+// GetEmailVerification retrieves an email verification information.
+func (s *sqlStore) GetEmailVerification(id string) (userUUID int, email string, err error) {
+	err = s.db.QueryRow("SELECT useruuid, email FROM email WHERE uuid=?", id).Scan(&userUUID, &email)
+	if err == sql.ErrNoRows {
+		return 0, "", nil // Unknown and used codes aren't errors.
+	}
+	if err != nil {
+		return
+	}
+
+	if userUUID != 0 && email != "" {
+		_, err = s.db.Exec("DELETE FROM email WHERE uuid=?", id)
+	}
+
+	return
+}
+
+// AddRecovery adds a password recovery code to the DB.
+func (s *sqlStore) AddRecovery(id string, userUUID int, email string) (err error) {
+	exists, err := s.rowExists("SELECT id FROM recovery WHERE useruuid=?", userUUID)
+	if err != nil {
+		return
+	}
+	if exists {
+		_, err = s.db.Exec("DELETE FROM recovery WHERE useruuid=?", userUUID)
+		if err != nil {
+			return
+		}
+	}
+
+	_, err = s.db.Exec("INSERT INTO recovery (uuid, useruuid, email) VALUES (?, ?, ?)", id, userUUID, email)
+	return
+}
+
+// GetRecovery retrieves a password recovery code from the DB.
+func (s *sqlStore) GetRecovery(id string) (userUUID int, email string, err error) {
+	err = s.db.QueryRow("SELECT useruuid, email FROM recovery WHERE uuid=?", id).Scan(&userUUID, &email)
+	if err == sql.ErrNoRows {
+		return 0, "", nil // Unknown and used codes aren't errors.
+	}
+	if err != nil {
+		return
+	}
+
+	if userUUID != 0 && email != "" {
+		_, err = s.db.Exec("DELETE FROM recovery WHERE uuid=?", id)
+	}
+
+	return
+}
@@ -0,0 +1,120 @@
+package db
+
+import (
+	"github.com/VolticFroogo/Bernies-Busy-Bees/models"
+)
+
+// Store is the storage backend used by the db package.
+type Store interface {
+	// Migrations
+	MigrateUp() (err error)
+	MigrateDown() (err error)
+	MigrationStatus() (status models.Migrations, err error)
+
+	// JTIs
+	StoreRefreshToken(userUUID int, family, userAgent, ip string) (jti models.JTI, err error)
+	GetJTI(jti string) (jtiStruct models.JTI, err error)
+	DeleteJTIFromID(id int) (err error)
+	RotateJTI(id int, now int64) (rotated bool, err error)
+	DeleteJTIFamily(family string) (err error)
+	GetSessions(userUUID int, now int64) (sessions []models.Session, err error)
+	DeleteSession(family string, userUUID int) (deleted bool, err error)
+	DeleteSessions(userUUID int) (err error)
+	DeleteExpiredJTIs(now int64) (err error)
+
+	// Users
+	GetUserFromID(uuid int) (user models.User, err error)
+	GetUserFromEmail(email string) (user models.User, err error)
+	GetUsers() (users models.Users, err error)
+	EditUser(ID int, Email, Password, Fname, Lname string, Role int) (err error)
+	EditUserNoPassword(ID int, Email, Fname, Lname string, Role int) (err error)
+	EditSelf(ID int, Password, Fname, Lname string) (err error)
+	EditSelfNoPassword(ID int, Fname, Lname string) (err error)
+	EditSelfEmail(uuid int, email string) (err error)
+	EditPassword(uuid int, password string) (err error)
+	NewUser(Email, Password, Fname, Lname string, Role int) (id int, err error)
+	DeleteUser(ID int) (err error)
+	NewRegistration(Email, Password, Fname, Lname string) (id int, err error)
+	RenewRegistration(uuid int, Password, Fname, Lname string) (renewed bool, err error)
+	EditRegistration(uuid, from, to int) (edited bool, err error)
+	ApproveRegistration(uuid, role int) (user models.User, approved bool, err error)
+	GetTokenVersion(uuid int) (version int, exists bool, err error)
+	BumpTokenVersion(uuid int) (err error)
+	BumpRoleTokenVersions(roleID int) (err error)
+
+	// Two-factor authentication
+	GetTwoFactor(uuid int) (secret string, lastStep int64, err error)
+	EnableTwoFactor(uuid int, secret string, step int64, recoveryCodeHashes []string) (err error)
+	DisableTwoFactor(uuid int) (err error)
+	UseTOTPStep(uuid int, step int64) (used bool, err error)
+	UseRecoveryCode(uuid int, hash string) (used bool, err error)
+	ReplaceRecoveryCodes(uuid int, recoveryCodeHashes []string) (err error)
+	CountRecoveryCodes(uuid int) (count int, err error)
+
+	// Roles
+	GetRoles() (roles models.Roles, err error)
+	NewRole(name string, permissions []string, requireTwoFactor bool) (id int, err error)
+	EditRole(ID int, name string, permissions []string, requireTwoFactor bool) (err error)
+	DeleteRole(ID int) (inUse bool, err error)
+
+	// Access tokens
+	NewAccessToken(token models.AccessToken, hash string) (id int, err error)
+	GetAccessTokens(userUUID int) (tokens []models.AccessToken, err error)
+	GetAccessTokenFromHash(hash string) (token models.AccessToken, exists bool, err error)
+	UseAccessToken(ID int, lastUsed int64) (err error)
+	DeleteAccessToken(ID, userUUID int) (deleted bool, err error)
+
+	// Passkeys
+	NewPasskey(passkey models.Passkey, hash string) (id int, err error)
+	GetPasskeys(userUUID int) (passkeys []models.Passkey, err error)
+	GetPasskeyFromHash(hash string) (passkey models.Passkey, exists bool, err error)
+	UsePasskey(ID int, signCount, lastUsed int64) (used bool, err error)
+	DeletePasskey(ID, userUUID int) (deleted bool, err error)
+
+	// Login failures
+	AddLoginFailure(kind, subject string, now, resetBefore int64) (failures int, err error)
+	LockLogin(kind, subject string, lockedUntil int64) (err error)
+	GetLockedUntil(kind, subject string) (lockedUntil int64, err error)
+	MarkLoginFailureNotified(kind, subject string) (marked bool, err error)
+	GetLoginFailures(since int64) (failures []models.LoginFailure, err error)
+	ClearLoginFailures(kind, subject string) (err error)
+	DeleteLoginFailure(ID int) (deleted bool, err error)
+	DeleteOldLoginFailures(before, now int64) (err error)
+
+	// Invitations
+	NewInvitation(email string, role, invitedBy int, now, expiry int64) (id int, err error)
+	GetInvitation(ID int) (invitation models.Invitation, err error)
+	GetInvitations() (invitations []models.Invitation, err error)
+	ResendInvitation(ID int, expiry int64) (resent bool, err error)
+	DeleteInvitation(ID int) (deleted bool, err error)
+	AcceptInvitation(ID, version int, now int64, Password, Fname, Lname string) (uuid int, accepted bool, err error)
+
+	// Posts
+	GetPosts(amount, perPage, page int, includeUnpublished bool) (posts models.Posts, err error)
+	GetPost(id int) (post models.Post, exists bool, err error)
+	NewPost(title, description string, images []models.Image, status int, publishTime int64) (id int, err error)
+	EditPost(ID int, Title, Description string) (err error)
+	EditPostStatus(ID, status int, publishTime int64) (err error)
+	PublishScheduledPosts(now int64) (published int64, err error)
+	DeletePost(ID int) (images []models.Image, err error)
+
+	// Images
+	EditImage(ID, Position int, Caption string) (err error)
+
+	// Comments
+	AddCommentPost(comment models.NewComment) (id string, err error)
+	EditCommentPost(commentID string, postID int, comment string, timestamp int64) (err error)
+	EditCommentPostIfOwner(commentID string, postID, userUUID int, comment string, timestamp int64) (owner bool, err error)
+	DeleteCommentPost(commentID string, postID int) (err error)
+	DeleteCommentPostIfOwner(commentID string, postID, userUUID int) (owner bool, err error)
+
+	// Email verifications
+	AddEmailVerification(id string, userUUID int, email string) (err error)
+	GetEmailVerification(id string) (userUUID int, email string, err error)
+
+	// Recoveries
+	AddRecovery(id string, userUUID int, email string) (err error)
+	GetRecovery(id string) (userUUID int, email string, err error)
+
+	Close() error
+}
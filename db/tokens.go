@@ -0,0 +1,102 @@
+package db
+
+import (
+	"database/sql"
+	"strings"
+
+	"github.com/VolticFroogo/Bernies-Busy-Bees/models"
+)
+
+/*
+	Access token related functions
+*/
+
+// NewAccessToken stores a new personal access token by its hash.
+func (s *sqlStore) NewAccessToken(token models.AccessToken, hash string) (id int, err error) {
+	res, err := s.db.Exec("INSERT INTO access_tokens (useruuid, name, prefix, hash, scopes, create_time) VALUES (?, ?, ?, ?, ?, ?)",
+		token.UserUUID, token.Name, token.Prefix, hash, strings.Join(token.Scopes, " "), token.CreateTime)
+	if err != nil {
+		return
+	}
+
+	lastID, err := res.LastInsertId()
+	if err != nil {
+		return
+	}
+
+	id = int(lastID)
+	return
+}
+
+// GetAccessTokens returns every access token a user has, newest first.
+func (s *sqlStore) GetAccessTokens(userUUID int) (tokens []models.AccessToken, err error) {
+	rows, err := s.db.Query("SELECT id, useruuid, name, prefix, scopes, create_time, last_used FROM access_tokens WHERE useruuid=? ORDER BY id DESC", userUUID)
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var token models.AccessToken
+		token, err = scanAccessToken(rows)
+		if err != nil {
+			return
+		}
+
+		tokens = append(tokens, token)
+	}
+
+	err = rows.Err()
+	return
+}
+
+// GetAccessTokenFromHash returns the access token with a hash.
+func (s *sqlStore) GetAccessTokenFromHash(hash string) (token models.AccessToken, exists bool, err error) {
+	row := s.db.QueryRow("SELECT id, useruuid, name, prefix, scopes, create_time, last_used FROM access_tokens WHERE hash=?", hash)
+
+	token, err = scanAccessToken(row)
+	if err == sql.ErrNoRows {
+		return token, false, nil
+	}
+	if err != nil {
+		return
+	}
+
+	return token, true, nil
+}
+
+// UseAccessToken records when an access token was last used.
+func (s *sqlStore) UseAccessToken(ID int, lastUsed int64) (err error) {
+	_, err = s.db.Exec("UPDATE access_tokens SET last_used=? WHERE id=?", lastUsed, ID)
+	return
+}
+
+// DeleteAccessToken deletes one of a user's access tokens, deleted is false if they don't have it.
+func (s *sqlStore) DeleteAccessToken(ID, userUUID int) (deleted bool, err error) {
+	res, err := s.db.Exec("DELETE FROM access_tokens WHERE id=? AND useruuid=?", ID, userUUID)
+	if err != nil {
+		return
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return
+	}
+
+	return affected != 0, nil
+}
+
+// scanAccessToken scans an access token from a row.
+func scanAccessToken(row interface {
+	Scan(dest ...interface{}) error
+}) (token models.AccessToken, err error) {
+	var scopes string
+	err = row.Scan(&token.ID, &token.UserUUID, &token.Name, &token.Prefix, &scopes, &token.CreateTime, &token.LastUsed) // Scan data from query.
+	if err != nil {
+		return
+	}
+
+	token.Scopes = strings.Fields(scopes)
+	return
+}
@@ -0,0 +1,147 @@
+package db
+
+import (
+	"database/sql"
+)
+
+/*
+	Two-factor authentication related functions
+*/
+
+// GetTwoFactor returns a user's TOTP secret, which is empty if they don't use two-factor authentication,
+// along with the last time step a code was used for.
+func (s *sqlStore) GetTwoFactor(uuid int) (secret string, lastStep int64, err error) {
+	err = s.db.QueryRow("SELECT totp_secret, totp_step FROM users WHERE uuid=?", uuid).Scan(&secret, &lastStep) // Scan data from query.
+	if err == sql.ErrNoRows {
+		return "", 0, nil
+	}
+
+	return
+}
+
+// EnableTwoFactor gives a user a TOTP secret and replaces their recovery codes.
+// step is the time step of the code they confirmed the secret with, so it can't be used again.
+func (s *sqlStore) EnableTwoFactor(uuid int, secret string, step int64, recoveryCodeHashes []string) (err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+
+		err = tx.Commit()
+	}()
+
+	_, err = tx.Exec("UPDATE users SET totp_secret=?, totp_step=? WHERE uuid=?", secret, step, uuid)
+	if err != nil {
+		return
+	}
+
+	err = replaceRecoveryCodes(tx, uuid, recoveryCodeHashes)
+	return
+}
+
+// DisableTwoFactor removes a user's TOTP secret and recovery codes.
+func (s *sqlStore) DisableTwoFactor(uuid int) (err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+
+		err = tx.Commit()
+	}()
+
+	_, err = tx.Exec("UPDATE users SET totp_secret='', totp_step=0 WHERE uuid=?", uuid)
+	if err != nil {
+		return
+	}
+
+	err = replaceRecoveryCodes(tx, uuid, nil)
+	return
+}
+
+// UseTOTPStep records a code being used for a time step.
+// used is false if a code for the same or a later step has already been used, so the code is a replay.
+func (s *sqlStore) UseTOTPStep(uuid int, step int64) (used bool, err error) {
+	res, err := s.db.Exec("UPDATE users SET totp_step=? WHERE uuid=? AND totp_step<?", step, uuid, step)
+	if err != nil {
+		return
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return
+	}
+
+	used = affected != 0
+	return
+}
+
+// UseRecoveryCode deletes a user's recovery code, used is false if they didn't have it.
+func (s *sqlStore) UseRecoveryCode(uuid int, hash string) (used bool, err error) {
+	res, err := s.db.Exec("DELETE FROM recovery_codes WHERE useruuid=? AND hash=?", uuid, hash)
+	if err != nil {
+		return
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return
+	}
+
+	used = affected != 0
+	return
+}
+
+// ReplaceRecoveryCodes replaces every recovery code a user has.
+func (s *sqlStore) ReplaceRecoveryCodes(uuid int, recoveryCodeHashes []string) (err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+
+		err = tx.Commit()
+	}()
+
+	err = replaceRecoveryCodes(tx, uuid, recoveryCodeHashes)
+	return
+}
+
+// CountRecoveryCodes returns how many unused recovery codes a user has.
+func (s *sqlStore) CountRecoveryCodes(uuid int) (count int, err error) {
+	err = s.db.QueryRow("SELECT COUNT(*) FROM recovery_codes WHERE useruuid=?", uuid).Scan(&count) // Scan data from query.
+	return
+}
+
+// replaceRecoveryCodes deletes a user's recovery codes and stores new ones.
+func replaceRecoveryCodes(tx *sql.Tx, uuid int, recoveryCodeHashes []string) (err error) {
+	_, err = tx.Exec("DELETE FROM recovery_codes WHERE useruuid=?", uuid)
+	if err != nil {
+		return
+	}
+
+	for _, hash := range recoveryCodeHashes {
+		_, err = tx.Exec("INSERT INTO recovery_codes (useruuid, hash) VALUES (?, ?)", uuid, hash)
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
@@ -0,0 +1,221 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/VolticFroogo/Bernies-Busy-Bees/middleware"
+	"github.com/VolticFroogo/Bernies-Busy-Bees/models"
+	"github.com/gorilla/mux"
+)
+
+/*
+	Structs and variables
+*/
+
+// Prefix is the path every version 1 API route is under.
+const Prefix = "/api/v1"
+
+// endpoint is a single API route.
+// The router and the OpenAPI document are both built from the endpoints so they can't disagree.
+type endpoint struct {
+	Method, Path, Summary, Tag string
+	// Permission is the permission needed to use the endpoint, anyone logged in can if it's empty.
+	Permission string
+	// Public endpoints can be used without logging in, their handler gets an empty user.
+	Public bool
+	// Scope is the scope a personal access token needs to use the endpoint.
+	// Personal access tokens can't use endpoints without one.
+	Scope string
+	// Query lists the query parameters the endpoint reads.
+	Query []string
+	// Request and Response are zero values of the bodies, nil if there isn't one.
+	Request, Response interface{}
+	// Form is set if the request is a multipart form instead of JSON.
+	Form bool
+	// Status is the status code of a successful response.
+	Status  int
+	Handler func(w http.ResponseWriter, r *http.Request, user models.User)
+}
+
+// errorBody is the body of every error response.
+type errorBody struct {
+	Error apiError `json:"error"`
+}
+
+type apiError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// errorCodes are the machine readable codes for each error status.
+var errorCodes = map[int]string{
+	http.StatusBadRequest:            "bad_request",
+	http.StatusUnauthorized:          "unauthorized",
+	http.StatusForbidden:             "forbidden",
+	http.StatusNotFound:              "not_found",
+	http.StatusMethodNotAllowed:      "method_not_allowed",
+	http.StatusConflict:              "conflict",
+	http.StatusRequestEntityTooLarge: "too_large",
+	http.StatusTooManyRequests:       "too_many_requests",
+	http.StatusInternalServerError:   "internal_error",
+}
+
+/*
+	Routing
+*/
+
+// Route adds every API route to a router.
+func Route(r *mux.Router) {
+	s := r.PathPrefix(Prefix).Subrouter()
+
+	allowed := map[string][]string{}
+	var paths []string
+	for _, e := range endpoints {
+		s.Handle(e.Path, authenticate(e)).Methods(e.Method)
+
+		if allowed[e.Path] == nil {
+			paths = append(paths, e.Path)
+		}
+		allowed[e.Path] = append(allowed[e.Path], e.Method)
+	}
+
+	s.Handle("/openapi.json", http.HandlerFunc(openAPI)).Methods(http.MethodGet)
+
+	// Any other method on an existing path isn't allowed.
+	for _, path := range paths {
+		s.Handle(path, methodNotAllowed(allowed[path]))
+	}
+
+	s.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, "There is no API route at this path.")
+	})
+}
+
+// methodNotAllowed replies with the methods a path does allow.
+func methodNotAllowed(methods []string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Allow", strings.Join(methods, ", "))
+		writeError(w, http.StatusMethodNotAllowed, "This method isn't allowed on this route.")
+	})
+}
+
+// authenticate loads the user making a request and checks they're allowed to use the endpoint.
+func authenticate(e endpoint) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if e.Public {
+			e.Handler(w, r, models.User{})
+			return
+		}
+
+		uuidString, token, valid := middleware.API(w, r)
+		if !valid {
+			writeError(w, http.StatusUnauthorized, "You need to be logged in.")
+			return
+		}
+
+		user, exists, err := middleware.LoadUser(uuidString)
+		if err != nil {
+			internalError(w, "Loading user error", err)
+			return
+		}
+
+		if !exists {
+			// The user has been deleted since their token was made.
+			writeError(w, http.StatusUnauthorized, "You need to be logged in.")
+			return
+		}
+
+		if e.Permission != "" && !models.Authorize(user, e.Permission) {
+			writeError(w, http.StatusForbidden, "You don't have permission to do this.")
+			return
+		}
+
+		if token.ID != 0 {
+			if e.Scope == "" {
+				writeError(w, http.StatusForbidden, "Personal access tokens can't be used to do this, log in instead.")
+				return
+			}
+
+			if !token.HasScope(e.Scope) {
+				writeError(w, http.StatusForbidden, "This access token needs the "+e.Scope+" scope to do this.")
+				return
+			}
+
+			r = middleware.WithAccessToken(r, token)
+		}
+
+		e.Handler(w, middleware.WithUser(r, user), user)
+	})
+}
+
+// tokenAllows returns if the personal access token used for a request has a scope.
+// Requests which didn't use a personal access token are allowed everything.
+func tokenAllows(r *http.Request, scope string) bool {
+	token, ok := middleware.AccessToken(r)
+	return !ok || token.HasScope(scope)
+}
+
+/*
+	Requests and responses
+*/
+
+// decode decodes a JSON request body, replying with an error if it isn't valid.
+func decode(w http.ResponseWriter, r *http.Request, data interface{}) bool {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1024*1024)) // 1MB max request size otherwise decline.
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(data)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid JSON body: "+err.Error())
+		return false
+	}
+
+	return true
+}
+
+// pathInt reads an integer from the path, replying with a not found error if it isn't one.
+func pathInt(w http.ResponseWriter, r *http.Request, name string) (value int, ok bool) {
+	value, err := strconv.Atoi(mux.Vars(r)[name])
+	if err != nil {
+		writeError(w, http.StatusNotFound, "There is nothing with this ID.")
+		return 0, false
+	}
+
+	return value, true
+}
+
+// writeJSON replies with a status and a JSON body.
+func writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+
+	err := json.NewEncoder(w).Encode(data)
+	if err != nil {
+		log.Printf("JSON encoding error: %v", err)
+	}
+}
+
+// writeError replies with an error status, its code and a message for people.
+func writeError(w http.ResponseWriter, status int, message string) {
+	code, ok := errorCodes[status]
+	if !ok {
+		code = "error"
+	}
+
+	writeJSON(w, status, errorBody{
+		Error: apiError{
+			Code:    code,
+			Message: message,
+		},
+	})
+}
+
+// internalError logs an error and replies without giving any of its details away.
+func internalError(w http.ResponseWriter, errName string, err error) {
+	log.Printf("%v: %v\n", errName, err)
+	writeError(w, http.StatusInternalServerError, "Something went wrong, try again later.")
+}
@@ -0,0 +1,164 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/VolticFroogo/Bernies-Busy-Bees/db"
+	"github.com/VolticFroogo/Bernies-Busy-Bees/handler/users"
+	"github.com/VolticFroogo/Bernies-Busy-Bees/helpers"
+	"github.com/VolticFroogo/Bernies-Busy-Bees/middleware/myJWT"
+	"github.com/VolticFroogo/Bernies-Busy-Bees/models"
+)
+
+// passwordGrant is how many times an IP address has tried the password grant since start.
+type passwordGrant struct {
+	start time.Time
+	count int
+}
+
+var (
+	passwordGrants     = map[string]passwordGrant{}
+	passwordGrantsLock sync.Mutex
+)
+
+// passwordGrantAllowed counts a password grant from an IP address, returning how long it has to wait if it has tried
+// too many times. Logging in on the site needs a CAPTCHA, which API clients can't solve, so this limits guessing instead.
+func passwordGrantAllowed(ip string) (retryAfter time.Duration) {
+	now := time.Now()
+
+	passwordGrantsLock.Lock()
+	defer passwordGrantsLock.Unlock()
+
+	for key, grant := range passwordGrants {
+		if now.Sub(grant.start) >= models.PasswordGrantTime {
+			delete(passwordGrants, key) // Forget IP addresses whose time is up.
+		}
+	}
+
+	grant, ok := passwordGrants[ip]
+	if !ok {
+		grant.start = now
+	}
+
+	if grant.count >= models.PasswordGrantsAllowed {
+		return grant.start.Add(models.PasswordGrantTime).Sub(now)
+	}
+
+	grant.count++
+	passwordGrants[ip] = grant
+	return 0
+}
+
+func exchangeToken(w http.ResponseWriter, r *http.Request, current models.User) {
+	var data tokenRequest
+	if !decode(w, r, &data) {
+		return
+	}
+
+	var authTokenString, refreshTokenString string
+	var err error
+	switch data.GrantType {
+	case "password":
+		ip := helpers.ClientIP(r)
+		retryAfter := passwordGrantAllowed(ip)
+		if retryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.FormatInt(int64(retryAfter/time.Second)+1, 10))
+			writeError(w, http.StatusTooManyRequests, "There have been too many logins from this IP address, try again later.")
+			return
+		}
+
+		retryAfter, err = users.LoginLocked(data.Email, ip)
+		if err != nil {
+			internalError(w, "Checking login lockout error", err)
+			return
+		}
+
+		if retryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.FormatInt(int64(retryAfter/time.Second), 10))
+			writeError(w, http.StatusTooManyRequests, "There have been too many failed logins, try again later.")
+			return
+		}
+
+		var u models.User
+		u, err = db.GetUserFromEmail(data.Email)
+		if err != nil {
+			internalError(w, "Getting user from DB error", err)
+			return
+		}
+
+		if u.UUID == 0 || !helpers.CheckPassword(data.Password, u.Password) {
+			loginFailed(w, data.Email, ip, "The email or password is incorrect.")
+			return
+		}
+
+		if u.TwoFactor {
+			var valid bool
+			valid, err = users.CheckTwoFactor(u.UUID, data.Code)
+			if err != nil {
+				internalError(w, "Checking two-factor code error", err)
+				return
+			}
+
+			if !valid {
+				loginFailed(w, data.Email, ip, "The two-factor code is missing or incorrect.")
+				return
+			}
+		} else if u.Passkeys {
+			// Passkeys need a browser, so an account whose only second factor is a passkey can't use the password grant.
+			writeError(w, http.StatusForbidden, "This account's second factor is a passkey, which the API can't use. Use a personal access token instead.")
+			return
+		}
+
+		err = users.LoginSucceeded(data.Email)
+		if err != nil {
+			internalError(w, "Clearing login failures error", err)
+			return
+		}
+
+		authTokenString, refreshTokenString, _, err = myJWT.CreateNewTokens(strconv.Itoa(u.UUID), r)
+	case "refresh_token":
+		var valid bool
+		valid, _, err = myJWT.CheckRefreshToken(data.RefreshToken)
+		if err != nil {
+			internalError(w, "Checking token error", err)
+			return
+		}
+
+		if !valid {
+			writeError(w, http.StatusUnauthorized, "The refresh token is invalid, expired or has already been used.")
+			return
+		}
+
+		authTokenString, refreshTokenString, _, err = myJWT.RefreshTokens(data.RefreshToken, r)
+	default:
+		writeError(w, http.StatusBadRequest, "The grant type must be password or refresh_token.")
+		return
+	}
+
+	if err != nil {
+		internalError(w, "Creating tokens error", err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, tokens{
+		TokenType:    "Bearer",
+		AuthToken:    authTokenString,
+		RefreshToken: refreshTokenString,
+		ExpiresIn:    int(models.AuthTokenValidTime.Seconds()),
+	})
+}
+
+// loginFailed counts a failed login towards its email and IP address's lockout before refusing it.
+func loginFailed(w http.ResponseWriter, email, ip, message string) {
+	err := users.LoginFailed(email, ip)
+	if err != nil {
+		internalError(w, "Counting login failure error", err)
+		return
+	}
+
+	writeError(w, http.StatusUnauthorized, message)
+}
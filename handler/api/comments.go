@@ -0,0 +1,143 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/VolticFroogo/Bernies-Busy-Bees/db"
+	"github.com/VolticFroogo/Bernies-Busy-Bees/models"
+	"github.com/gorilla/mux"
+)
+
+// canModerate returns if a user has a permission to change other people's comments.
+func canModerate(r *http.Request, user models.User, permission string) bool {
+	return models.Authorize(user, permission) && tokenAllows(r, "comments:moderate")
+}
+
+// ownComment returns a comment on a post if it exists and the user is allowed to change it,
+// replying with an error otherwise.
+// Users can change their own comments if they can comment, and anyone's with the moderating permission.
+func ownComment(w http.ResponseWriter, r *http.Request, current models.User, permission string) (p models.Post, c models.DisplayComment, ok bool) {
+	p, ok = visiblePost(w, r, current)
+	if !ok {
+		return
+	}
+
+	c, ok = findComment(p.Comments, mux.Vars(r)["commentID"])
+	if !ok || c.Deleted {
+		writeError(w, http.StatusNotFound, "There is no comment with this ID.")
+		return p, c, false
+	}
+
+	if c.UserUUID == current.UUID {
+		if !models.Authorize(current, models.PermCommentsCreate) {
+			writeError(w, http.StatusForbidden, "You don't have permission to do this.")
+			return p, c, false
+		}
+	} else if !canModerate(r, current, permission) {
+		writeError(w, http.StatusForbidden, "You can only change your own comments.")
+		return p, c, false
+	}
+
+	return p, c, true
+}
+
+func listComments(w http.ResponseWriter, r *http.Request, current models.User) {
+	p, ok := visiblePost(w, r, current)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newComments(p.Comments))
+}
+
+func createComment(w http.ResponseWriter, r *http.Request, current models.User) {
+	p, ok := visiblePost(w, r, current)
+	if !ok {
+		return
+	}
+
+	var data commentCreate
+	if !decode(w, r, &data) {
+		return
+	}
+
+	if data.Comment == "" {
+		writeError(w, http.StatusBadRequest, "A comment can't be empty.")
+		return
+	}
+
+	if data.ParentID != "" {
+		parent, ok := findComment(p.Comments, data.ParentID)
+		if !ok || parent.Deleted {
+			writeError(w, http.StatusBadRequest, "The comment being replied to doesn't exist.")
+			return
+		}
+	}
+
+	id, err := db.AddCommentPost(models.NewComment{
+		ID:        p.ID,
+		UserUUID:  current.UUID,
+		Timestamp: time.Now().Unix(),
+		Comment:   data.Comment,
+		ParentID:  data.ParentID,
+	})
+	if err != nil {
+		internalError(w, "Adding comment error", err)
+		return
+	}
+
+	writeComment(w, p.ID, id, http.StatusCreated)
+}
+
+func updateComment(w http.ResponseWriter, r *http.Request, current models.User) {
+	p, c, ok := ownComment(w, r, current, models.PermCommentsEditAny)
+	if !ok {
+		return
+	}
+
+	var data commentPatch
+	if !decode(w, r, &data) {
+		return
+	}
+
+	if data.Comment == "" {
+		writeError(w, http.StatusBadRequest, "A comment can't be empty.")
+		return
+	}
+
+	err := db.EditCommentPost(c.ID, p.ID, data.Comment, time.Now().Unix())
+	if err != nil {
+		internalError(w, "Editing comment error", err)
+		return
+	}
+
+	writeComment(w, p.ID, c.ID, http.StatusOK)
+}
+
+func deleteComment(w http.ResponseWriter, r *http.Request, current models.User) {
+	p, c, ok := ownComment(w, r, current, models.PermCommentsDeleteAny)
+	if !ok {
+		return
+	}
+
+	err := db.DeleteCommentPost(c.ID, p.ID)
+	if err != nil {
+		internalError(w, "Deleting comment error", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeComment replies with a comment as it is now in the DB.
+func writeComment(w http.ResponseWriter, postID int, commentID string, status int) {
+	p, _, err := db.GetPost(postID)
+	if err != nil {
+		internalError(w, "Getting post error", err)
+		return
+	}
+
+	c, _ := findComment(p.Comments, commentID)
+	writeJSON(w, status, newComments([]models.DisplayComment{c})[0])
+}
@@ -0,0 +1,210 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/VolticFroogo/Bernies-Busy-Bees/models"
+)
+
+// endpoints are every route in the API.
+var endpoints = []endpoint{
+	/* Authentication */
+	{
+		Method: http.MethodPost, Path: "/token", Tag: "Authentication",
+		Summary: "Exchange an email and password, or an unused refresh token, for a new auth and refresh token. " +
+			"Users with two-factor authentication also send a TOTP or recovery code. " +
+			"The password grant needs no CAPTCHA, instead each IP address can only try it 10 times a minute. " +
+			"Too many failed logins for an email or IP address lock it for a while, doubling with each failure. " +
+			"Requests using the auth token as a bearer token don't need a CSRF secret.",
+		Public:   true,
+		Request:  tokenRequest{},
+		Response: tokens{},
+		Status:   http.StatusOK,
+		Handler:  exchangeToken,
+	},
+
+	/* Posts */
+	{
+		Method: http.MethodGet, Path: "/posts", Tag: "Posts",
+		Summary:    "List posts, newest first. Users who can see unpublished posts also see drafts and scheduled posts.",
+		Permission: models.PermPanel,
+		Query:      []string{"page"},
+		Response:   postList{},
+		Scope:      "posts:read",
+		Status:     http.StatusOK,
+		Handler:    listPosts,
+	},
+	{
+		Method: http.MethodPost, Path: "/posts", Tag: "Posts",
+		Summary:    "Create a post with its images.",
+		Permission: models.PermPostsCreate,
+		Request:    postForm{},
+		Form:       true,
+		Response:   post{},
+		Scope:      "posts:write",
+		Status:     http.StatusCreated,
+		Handler:    createPost,
+	},
+	{
+		Method: http.MethodGet, Path: "/posts/{postID}", Tag: "Posts",
+		Summary:    "Get a post.",
+		Permission: models.PermPanel,
+		Response:   post{},
+		Scope:      "posts:read",
+		Status:     http.StatusOK,
+		Handler:    getPost,
+	},
+	{
+		Method: http.MethodPatch, Path: "/posts/{postID}", Tag: "Posts",
+		Summary:    "Change a post's title, description or status.",
+		Permission: models.PermPostsEdit,
+		Request:    postPatch{},
+		Response:   post{},
+		Scope:      "posts:write",
+		Status:     http.StatusOK,
+		Handler:    updatePost,
+	},
+	{
+		Method: http.MethodDelete, Path: "/posts/{postID}", Tag: "Posts",
+		Summary:    "Delete a post along with its images and comments.",
+		Permission: models.PermPostsDelete,
+		Scope:      "posts:write",
+		Status:     http.StatusNoContent,
+		Handler:    deletePost,
+	},
+
+	/* Comments */
+	{
+		Method: http.MethodGet, Path: "/posts/{postID}/comments", Tag: "Comments",
+		Summary:    "List the comment threads on a post, newest first.",
+		Permission: models.PermPanel,
+		Response:   []comment{},
+		Scope:      "posts:read",
+		Status:     http.StatusOK,
+		Handler:    listComments,
+	},
+	{
+		Method: http.MethodPost, Path: "/posts/{postID}/comments", Tag: "Comments",
+		Summary:    "Comment on a post, or reply to a comment.",
+		Permission: models.PermCommentsCreate,
+		Request:    commentCreate{},
+		Response:   comment{},
+		Scope:      "comments:write",
+		Status:     http.StatusCreated,
+		Handler:    createComment,
+	},
+	{
+		Method: http.MethodPatch, Path: "/posts/{postID}/comments/{commentID}", Tag: "Comments",
+		Summary:  "Edit a comment. Only its author and users who can edit anyone's comments can edit it.",
+		Request:  commentPatch{},
+		Response: comment{},
+		Scope:    "comments:write",
+		Status:   http.StatusOK,
+		Handler:  updateComment,
+	},
+	{
+		Method: http.MethodDelete, Path: "/posts/{postID}/comments/{commentID}", Tag: "Comments",
+		Summary: "Delete a comment. Only its author and users who can delete anyone's comments can delete it.",
+		Scope:   "comments:write",
+		Status:  http.StatusNoContent,
+		Handler: deleteComment,
+	},
+
+	/* Users */
+	{
+		Method: http.MethodGet, Path: "/users", Tag: "Users",
+		Summary:    "List every user.",
+		Permission: models.PermUsersManage,
+		Response:   []user{},
+		Scope:      "users:admin",
+		Status:     http.StatusOK,
+		Handler:    listUsers,
+	},
+	{
+		Method: http.MethodPost, Path: "/users", Tag: "Users",
+		Summary: "Invite someone to make an account with a role. " +
+			"They are emailed a link which works once, for 7 days, and choose their own name and password.",
+		Permission: models.PermUsersManage,
+		Request:    invitationCreate{},
+		Response:   invitation{},
+		Scope:      "users:admin",
+		Status:     http.StatusCreated,
+		Handler:    inviteUser,
+	},
+	{
+		Method: http.MethodGet, Path: "/users/{userID}", Tag: "Users",
+		Summary:    "Get a user.",
+		Permission: models.PermUsersManage,
+		Response:   user{},
+		Scope:      "users:admin",
+		Status:     http.StatusOK,
+		Handler:    getUser,
+	},
+	{
+		Method: http.MethodPatch, Path: "/users/{userID}", Tag: "Users",
+		Summary:    "Change a user.",
+		Permission: models.PermUsersManage,
+		Request:    userPatch{},
+		Response:   user{},
+		Scope:      "users:admin",
+		Status:     http.StatusOK,
+		Handler:    updateUser,
+	},
+	{
+		Method: http.MethodDelete, Path: "/users/{userID}", Tag: "Users",
+		Summary:    "Delete a user.",
+		Permission: models.PermUsersManage,
+		Scope:      "users:admin",
+		Status:     http.StatusNoContent,
+		Handler:    deleteUser,
+	},
+	{
+		Method: http.MethodGet, Path: "/roles", Tag: "Users",
+		Summary:    "List every role a user can be given, along with its permissions.",
+		Permission: models.PermUsersManage,
+		Response:   []role{},
+		Scope:      "users:admin",
+		Status:     http.StatusOK,
+		Handler:    listRoles,
+	},
+
+	/* Self */
+	{
+		Method: http.MethodGet, Path: "/self", Tag: "Self",
+		Summary:  "Get the logged in user.",
+		Response: user{},
+		Scope:    "profile:read",
+		Status:   http.StatusOK,
+		Handler:  getSelf,
+	},
+	{
+		Method: http.MethodPatch, Path: "/self", Tag: "Self",
+		Summary:  "Change the logged in user. A new email is only used once it has been verified. Changing the password logs out every token, so bearer clients get new tokens in the reply.",
+		Request:  selfPatch{},
+		Response: selfUpdate{},
+		Status:   http.StatusOK,
+		Handler:  updateSelf,
+	},
+	{
+		Method: http.MethodGet, Path: "/self/tokens", Tag: "Self",
+		Summary:  "List the logged in user's personal access tokens.",
+		Response: []accessToken{},
+		Status:   http.StatusOK,
+		Handler:  listTokens,
+	},
+	{
+		Method: http.MethodPost, Path: "/self/tokens", Tag: "Self",
+		Summary: "Create a personal access token limited to some scopes. " +
+			"The token is only ever shown in this response, send it as an \"Authorization: Bearer\" header.",
+		Request:  accessTokenCreate{},
+		Response: newAccessToken{},
+		Status:   http.StatusCreated,
+		Handler:  createToken,
+	},
+	{
+		Method: http.MethodDelete, Path: "/self/tokens/{tokenID}", Tag: "Self",
+		Summary: "Revoke one of the logged in user's personal access tokens.",
+		Status:  http.StatusNoContent,
+		Handler: deleteToken,
+	},
+}
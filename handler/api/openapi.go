@@ -0,0 +1,260 @@
+package api
+
+import (
+	"net/http"
+	"reflect"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+/*
+	OpenAPI document
+*/
+
+var (
+	document     map[string]interface{}
+	documentOnce sync.Once
+
+	pathParameter = regexp.MustCompile(`{([^}]+)}`)
+	fileType      = reflect.TypeOf(file(""))
+)
+
+// openAPI serves the OpenAPI document describing every endpoint.
+func openAPI(w http.ResponseWriter, r *http.Request) {
+	documentOnce.Do(func() {
+		document = buildDocument()
+	})
+
+	writeJSON(w, http.StatusOK, document)
+}
+
+// buildDocument builds an OpenAPI 3 document from the endpoints.
+func buildDocument() map[string]interface{} {
+	schemas := map[string]interface{}{}
+	paths := map[string]interface{}{}
+
+	errorSchema := schemaOf(reflect.TypeOf(errorBody{}), schemas)
+
+	for _, e := range endpoints {
+		operation := map[string]interface{}{
+			"summary":     e.Summary,
+			"tags":        []string{e.Tag},
+			"operationId": operationID(e),
+		}
+		if e.Public {
+			operation["security"] = []interface{}{}
+		}
+		if e.Permission != "" {
+			operation["x-permission"] = e.Permission
+		}
+		if e.Scope != "" {
+			operation["x-access-token-scope"] = e.Scope
+		}
+
+		var parameters []interface{}
+		for _, match := range pathParameter.FindAllStringSubmatch(e.Path, -1) {
+			parameters = append(parameters, map[string]interface{}{
+				"name":     match[1],
+				"in":       "path",
+				"required": true,
+				"schema":   map[string]interface{}{"type": "integer"},
+			})
+		}
+		for _, name := range e.Query {
+			parameters = append(parameters, map[string]interface{}{
+				"name":   name,
+				"in":     "query",
+				"schema": map[string]interface{}{"type": "integer"},
+			})
+		}
+		if parameters != nil {
+			operation["parameters"] = parameters
+		}
+
+		if e.Request != nil {
+			contentType := "application/json"
+			if e.Form {
+				contentType = "multipart/form-data"
+			}
+
+			operation["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content": map[string]interface{}{
+					contentType: map[string]interface{}{
+						"schema": schemaOf(reflect.TypeOf(e.Request), schemas),
+					},
+				},
+			}
+		}
+
+		success := map[string]interface{}{
+			"description": http.StatusText(e.Status),
+		}
+		if e.Response != nil {
+			success["content"] = jsonContent(schemaOf(reflect.TypeOf(e.Response), schemas))
+		}
+
+		responses := map[string]interface{}{
+			strconv.Itoa(e.Status): success,
+		}
+		for _, status := range errorStatuses(e) {
+			responses[strconv.Itoa(status)] = map[string]interface{}{
+				"description": http.StatusText(status),
+				"content":     jsonContent(errorSchema),
+			}
+		}
+		operation["responses"] = responses
+
+		path, ok := paths[Prefix+e.Path].(map[string]interface{})
+		if !ok {
+			path = map[string]interface{}{}
+			paths[Prefix+e.Path] = path
+		}
+		path[strings.ToLower(e.Method)] = operation
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "Bernie's Busy Bees API",
+			"version": "1",
+		},
+		"servers": []interface{}{
+			map[string]interface{}{"url": "/"},
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": schemas,
+			"securitySchemes": map[string]interface{}{
+				"bearer": map[string]interface{}{
+					"type":         "http",
+					"scheme":       "bearer",
+					"bearerFormat": "JWT",
+				},
+				"accessToken": map[string]interface{}{
+					"type":        "http",
+					"scheme":      "bearer",
+					"description": "A personal access token, which can only use endpoints with one of its scopes in x-access-token-scope.",
+				},
+				"cookie": map[string]interface{}{
+					"type":        "apiKey",
+					"in":          "cookie",
+					"name":        "authToken",
+					"description": "Requests which can change anything also need the CSRF secret in an X-CSRF-Token header.",
+				},
+			},
+		},
+		"security": []interface{}{
+			map[string]interface{}{"bearer": []string{}},
+			map[string]interface{}{"accessToken": []string{}},
+			map[string]interface{}{"cookie": []string{}},
+		},
+	}
+}
+
+// operationID names an endpoint after its handler, like listPosts.
+func operationID(e endpoint) string {
+	name := runtime.FuncForPC(reflect.ValueOf(e.Handler).Pointer()).Name()
+	return name[strings.LastIndex(name, ".")+1:]
+}
+
+// errorStatuses returns the error statuses an endpoint can reply with.
+func errorStatuses(e endpoint) (statuses []int) {
+	statuses = []int{http.StatusUnauthorized}
+
+	// Even without a permission an access token can be missing the scope.
+	if !e.Public {
+		statuses = append(statuses, http.StatusForbidden)
+	}
+	if e.Request != nil || e.Query != nil {
+		statuses = append(statuses, http.StatusBadRequest)
+	}
+	if strings.Contains(e.Path, "{") {
+		statuses = append(statuses, http.StatusNotFound)
+	}
+	// Users and self can clash with another user's email.
+	if e.Request != nil && (e.Tag == "Users" || e.Tag == "Self") {
+		statuses = append(statuses, http.StatusConflict)
+	}
+
+	// Logging in is locked after too many failures.
+	if e.Tag == "Authentication" {
+		statuses = append(statuses, http.StatusTooManyRequests)
+	}
+
+	statuses = append(statuses, http.StatusInternalServerError)
+	return
+}
+
+func jsonContent(schema interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"application/json": map[string]interface{}{
+			"schema": schema,
+		},
+	}
+}
+
+// schemaOf returns the schema of a type, adding structs to the components so they can refer to themselves.
+func schemaOf(t reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	if t == fileType {
+		return map[string]interface{}{"type": "string", "format": "binary"}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return schemaOf(t.Elem(), schemas)
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Int, reflect.Int32:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": schemaOf(t.Elem(), schemas)}
+	case reflect.Struct:
+		name := schemaName(t)
+		ref := map[string]interface{}{"$ref": "#/components/schemas/" + name}
+		if _, ok := schemas[name]; ok {
+			return ref
+		}
+
+		// Add the name before the fields so recursive types stop here.
+		object := map[string]interface{}{"type": "object"}
+		schemas[name] = object
+
+		properties := map[string]interface{}{}
+		var required []string
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			tag := strings.Split(field.Tag.Get("json"), ",")
+			if tag[0] == "" || tag[0] == "-" {
+				continue
+			}
+
+			properties[tag[0]] = schemaOf(field.Type, schemas)
+			if len(tag) == 1 && field.Type.Kind() != reflect.Ptr {
+				required = append(required, tag[0])
+			}
+		}
+
+		object["properties"] = properties
+		if required != nil {
+			object["required"] = required
+		}
+
+		return ref
+	}
+
+	return map[string]interface{}{}
+}
+
+// schemaName turns a type name into a component name, like post to Post.
+func schemaName(t reflect.Type) string {
+	name := t.Name()
+	return strings.ToUpper(name[:1]) + name[1:]
+}
@@ -0,0 +1,206 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/VolticFroogo/Bernies-Busy-Bees/db"
+	handlerPost "github.com/VolticFroogo/Bernies-Busy-Bees/handler/post"
+	"github.com/VolticFroogo/Bernies-Busy-Bees/models"
+)
+
+// postsPerPage is how many posts are in each page of the post list.
+const postsPerPage = 10
+
+// canSeeDrafts returns if a user can see drafts and scheduled posts.
+func canSeeDrafts(user models.User) bool {
+	return models.Authorize(user, models.PermPostsUnpublished)
+}
+
+// visiblePost returns a post if it exists and the user can see it, replying with a not found error otherwise.
+func visiblePost(w http.ResponseWriter, r *http.Request, current models.User) (p models.Post, ok bool) {
+	postID, ok := pathInt(w, r, "postID")
+	if !ok {
+		return
+	}
+
+	p, exists, err := db.GetPost(postID)
+	if err != nil {
+		internalError(w, "Getting post error", err)
+		return p, false
+	}
+
+	if !exists || (p.Status != models.PostPublished && !canSeeDrafts(current)) {
+		writeError(w, http.StatusNotFound, "There is no post with this ID.")
+		return p, false
+	}
+
+	return p, true
+}
+
+func listPosts(w http.ResponseWriter, r *http.Request, current models.User) {
+	page := 1
+	if pageString := r.URL.Query().Get("page"); pageString != "" {
+		var err error
+		page, err = strconv.Atoi(pageString)
+		if err != nil || page < 1 {
+			writeError(w, http.StatusBadRequest, "The page must be a number above 0.")
+			return
+		}
+	}
+
+	// Get one more post than needed to know if there's another page.
+	posts, err := db.GetPosts(postsPerPage+1, postsPerPage, page, canSeeDrafts(current))
+	if err != nil {
+		internalError(w, "Getting posts error", err)
+		return
+	}
+
+	list := postList{
+		Posts: []post{},
+		Page:  page,
+	}
+
+	if len(posts) > postsPerPage {
+		posts = posts[:postsPerPage]
+		list.NextPage = page + 1
+	}
+
+	for _, p := range posts {
+		list.Posts = append(list.Posts, newPost(p))
+	}
+
+	writeJSON(w, http.StatusOK, list)
+}
+
+func getPost(w http.ResponseWriter, r *http.Request, current models.User) {
+	p, ok := visiblePost(w, r, current)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newPost(p))
+}
+
+func createPost(w http.ResponseWriter, r *http.Request, current models.User) {
+	r.Body = http.MaxBytesReader(w, r.Body, 100*1024*1024) // 100MB max request size otherwise decline.
+	err := r.ParseMultipartForm(10 * 1024 * 1024)          // Use a total of 10MB RAM and the rest in temporary disk.
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid multipart form: "+err.Error())
+		return
+	}
+
+	form := r.MultipartForm
+
+	// The panel sends the status as a number but the API uses its name.
+	if len(form.Value["status"]) != 0 {
+		status, ok := parseStatus(form.Value["status"][0])
+		if !ok {
+			writeError(w, http.StatusBadRequest, "The status must be draft, scheduled or published.")
+			return
+		}
+
+		form.Value["status"] = []string{strconv.Itoa(status)}
+	}
+
+	id, err := handlerPost.NewFromForm(form)
+	if err == handlerPost.ErrInvalidPost {
+		writeError(w, http.StatusBadRequest, "A post needs a title, description and thumbnail.")
+		return
+	}
+	if err != nil {
+		internalError(w, "Adding post error", err)
+		return
+	}
+
+	p, _, err := db.GetPost(id)
+	if err != nil {
+		internalError(w, "Getting post error", err)
+		return
+	}
+
+	w.Header().Set("Location", Prefix+"/posts/"+strconv.Itoa(id))
+	writeJSON(w, http.StatusCreated, newPost(p))
+}
+
+func updatePost(w http.ResponseWriter, r *http.Request, current models.User) {
+	p, ok := visiblePost(w, r, current)
+	if !ok {
+		return
+	}
+
+	var data postPatch
+	if !decode(w, r, &data) {
+		return
+	}
+
+	if data.Title != nil || data.Description != nil {
+		title, description := p.Title, p.Description
+		if data.Title != nil {
+			title = *data.Title
+		}
+		if data.Description != nil {
+			description = *data.Description
+		}
+
+		if title == "" {
+			writeError(w, http.StatusBadRequest, "A post needs a title.")
+			return
+		}
+
+		err := db.EditPost(p.ID, title, description)
+		if err != nil {
+			internalError(w, "Editing post error", err)
+			return
+		}
+	}
+
+	if data.Status != nil {
+		status, ok := parseStatus(*data.Status)
+		if !ok {
+			writeError(w, http.StatusBadRequest, "The status must be draft, scheduled or published.")
+			return
+		}
+
+		var publishTime int64
+		if data.PublishTime != nil {
+			publishTime = *data.PublishTime
+		}
+
+		// Publishing a post again would move it back to the top.
+		if p.Status != models.PostPublished || status != models.PostPublished {
+			status, publishTime, _ = handlerPost.CheckStatus(status, publishTime)
+
+			err := db.EditPostStatus(p.ID, status, publishTime)
+			if err != nil {
+				internalError(w, "Editing post status error", err)
+				return
+			}
+		}
+	}
+
+	p, _, err := db.GetPost(p.ID)
+	if err != nil {
+		internalError(w, "Getting post error", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newPost(p))
+}
+
+func deletePost(w http.ResponseWriter, r *http.Request, current models.User) {
+	p, ok := visiblePost(w, r, current)
+	if !ok {
+		return
+	}
+
+	images, err := db.DeletePost(p.ID)
+	if err != nil {
+		internalError(w, "Deleting post error", err)
+		return
+	}
+
+	handlerPost.DeleteImages(images)
+
+	w.WriteHeader(http.StatusNoContent)
+}
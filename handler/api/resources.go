@@ -0,0 +1,316 @@
+package api
+
+import (
+	"strings"
+
+	"github.com/VolticFroogo/Bernies-Busy-Bees/models"
+)
+
+/*
+	Resources sent by the API
+*/
+
+type post struct {
+	ID          int     `json:"id"`
+	Title       string  `json:"title"`
+	Description string  `json:"description"`
+	Status      string  `json:"status"`
+	PublishTime int64   `json:"publishTime"`
+	CreateTime  string  `json:"createTime"`
+	URL         string  `json:"url"`
+	Images      []image `json:"images"`
+}
+
+type postList struct {
+	Posts []post `json:"posts"`
+	Page  int    `json:"page"`
+	// NextPage is 0 when there are no more pages.
+	NextPage int `json:"nextPage"`
+}
+
+type image struct {
+	ID          int    `json:"id"`
+	URL         string `json:"url"`
+	Filename    string `json:"filename"`
+	ContentType string `json:"contentType"`
+	Size        int64  `json:"size"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	Caption     string `json:"caption"`
+}
+
+type comment struct {
+	ID         string    `json:"id"`
+	ParentID   string    `json:"parentId"`
+	AuthorID   int       `json:"authorId"`
+	AuthorName string    `json:"authorName"`
+	Comment    string    `json:"comment"`
+	Timestamp  int64     `json:"timestamp"`
+	Edited     int64     `json:"edited"`
+	Deleted    bool      `json:"deleted"`
+	Replies    []comment `json:"replies"`
+}
+
+type user struct {
+	ID         int    `json:"id"`
+	Email      string `json:"email"`
+	FirstName  string `json:"firstName"`
+	LastName   string `json:"lastName"`
+	Role       role   `json:"role"`
+	CreateTime string `json:"createTime"`
+	TwoFactor  bool   `json:"twoFactor"`
+}
+
+type role struct {
+	ID               int      `json:"id"`
+	Name             string   `json:"name"`
+	Permissions      []string `json:"permissions"`
+	RequireTwoFactor bool     `json:"requireTwoFactor"`
+}
+
+type accessToken struct {
+	ID         int      `json:"id"`
+	Name       string   `json:"name"`
+	Prefix     string   `json:"prefix"`
+	Scopes     []string `json:"scopes"`
+	CreateTime int64    `json:"createTime"`
+	// LastUsed is 0 if the token has never been used.
+	LastUsed int64 `json:"lastUsed"`
+}
+
+// invitation is an email address invited to make an account, who chooses their own name and password.
+type invitation struct {
+	ID         int    `json:"id"`
+	Email      string `json:"email"`
+	Role       role   `json:"role"`
+	CreateTime int64  `json:"createTime"`
+	// Expiry is when the link in the invitation email stops working.
+	Expiry int64 `json:"expiry"`
+}
+
+// newAccessToken is the only time the token itself is sent.
+type newAccessToken struct {
+	Token       string      `json:"token"`
+	AccessToken accessToken `json:"accessToken"`
+}
+
+/*
+	Request bodies
+*/
+
+// postForm is the multipart form for creating a post, only used to document it.
+type postForm struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	// Status is draft, scheduled or published, published if it's left out.
+	Status      string `json:"status,omitempty"`
+	PublishTime int64  `json:"publishTime,omitempty"`
+	Thumbnail   file   `json:"thumbnail"`
+	Images      []file `json:"images,omitempty"`
+}
+
+// file is an uploaded file in a multipart form.
+type file string
+
+type postPatch struct {
+	Title       *string `json:"title,omitempty"`
+	Description *string `json:"description,omitempty"`
+	Status      *string `json:"status,omitempty"`
+	PublishTime *int64  `json:"publishTime,omitempty"`
+}
+
+type commentCreate struct {
+	Comment  string `json:"comment"`
+	ParentID string `json:"parentId,omitempty"`
+}
+
+type commentPatch struct {
+	Comment string `json:"comment"`
+}
+
+type invitationCreate struct {
+	Email  string `json:"email"`
+	RoleID int    `json:"roleId"`
+}
+
+type userPatch struct {
+	Email     *string `json:"email,omitempty"`
+	Password  *string `json:"password,omitempty"`
+	FirstName *string `json:"firstName,omitempty"`
+	LastName  *string `json:"lastName,omitempty"`
+	RoleID    *int    `json:"roleId,omitempty"`
+}
+
+// selfPatch is a user changing their own account, changing the email sends a verification email first.
+type selfPatch struct {
+	Email     *string `json:"email,omitempty"`
+	Password  *string `json:"password,omitempty"`
+	FirstName *string `json:"firstName,omitempty"`
+	LastName  *string `json:"lastName,omitempty"`
+}
+
+// selfUpdate is the logged in user after changing them.
+// Changing the password logs out every token, so Tokens replaces the bearer tokens the request used.
+type selfUpdate struct {
+	User   user    `json:"user"`
+	Tokens *tokens `json:"tokens,omitempty"`
+}
+
+// tokenRequest exchanges a login or an unused refresh token for new tokens.
+type tokenRequest struct {
+	// GrantType is password or refresh_token.
+	GrantType    string `json:"grantType"`
+	Email        string `json:"email,omitempty"`
+	Password     string `json:"password,omitempty"`
+	RefreshToken string `json:"refreshToken,omitempty"`
+	// Code is needed with a password for users with two-factor authentication.
+	Code string `json:"code,omitempty"`
+}
+
+type tokens struct {
+	// TokenType is always Bearer, the auth token goes in an "Authorization: Bearer" header.
+	TokenType    string `json:"tokenType"`
+	AuthToken    string `json:"authToken"`
+	RefreshToken string `json:"refreshToken"`
+	// ExpiresIn is how many seconds the auth token is valid for.
+	ExpiresIn int `json:"expiresIn"`
+}
+
+type accessTokenCreate struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+/*
+	Conversions
+*/
+
+var statusNames = map[int]string{
+	models.PostDraft:     "draft",
+	models.PostScheduled: "scheduled",
+	models.PostPublished: "published",
+}
+
+// parseStatus returns the post status with a name.
+func parseStatus(name string) (status int, ok bool) {
+	for status, statusName := range statusNames {
+		if statusName == strings.ToLower(name) {
+			return status, true
+		}
+	}
+
+	return 0, false
+}
+
+func newPost(p models.Post) post {
+	images := make([]image, len(p.Images))
+	for i, img := range p.Images {
+		images[i] = image{
+			ID:          img.ID,
+			URL:         img.URL(),
+			Filename:    img.Filename,
+			ContentType: img.ContentType,
+			Size:        img.Size,
+			Width:       img.Width,
+			Height:      img.Height,
+			Caption:     img.Caption,
+		}
+	}
+
+	return post{
+		ID:          p.ID,
+		Title:       p.Title,
+		Description: p.Description,
+		Status:      statusNames[p.Status],
+		PublishTime: p.PublishTime,
+		CreateTime:  p.CreateTime,
+		URL:         models.SiteURL + p.URL(),
+		Images:      images,
+	}
+}
+
+func newComments(comments []models.DisplayComment) []comment {
+	converted := make([]comment, len(comments))
+	for i, c := range comments {
+		converted[i] = comment{
+			ID:        c.ID,
+			ParentID:  c.ParentID,
+			Comment:   c.Comment,
+			Timestamp: c.Timestamp,
+			Edited:    c.Edited,
+			Deleted:   c.Deleted,
+			Replies:   newComments(c.Replies),
+		}
+
+		// Placeholders of deleted comments don't show who wrote them.
+		if !c.Deleted {
+			converted[i].AuthorID = c.UserUUID
+			converted[i].AuthorName = strings.TrimSpace(c.User.Fname + " " + c.User.Lname)
+		}
+	}
+
+	return converted
+}
+
+// findComment returns a comment from anywhere in a thread.
+func findComment(comments []models.DisplayComment, id string) (found models.DisplayComment, ok bool) {
+	for _, c := range comments {
+		if c.ID == id {
+			return c, true
+		}
+
+		found, ok = findComment(c.Replies, id)
+		if ok {
+			return
+		}
+	}
+
+	return
+}
+
+func newUser(u models.User) user {
+	return user{
+		ID:         u.UUID,
+		Email:      u.Email,
+		FirstName:  u.Fname,
+		LastName:   u.Lname,
+		Role:       newRole(u.Role),
+		CreateTime: u.CreateTime,
+		TwoFactor:  u.TwoFactor,
+	}
+}
+
+func newRole(r models.Role) role {
+	permissions := r.Permissions
+	if permissions == nil {
+		permissions = []string{}
+	}
+
+	return role{
+		ID:               r.ID,
+		Name:             r.Name,
+		Permissions:      permissions,
+		RequireTwoFactor: r.RequireTwoFactor,
+	}
+}
+
+func newInvitation(i models.Invitation) invitation {
+	return invitation{
+		ID:         i.ID,
+		Email:      i.Email,
+		Role:       newRole(i.Role),
+		CreateTime: i.CreateTime,
+		Expiry:     i.Expiry,
+	}
+}
+
+func newToken(token models.AccessToken) accessToken {
+	return accessToken{
+		ID:         token.ID,
+		Name:       token.Name,
+		Prefix:     token.Prefix,
+		Scopes:     token.Scopes,
+		CreateTime: token.CreateTime,
+		LastUsed:   token.LastUsed,
+	}
+}
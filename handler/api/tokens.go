@@ -0,0 +1,67 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/VolticFroogo/Bernies-Busy-Bees/db"
+	"github.com/VolticFroogo/Bernies-Busy-Bees/handler/users"
+	"github.com/VolticFroogo/Bernies-Busy-Bees/models"
+)
+
+func listTokens(w http.ResponseWriter, r *http.Request, current models.User) {
+	tokens, err := db.GetAccessTokens(current.UUID)
+	if err != nil {
+		internalError(w, "Getting access tokens error", err)
+		return
+	}
+
+	list := []accessToken{}
+	for _, token := range tokens {
+		list = append(list, newToken(token))
+	}
+
+	writeJSON(w, http.StatusOK, list)
+}
+
+func createToken(w http.ResponseWriter, r *http.Request, current models.User) {
+	var data accessTokenCreate
+	if !decode(w, r, &data) {
+		return
+	}
+
+	tokenString, token, err := users.NewAccessToken(current, data.Name, data.Scopes)
+	if err == users.ErrInvalidAccessToken {
+		writeError(w, http.StatusBadRequest, "A token needs a name of up to 64 characters and at least one scope you're allowed to give it.")
+		return
+	}
+	if err != nil {
+		internalError(w, "Creating access token error", err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusCreated, newAccessToken{
+		Token:       tokenString,
+		AccessToken: newToken(token),
+	})
+}
+
+func deleteToken(w http.ResponseWriter, r *http.Request, current models.User) {
+	id, ok := pathInt(w, r, "tokenID")
+	if !ok {
+		return
+	}
+
+	deleted, err := db.DeleteAccessToken(id, current.UUID)
+	if err != nil {
+		internalError(w, "Deleting access token error", err)
+		return
+	}
+
+	if !deleted {
+		writeError(w, http.StatusNotFound, "You don't have an access token with this ID.")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,299 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/VolticFroogo/Bernies-Busy-Bees/db"
+	"github.com/VolticFroogo/Bernies-Busy-Bees/handler/users"
+	"github.com/VolticFroogo/Bernies-Busy-Bees/helpers"
+	"github.com/VolticFroogo/Bernies-Busy-Bees/middleware"
+	"github.com/VolticFroogo/Bernies-Busy-Bees/middleware/myJWT"
+	"github.com/VolticFroogo/Bernies-Busy-Bees/models"
+)
+
+// existingUser returns the user with the ID in the path, replying with a not found error if there isn't one.
+func existingUser(w http.ResponseWriter, r *http.Request) (u models.User, ok bool) {
+	id, ok := pathInt(w, r, "userID")
+	if !ok {
+		return
+	}
+
+	u, err := db.GetUserFromID(id)
+	if err != nil {
+		internalError(w, "Error getting user from ID", err)
+		return u, false
+	}
+
+	if u.CreateTime == "" {
+		writeError(w, http.StatusNotFound, "There is no user with this ID.")
+		return u, false
+	}
+
+	return u, true
+}
+
+// emailTaken returns if another user already has an email, replying with an error if they do.
+func emailTaken(w http.ResponseWriter, email string, uuid int) bool {
+	owner, err := db.GetUserFromEmail(email)
+	if err != nil {
+		internalError(w, "Error getting user from email", err)
+		return true
+	}
+
+	if owner.UUID != 0 && owner.UUID != uuid {
+		writeError(w, http.StatusConflict, "Another user already has this email.")
+		return true
+	}
+
+	return false
+}
+
+func listUsers(w http.ResponseWriter, r *http.Request, current models.User) {
+	list := []user{}
+	for _, u := range db.Users() {
+		list = append(list, newUser(u))
+	}
+
+	writeJSON(w, http.StatusOK, list)
+}
+
+func getUser(w http.ResponseWriter, r *http.Request, current models.User) {
+	u, ok := existingUser(w, r)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newUser(u))
+}
+
+// inviteUser invites an email address rather than creating the user, so nobody else ever knows their password.
+func inviteUser(w http.ResponseWriter, r *http.Request, current models.User) {
+	var data invitationCreate
+	if !decode(w, r, &data) {
+		return
+	}
+
+	data.Email = strings.TrimSpace(data.Email)
+	if data.Email == "" || helpers.CheckEmail(data.Email) != nil || !db.RoleExists(data.RoleID) {
+		writeError(w, http.StatusBadRequest, "An invitation needs a valid email and an existing role.")
+		return
+	}
+
+	if !users.CanGrantRole(current, data.RoleID) {
+		writeError(w, http.StatusForbidden, "You can't give a role with permissions you don't have.")
+		return
+	}
+
+	if emailTaken(w, data.Email, 0) {
+		return
+	}
+
+	i, err := users.Invite(data.Email, data.RoleID, current)
+	if err != nil {
+		internalError(w, "Inviting user error", err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, newInvitation(i))
+}
+
+func updateUser(w http.ResponseWriter, r *http.Request, current models.User) {
+	u, ok := existingUser(w, r)
+	if !ok {
+		return
+	}
+
+	if !users.CanGrantRole(current, u.Role.ID) {
+		writeError(w, http.StatusForbidden, "You can't change a user whose role has permissions you don't have.")
+		return
+	}
+
+	var data userPatch
+	if !decode(w, r, &data) {
+		return
+	}
+
+	if data.Email != nil {
+		if *data.Email == "" {
+			writeError(w, http.StatusBadRequest, "A user needs an email.")
+			return
+		}
+
+		if emailTaken(w, *data.Email, u.UUID) {
+			return
+		}
+
+		u.Email = *data.Email
+	}
+	if data.FirstName != nil {
+		u.Fname = *data.FirstName
+	}
+	if data.LastName != nil {
+		u.Lname = *data.LastName
+	}
+	if data.RoleID != nil {
+		if !db.RoleExists(*data.RoleID) {
+			writeError(w, http.StatusBadRequest, "There is no role with this ID.")
+			return
+		}
+
+		if !users.CanGrantRole(current, *data.RoleID) {
+			writeError(w, http.StatusForbidden, "You can't give a role with permissions you don't have.")
+			return
+		}
+
+		u.Role = db.GetRole(*data.RoleID)
+	}
+
+	var err error
+	if data.Password == nil {
+		err = db.EditUserNoPassword(u.UUID, u.Email, u.Fname, u.Lname, u.Role.ID)
+	} else {
+		if *data.Password == "" {
+			writeError(w, http.StatusBadRequest, "A password can't be empty.")
+			return
+		}
+
+		var password string
+		password, err = helpers.HashPassword(*data.Password)
+		if err != nil {
+			internalError(w, "Hashing password error", err)
+			return
+		}
+
+		err = db.EditUser(u.UUID, u.Email, password, u.Fname, u.Lname, u.Role.ID)
+	}
+	if err != nil {
+		internalError(w, "Editing user error", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newUser(u))
+}
+
+func listRoles(w http.ResponseWriter, r *http.Request, current models.User) {
+	list := []role{}
+	for _, r := range db.Roles() {
+		list = append(list, newRole(r))
+	}
+
+	writeJSON(w, http.StatusOK, list)
+}
+
+func deleteUser(w http.ResponseWriter, r *http.Request, current models.User) {
+	u, ok := existingUser(w, r)
+	if !ok {
+		return
+	}
+
+	if u.UUID == current.UUID {
+		writeError(w, http.StatusBadRequest, "You can't delete yourself.")
+		return
+	}
+
+	if !users.CanGrantRole(current, u.Role.ID) {
+		writeError(w, http.StatusForbidden, "You can't delete a user whose role has permissions you don't have.")
+		return
+	}
+
+	err := db.DeleteUser(u.UUID)
+	if err != nil {
+		internalError(w, "Deleting user error", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func getSelf(w http.ResponseWriter, r *http.Request, current models.User) {
+	writeJSON(w, http.StatusOK, newUser(current))
+}
+
+func updateSelf(w http.ResponseWriter, r *http.Request, current models.User) {
+	var data selfPatch
+	if !decode(w, r, &data) {
+		return
+	}
+
+	if data.FirstName != nil {
+		current.Fname = *data.FirstName
+	}
+	if data.LastName != nil {
+		current.Lname = *data.LastName
+	}
+
+	// Check everything before saving anything, so a refused request changes nothing.
+	// The email only changes once the new address has been verified.
+	changeEmail := data.Email != nil && *data.Email != current.Email
+	if changeEmail {
+		if helpers.CheckEmail(*data.Email) != nil {
+			writeError(w, http.StatusBadRequest, "The email isn't valid.")
+			return
+		}
+
+		if emailTaken(w, *data.Email, current.UUID) {
+			return
+		}
+	}
+
+	var password string
+	if data.Password != nil {
+		if *data.Password == "" {
+			writeError(w, http.StatusBadRequest, "A password can't be empty.")
+			return
+		}
+
+		var err error
+		password, err = helpers.HashPassword(*data.Password)
+		if err != nil {
+			internalError(w, "Hashing password error", err)
+			return
+		}
+	}
+
+	var err error
+	if data.Password == nil {
+		err = db.EditSelfNoPassword(current.UUID, current.Fname, current.Lname)
+	} else {
+		err = db.EditSelf(current.UUID, password, current.Fname, current.Lname)
+	}
+	if err != nil {
+		internalError(w, "Editing user error", err)
+		return
+	}
+
+	if changeEmail {
+		err = users.SendEmailVerification(current, *data.Email)
+		if err != nil {
+			internalError(w, "Sending verification email error", err)
+			return
+		}
+	}
+
+	response := selfUpdate{User: newUser(current)}
+	if data.Password != nil {
+		// Changing the password logged out every token, including this request's, so keep the caller logged in.
+		authTokenString, refreshTokenString, csrfSecret, err := myJWT.CreateNewTokens(strconv.Itoa(current.UUID), r)
+		if err != nil {
+			internalError(w, "Creating tokens error", err)
+			return
+		}
+
+		if _, bearer, _ := middleware.Bearer(r); bearer {
+			response.Tokens = &tokens{
+				TokenType:    "Bearer",
+				AuthToken:    authTokenString,
+				RefreshToken: refreshTokenString,
+				ExpiresIn:    int(models.AuthTokenValidTime.Seconds()),
+			}
+		} else {
+			middleware.WriteNewAuth(w, r, authTokenString, refreshTokenString, csrfSecret)
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
@@ -0,0 +1,238 @@
+package feed
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/xml"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/VolticFroogo/Bernies-Busy-Bees/db"
+	"github.com/VolticFroogo/Bernies-Busy-Bees/helpers"
+	"github.com/VolticFroogo/Bernies-Busy-Bees/models"
+)
+
+/*
+	Structs and variables
+*/
+
+const (
+	title       = "Bernie's Busy Bees"
+	description = "The latest activities at Bernie's Busy Bees childcare in Newcastle-under-Lyme."
+	// amount is how many of the latest posts are in the feeds.
+	amount = 20
+	// maxAge is how long clients may cache a feed for.
+	maxAge = 5 * time.Minute
+)
+
+type rss struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string        `xml:"title"`
+	Link        string        `xml:"link"`
+	GUID        string        `xml:"guid"`
+	Description string        `xml:"description"`
+	PubDate     string        `xml:"pubDate"`
+	Enclosure   *rssEnclosure `xml:"enclosure,omitempty"`
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length int64  `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+type atom struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Author  atomAuthor  `xml:"author"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Href   string `xml:"href,attr"`
+	Rel    string `xml:"rel,attr,omitempty"`
+	Type   string `xml:"type,attr,omitempty"`
+	Length int64  `xml:"length,attr,omitempty"`
+}
+
+type atomEntry struct {
+	Title     string     `xml:"title"`
+	ID        string     `xml:"id"`
+	Published string     `xml:"published"`
+	Updated   string     `xml:"updated"`
+	Summary   string     `xml:"summary"`
+	Links     []atomLink `xml:"link"`
+}
+
+// cachedFeed is a rendered feed along with the time of the posts it was rendered from.
+type cachedFeed struct {
+	body    []byte
+	etag    string
+	updated time.Time
+}
+
+var (
+	mutex sync.Mutex
+	feeds = make(map[string]cachedFeed)
+)
+
+/*
+	Handlers
+*/
+
+// RSS is the handler for the RSS feed of published posts.
+func RSS(w http.ResponseWriter, r *http.Request) {
+	serve(w, r, "rss", "application/rss+xml; charset=utf-8", renderRSS)
+}
+
+// Atom is the handler for the Atom feed of published posts.
+func Atom(w http.ResponseWriter, r *http.Request) {
+	serve(w, r, "atom", "application/atom+xml; charset=utf-8", renderAtom)
+}
+
+// serve writes a feed, rendering it again only if the posts have changed since it was cached.
+func serve(w http.ResponseWriter, r *http.Request, name, contentType string, render func(posts models.Posts, updated time.Time) ([]byte, error)) {
+	mutex.Lock()
+	feed, ok := feeds[name]
+	if !ok || !feed.updated.Equal(db.PostsUpdated()) {
+		updated := db.PostsUpdated()
+
+		posts, err := db.GetPosts(amount, amount, 1, false)
+		if err != nil {
+			mutex.Unlock()
+			helpers.ThrowErr(w, r, "Getting posts error", err)
+			return
+		}
+
+		body, err := render(posts, updated)
+		if err != nil {
+			mutex.Unlock()
+			helpers.ThrowErr(w, r, "Rendering feed error", err)
+			return
+		}
+
+		hash := sha1.Sum(body)
+		feed = cachedFeed{
+			body:    body,
+			etag:    `"` + hex.EncodeToString(hash[:]) + `"`,
+			updated: updated,
+		}
+		feeds[name] = feed
+	}
+	mutex.Unlock()
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(int(maxAge.Seconds())))
+	w.Header().Set("ETag", feed.etag)
+
+	// ServeContent answers conditional requests with a 304 using the ETag and modification time.
+	http.ServeContent(w, r, "", feed.updated, bytes.NewReader(feed.body))
+}
+
+/*
+	Rendering
+*/
+
+func renderRSS(posts models.Posts, updated time.Time) (body []byte, err error) {
+	feed := rss{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title:         title,
+			Link:          models.SiteURL + "/",
+			Description:   description,
+			LastBuildDate: updated.UTC().Format(time.RFC1123Z),
+		},
+	}
+
+	for _, post := range posts {
+		item := rssItem{
+			Title:       post.Title,
+			Link:        models.SiteURL + post.URL(),
+			GUID:        models.SiteURL + "/post/" + strconv.Itoa(post.ID), // Stays the same if the title changes.
+			Description: post.Description,
+			PubDate:     time.Unix(post.PublishTime, 0).UTC().Format(time.RFC1123Z),
+		}
+
+		if len(post.Images) != 0 {
+			item.Enclosure = &rssEnclosure{
+				URL:    post.Images[0].URL(),
+				Length: post.Images[0].Size,
+				Type:   post.Images[0].ContentType,
+			}
+		}
+
+		feed.Channel.Items = append(feed.Channel.Items, item)
+	}
+
+	return marshal(feed)
+}
+
+func renderAtom(posts models.Posts, updated time.Time) (body []byte, err error) {
+	feed := atom{
+		Title:   title,
+		ID:      models.SiteURL + "/",
+		Updated: updated.UTC().Format(time.RFC3339),
+		Author:  atomAuthor{Name: title},
+		Links: []atomLink{
+			{Href: models.SiteURL + "/"},
+			{Href: models.SiteURL + "/feed.atom", Rel: "self"},
+		},
+	}
+
+	for _, post := range posts {
+		published := time.Unix(post.PublishTime, 0).UTC().Format(time.RFC3339)
+		entry := atomEntry{
+			Title:     post.Title,
+			ID:        models.SiteURL + "/post/" + strconv.Itoa(post.ID),
+			Published: published,
+			Updated:   published,
+			Summary:   post.Description,
+			Links:     []atomLink{{Href: models.SiteURL + post.URL()}},
+		}
+
+		if len(post.Images) != 0 {
+			entry.Links = append(entry.Links, atomLink{
+				Href:   post.Images[0].URL(),
+				Rel:    "enclosure",
+				Type:   post.Images[0].ContentType,
+				Length: post.Images[0].Size,
+			})
+		}
+
+		feed.Entries = append(feed.Entries, entry)
+	}
+
+	return marshal(feed)
+}
+
+func marshal(feed interface{}) (body []byte, err error) {
+	body, err = xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return
+	}
+
+	return append([]byte(xml.Header), body...), nil
+}
@@ -5,10 +5,12 @@ import (
 	"html/template"
 	"log"
 	"net/http"
-	"os"
 	"strconv"
+	"time"
 
 	"github.com/VolticFroogo/Bernies-Busy-Bees/db"
+	"github.com/VolticFroogo/Bernies-Busy-Bees/handler/api"
+	"github.com/VolticFroogo/Bernies-Busy-Bees/handler/feed"
 	"github.com/VolticFroogo/Bernies-Busy-Bees/handler/post"
 	"github.com/VolticFroogo/Bernies-Busy-Bees/handler/recovery"
 	"github.com/VolticFroogo/Bernies-Busy-Bees/handler/users"
@@ -16,75 +18,103 @@ import (
 	"github.com/VolticFroogo/Bernies-Busy-Bees/middleware"
 	"github.com/VolticFroogo/Bernies-Busy-Bees/middleware/myJWT"
 	"github.com/VolticFroogo/Bernies-Busy-Bees/models"
-	"github.com/go-recaptcha/recaptcha"
-	"github.com/gorilla/context"
 	"github.com/gorilla/mux"
 	"github.com/urfave/negroni"
 )
 
-var (
-	captchaSecret = os.Getenv("CAPTCHA_SECRET")
-	captcha       = recaptcha.New(captchaSecret)
-)
-
 type loginData struct {
 	Email, Password, Captcha string
 }
 
-// Start the server by handling the web server.
-func Start() {
+type twoFactorLoginData struct {
+	Challenge, Code string
+}
+
+type passkeyLoginData struct {
+	// Challenge is the two-factor challenge when a passkey is used after a password.
+	Challenge string
+	users.PasskeyAssertion
+}
+
+// Start the server by handling the web server, checking CAPTCHAs with captcha.
+func Start(captcha helpers.Captcha) {
 	r := mux.NewRouter()
 	r.StrictSlash(true)
 
 	r.Handle("/", http.HandlerFunc(index))
 
-	r.Handle("/login", http.HandlerFunc(login)).Methods(http.MethodPost)
+	r.Handle("/posts/{page}", http.HandlerFunc(post.PublicPosts))
+	r.Handle("/post/{postID}", http.HandlerFunc(post.PublicPost))
+	r.Handle("/post/{postID}/{slug}", http.HandlerFunc(post.PublicPost))
+
+	r.Handle("/feed.rss", http.HandlerFunc(feed.RSS))
+	r.Handle("/feed.atom", http.HandlerFunc(feed.Atom))
 
-	r.Handle("/logout", negroni.New(
-		negroni.HandlerFunc(middleware.Form),
-		negroni.Wrap(http.HandlerFunc(logout)),
-	))
+	r.Handle("/login", login(captcha)).Methods(http.MethodPost)
+	r.Handle("/login/two-factor", http.HandlerFunc(loginTwoFactor)).Methods(http.MethodPost)
+	r.Handle("/login/passkey/begin", http.HandlerFunc(loginPasskeyBegin)).Methods(http.MethodPost)
+	r.Handle("/login/passkey", http.HandlerFunc(loginPasskey)).Methods(http.MethodPost)
 
-	r.Handle("/panel", negroni.New(
-		negroni.HandlerFunc(middleware.Panel),
-		negroni.Wrap(http.HandlerFunc(panel)),
-	))
+	r.Handle("/captcha", captchaWidget(captcha.Widget)).Methods(http.MethodGet)
 
-	r.Handle("/panel/posts/{page}", negroni.New(
-		negroni.HandlerFunc(middleware.Panel),
-		negroni.Wrap(http.HandlerFunc(post.Posts)),
-	))
+	r.Handle("/.well-known/jwks.json", http.HandlerFunc(jwks)).Methods(http.MethodGet)
 
-	r.Handle("/panel/post/new", negroni.New(
-		negroni.HandlerFunc(middleware.Panel),
-		negroni.Wrap(http.HandlerFunc(post.NewPage)),
-	)).Methods(http.MethodGet)
+	r.Handle("/logout", protect(middleware.Form(""), logout))
 
-	r.Handle("/panel/post/new", negroni.New(
-		negroni.HandlerFunc(middleware.Panel),
-		negroni.Wrap(http.HandlerFunc(post.New)),
-	)).Methods(http.MethodPost)
+	r.Handle("/panel", protect(middleware.Page(models.PermPanel), panel))
 
-	r.Handle("/panel/settings/update", http.HandlerFunc(users.Settings))
+	r.Handle("/panel/posts/{page}", protect(middleware.Page(models.PermPanel), post.Posts))
 
-	r.Handle("/panel/user/new", http.HandlerFunc(users.New))
-	r.Handle("/panel/user/update", http.HandlerFunc(users.Update))
-	r.Handle("/panel/user/delete", http.HandlerFunc(users.Delete))
+	r.Handle("/panel/post/new", protect(middleware.Page(models.PermPostsCreate), post.NewPage)).Methods(http.MethodGet)
+	r.Handle("/panel/post/new", protect(middleware.AJAX(models.PermPostsCreate), post.New)).Methods(http.MethodPost)
 
-	r.Handle("/panel/post/update", http.HandlerFunc(post.Update))
-	r.Handle("/panel/post/delete", http.HandlerFunc(post.Delete))
+	r.Handle("/panel/settings/update", protect(middleware.AJAX(""), users.Settings))
+	r.Handle("/panel/settings/token/new", protect(middleware.AJAX(""), users.TokenNew))
+	r.Handle("/panel/settings/token/delete", protect(middleware.AJAX(""), users.TokenDelete))
+	r.Handle("/panel/settings/session/delete", protect(middleware.AJAX(""), users.SessionDelete))
+	r.Handle("/panel/settings/session/delete-all", protect(middleware.AJAX(""), users.SessionDeleteAll))
+	r.Handle("/panel/settings/two-factor/new", protect(middleware.AJAX(""), users.TwoFactorNew))
+	r.Handle("/panel/settings/two-factor/enable", protect(middleware.AJAX(""), users.TwoFactorEnable))
+	r.Handle("/panel/settings/two-factor/disable", protect(middleware.AJAX(""), users.TwoFactorDisable))
+	r.Handle("/panel/settings/two-factor/recovery-codes", protect(middleware.AJAX(""), users.TwoFactorRecoveryCodes))
+	r.Handle("/panel/settings/passkey/begin", protect(middleware.AJAX(""), users.PasskeyBegin))
+	r.Handle("/panel/settings/passkey/new", protect(middleware.AJAX(""), users.PasskeyNew))
+	r.Handle("/panel/settings/passkey/delete", protect(middleware.AJAX(""), users.PasskeyDelete))
 
-	r.Handle("/panel/post/comment", http.HandlerFunc(post.Comment))
-	r.Handle("/panel/post/comment/delete", http.HandlerFunc(post.CommentDelete))
+	r.Handle("/panel/user/update", protect(middleware.AJAX(models.PermUsersManage), users.Update))
+	r.Handle("/panel/user/delete", protect(middleware.AJAX(models.PermUsersManage), users.Delete))
+	r.Handle("/panel/user/sessions/delete", protect(middleware.AJAX(models.PermUsersManage), users.UserSessionsDelete))
+	r.Handle("/panel/registration/approve", protect(middleware.AJAX(models.PermUsersManage), users.RegistrationApprove))
+	r.Handle("/panel/registration/reject", protect(middleware.AJAX(models.PermUsersManage), users.RegistrationReject))
+	r.Handle("/panel/invitation/new", protect(middleware.AJAX(models.PermUsersManage), users.InvitationNew))
+	r.Handle("/panel/invitation/resend", protect(middleware.AJAX(models.PermUsersManage), users.InvitationResend))
+	r.Handle("/panel/invitation/revoke", protect(middleware.AJAX(models.PermUsersManage), users.InvitationRevoke))
 
-	r.Handle("/panel/post/{postID}", negroni.New(
-		negroni.HandlerFunc(middleware.Panel),
-		negroni.Wrap(http.HandlerFunc(post.Post)),
-	))
+	r.Handle("/panel/role/new", protect(middleware.AJAX(models.PermRolesManage), users.RoleNew))
+	r.Handle("/panel/role/update", protect(middleware.AJAX(models.PermRolesManage), users.RoleUpdate))
+	r.Handle("/panel/role/delete", protect(middleware.AJAX(models.PermRolesManage), users.RoleDelete))
+
+	r.Handle("/panel/lockout/clear", protect(middleware.AJAX(models.PermLockoutsManage), users.LockoutClear))
+
+	r.Handle("/panel/post/update", protect(middleware.AJAX(models.PermPostsEdit), post.Update))
+	r.Handle("/panel/post/delete", protect(middleware.AJAX(models.PermPostsDelete), post.Delete))
+	r.Handle("/panel/post/status/update", protect(middleware.AJAX(models.PermPostsEdit), post.StatusUpdate))
+	r.Handle("/panel/post/image/update", protect(middleware.AJAX(models.PermPostsEdit), post.ImageUpdate))
+
+	// Editing and deleting comments also depends on whose comment it is, which the handlers check.
+	r.Handle("/panel/post/comment", protect(middleware.AJAX(models.PermCommentsCreate), post.Comment))
+	r.Handle("/panel/post/comment/update", protect(middleware.AJAX(models.PermPanel), post.CommentUpdate))
+	r.Handle("/panel/post/comment/delete", protect(middleware.AJAX(models.PermPanel), post.CommentDelete))
+
+	r.Handle("/panel/post/{postID}", protect(middleware.Page(models.PermPanel), post.Post))
 
 	r.Handle("/verify-email/{code}", http.HandlerFunc(users.VerifyEmail))
-	r.Handle("/forgot-password", http.HandlerFunc(recovery.Begin)).Methods(http.MethodPost)
-	r.Handle("/password-recovery", http.HandlerFunc(recovery.End)).Methods(http.MethodPost)
+	r.Handle("/register", users.Register(captcha)).Methods(http.MethodPost)
+	r.Handle("/invitation", http.HandlerFunc(users.InvitationAccept)).Methods(http.MethodPost)
+	r.Handle("/forgot-password", recovery.Begin(captcha)).Methods(http.MethodPost)
+	r.Handle("/password-recovery", recovery.End(captcha)).Methods(http.MethodPost)
+
+	api.Route(r)
 
 	r.PathPrefix("/").Handler(http.FileServer(http.Dir("./static/")))
 
@@ -92,6 +122,11 @@ func Start() {
 	http.ListenAndServe(":81", r)
 }
 
+// protect only lets a request through to a handler once the middleware has authorized it.
+func protect(auth negroni.HandlerFunc, handler http.HandlerFunc) http.Handler {
+	return negroni.New(auth, negroni.Wrap(handler))
+}
+
 func index(w http.ResponseWriter, r *http.Request) {
 	t, err := template.ParseFiles("handler/templates/index.html", "handler/templates/nested.html") // Parse the HTML pages
 	if err != nil {
@@ -100,7 +135,7 @@ func index(w http.ResponseWriter, r *http.Request) {
 	}
 
 	variables := models.TemplateVariables{
-		Posts: db.IndexPosts,
+		Posts: db.IndexPosts(),
 	}
 	err = t.Execute(w, variables) // Execute temmplate with variables
 	if err != nil {
@@ -109,61 +144,94 @@ func index(w http.ResponseWriter, r *http.Request) {
 }
 
 func panel(w http.ResponseWriter, r *http.Request) {
-	uuidString := context.Get(r, "uuid").(string)
-	uuid, err := strconv.Atoi(uuidString)
+	user := middleware.User(r)
+
+	t, err := template.ParseFiles("handler/templates/panel/panel.html", "handler/templates/nested.html") // Parse the HTML pages
 	if err != nil {
-		helpers.ThrowErr(w, r, "Error converting string to int", err)
+		helpers.ThrowErr(w, r, "Template parsing error", err)
 		return
 	}
 
-	user, err := db.GetUserFromID(uuid)
+	csrfSecret, err := r.Cookie("csrfSecret")
 	if err != nil {
-		helpers.ThrowErr(w, r, "Error getting user from ID", err)
+		helpers.ThrowErr(w, r, "Reading cookie error", err)
 		return
 	}
 
-	switch user.Priv {
-	case models.PrivUser, models.PrivAdmin, models.PrivSuperAdmin:
-		execPanel(w, r, user, "panel")
+	posts, err := db.GetPosts(6, 6, 1, models.Authorize(user, models.PermPostsUnpublished))
+	if err != nil {
+		helpers.ThrowErr(w, r, "Getting posts error", err)
+		return
+	}
 
-	default:
-		execPanel(w, r, user, "no-priv")
+	accessTokens, err := db.GetAccessTokens(user.UUID)
+	if err != nil {
+		helpers.ThrowErr(w, r, "Getting access tokens error", err)
+		return
 	}
-}
 
-func execPanel(w http.ResponseWriter, r *http.Request, user models.User, templateName string) {
-	t, err := template.ParseFiles("handler/templates/panel/"+templateName+".html", "handler/templates/nested.html") // Parse the HTML pages
+	sessions, err := users.Sessions(r, user.UUID)
 	if err != nil {
-		helpers.ThrowErr(w, r, "Template parsing error", err)
+		helpers.ThrowErr(w, r, "Getting sessions error", err)
 		return
 	}
 
-	csrfSecret, err := r.Cookie("csrfSecret")
+	recoveryCodes, err := db.CountRecoveryCodes(user.UUID)
 	if err != nil {
-		helpers.ThrowErr(w, r, "Reading cookie error", err)
+		helpers.ThrowErr(w, r, "Counting recovery codes error", err)
 		return
 	}
 
-	posts, err := db.GetPosts(6, 6, 1)
+	passkeys, err := db.GetPasskeys(user.UUID)
 	if err != nil {
-		helpers.ThrowErr(w, r, "Getting posts error", err)
+		helpers.ThrowErr(w, r, "Getting passkeys error", err)
 		return
 	}
 
-	for i := 0; i < len(posts); i++ {
-		post := &posts[i]
-		err = json.Unmarshal([]byte(post.ImagesJSON), &post.Images)
+	var loginFailures []models.LoginFailure
+	if models.Authorize(user, models.PermLockoutsManage) {
+		loginFailures, err = db.GetLoginFailures()
 		if err != nil {
-			helpers.ThrowErr(w, r, "Unmarshalling images error", err)
+			helpers.ThrowErr(w, r, "Getting login failures error", err)
 			return
 		}
 	}
 
+	var registrations, manageable models.Users
+	var invitations []models.Invitation
+	if models.Authorize(user, models.PermUsersManage) {
+		invitations, err = db.GetInvitations()
+		if err != nil {
+			helpers.ThrowErr(w, r, "Getting invitations error", err)
+			return
+		}
+
+		for _, u := range db.Users() {
+			if u.Registration == models.RegistrationPending {
+				registrations = append(registrations, u)
+			} else if users.CanGrantRole(user, u.Role.ID) {
+				manageable = append(manageable, u) // Users with more permissions than them can't be changed.
+			}
+		}
+	}
+
 	variables := models.TemplateVariables{
-		User:       user,
-		CsrfSecret: csrfSecret.Value,
-		Users:      db.Users,
-		Posts:      posts,
+		User:           user,
+		CsrfSecret:     csrfSecret.Value,
+		Users:          manageable,
+		Registrations:  registrations,
+		Posts:          posts,
+		UnixTime:       time.Now().Unix(),
+		AccessTokens:   accessTokens,
+		Sessions:       sessions,
+		RecoveryCodes:  recoveryCodes,
+		Passkeys:       passkeys,
+		LoginFailures:  loginFailures,
+		Invitations:    invitations,
+		Scopes:         users.GrantableScopes(user),
+		Roles:          db.Roles(),
+		GrantableRoles: users.GrantableRoles(user),
+		Permissions:    models.Permissions,
 	}
 	err = t.Execute(w, variables) // Execute temmplate with variables
 	if err != nil {
@@ -171,6 +239,29 @@ func execPanel(w http.ResponseWriter, r *http.Request, user models.User, templat
 	}
 }
 
+// jwks publishes the public keys tokens are signed with.
+func jwks(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+
+	err := helpers.JSONResponse(myJWT.JWKS(), w)
+	if err != nil {
+		helpers.ThrowErr(w, r, "Sending JSON response error", err)
+	}
+}
+
+// captchaWidget tells the login, register and password recovery pages which CAPTCHA to show.
+func captchaWidget(widget helpers.CaptchaWidget) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		err := helpers.JSONResponse(widget, w)
+		if err != nil {
+			helpers.ThrowErr(w, r, "Sending JSON response error", err)
+		}
+	}
+}
+
 func logout(w http.ResponseWriter, r *http.Request) {
 	refreshTokenString, err := r.Cookie("refreshToken")
 	if err != nil {
@@ -178,59 +269,335 @@ func logout(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	myJWT.DeleteJTI(refreshTokenString.Value) // Remove their old Refresh Token.
+	myJWT.DeleteJTI(refreshTokenString.Value) // Revoke every refresh token from this login.
 
 	middleware.WriteNewAuth(w, r, "", "", "")
 
 	middleware.RedirectToLogin(w, r)
 }
 
-func login(w http.ResponseWriter, r *http.Request) {
-	var credentials loginData                           // Create struct to store data.
-	err := json.NewDecoder(r.Body).Decode(&credentials) // Decode response to struct.
+// login returns the handler for the login page, checking CAPTCHAs with captcha.
+func login(captcha helpers.CaptchaVerifier) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var credentials loginData                           // Create struct to store data.
+		err := json.NewDecoder(r.Body).Decode(&credentials) // Decode response to struct.
+		if err != nil {
+			helpers.SuccessResponse(false, w, r)
+			helpers.ThrowErr(w, r, "JSON decoding error", err)
+			return
+		}
+
+		ip := helpers.ClientIP(r)
+		captchaSuccess, err := captcha.Verify(credentials.Captcha, ip) // Check the captcha.
+		if err != nil {
+			helpers.SuccessResponse(false, w, r)
+			helpers.ThrowErr(w, r, "Captcha error", err)
+			return
+		}
+		if !captchaSuccess {
+			helpers.SuccessResponse(false, w, r)
+			return // Unsuccessful captcha.
+		}
+
+		retryAfter, err := users.LoginLocked(credentials.Email, ip)
+		if err != nil {
+			helpers.SuccessResponse(false, w, r)
+			helpers.ThrowErr(w, r, "Checking login lockout error", err)
+			return
+		}
+		if retryAfter > 0 {
+			loginLocked(w, r, retryAfter)
+			return // Too many failed logins.
+		}
+
+		user, err := db.GetUserFromEmail(credentials.Email)
+		if err != nil {
+			helpers.SuccessResponse(false, w, r)
+			helpers.ThrowErr(w, r, "Getting user from DB error", err)
+			return
+		}
+
+		valid := helpers.CheckPassword(credentials.Password, user.Password)
+
+		if valid && user.HasTwoFactor() {
+			// The user isn't logged in until they send a code or use a passkey along with this challenge.
+			challenge, err := myJWT.CreateChallengeToken(strconv.Itoa(user.UUID))
+			if err != nil {
+				helpers.SuccessResponse(false, w, r)
+				helpers.ThrowErr(w, r, "Creating two-factor challenge error", err)
+				return
+			}
+
+			err = helpers.JSONResponse(models.TwoFactorChallenge{
+				TwoFactor: true,
+				Challenge: challenge,
+				Code:      user.TwoFactor,
+			}, w)
+			if err != nil {
+				helpers.ThrowErr(w, r, "Sending JSON response error", err)
+			}
+			return
+		}
+
+		if valid {
+			err = users.LoginSucceeded(user.Email)
+			if err != nil {
+				helpers.SuccessResponse(false, w, r)
+				helpers.ThrowErr(w, r, "Clearing login failures error", err)
+				return
+			}
+
+			authTokenString, refreshTokenString, csrfSecret, err := myJWT.CreateNewTokens(strconv.Itoa(user.UUID), r)
+			if err != nil {
+				helpers.SuccessResponse(false, w, r)
+				helpers.ThrowErr(w, r, "Creating tokens error", err)
+				return
+			}
+
+			middleware.WriteNewAuth(w, r, authTokenString, refreshTokenString, csrfSecret)
+
+			helpers.SuccessResponse(true, w, r)
+			return
+		}
+
+		err = users.LoginFailed(credentials.Email, ip)
+		if err != nil {
+			helpers.SuccessResponse(false, w, r)
+			helpers.ThrowErr(w, r, "Counting login failure error", err)
+			return
+		}
+
+		helpers.SuccessResponse(false, w, r)
+	}
+}
+
+// loginLocked responds to a login while the account or IP address is locked after too many failures.
+func loginLocked(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	seconds := int64(retryAfter / time.Second)
+	w.Header().Set("Retry-After", strconv.FormatInt(seconds, 10))
+
+	err := helpers.JSONResponse(models.LoginLocked{
+		Locked:     true,
+		RetryAfter: seconds,
+	}, w)
+	if err != nil {
+		helpers.ThrowErr(w, r, "Sending JSON response error", err)
+	}
+}
+
+// loginTwoFactor is the second step of logging in for users with two-factor authentication.
+func loginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var data twoFactorLoginData                  // Create struct to store data.
+	err := json.NewDecoder(r.Body).Decode(&data) // Decode response to struct.
 	if err != nil {
 		helpers.SuccessResponse(false, w, r)
 		helpers.ThrowErr(w, r, "JSON decoding error", err)
 		return
 	}
 
-	if credentials.Captcha == "" {
+	valid, uuidString := myJWT.CheckChallengeToken(data.Challenge)
+	if !valid {
 		helpers.SuccessResponse(false, w, r)
-		return // There is no captcha response.
+		return // The challenge is invalid or has expired.
 	}
-	captchaSuccess, err := captcha.Verify(credentials.Captcha, r.Header.Get("CF-Connecting-IP")) // Check the captcha.
+
+	uuid, err := strconv.Atoi(uuidString)
 	if err != nil {
 		helpers.SuccessResponse(false, w, r)
-		helpers.ThrowErr(w, r, "Recaptcha error", err)
 		return
 	}
-	if !captchaSuccess {
+
+	user, err := db.GetUserFromID(uuid)
+	if err != nil {
 		helpers.SuccessResponse(false, w, r)
-		return // Unsuccessful captcha.
+		helpers.ThrowErr(w, r, "Getting user from DB error", err)
+		return
 	}
 
-	user, err := db.GetUserFromEmail(credentials.Email)
+	// Wrong codes count towards the same lockout as wrong passwords.
+	ip := helpers.ClientIP(r)
+	retryAfter, err := users.LoginLocked(user.Email, ip)
 	if err != nil {
 		helpers.SuccessResponse(false, w, r)
-		helpers.ThrowErr(w, r, "Getting user from DB error", err)
+		helpers.ThrowErr(w, r, "Checking login lockout error", err)
 		return
 	}
+	if retryAfter > 0 {
+		loginLocked(w, r, retryAfter)
+		return // Too many failed logins.
+	}
 
-	valid := helpers.CheckPassword(credentials.Password, user.Password)
+	valid, err = users.CheckTwoFactor(uuid, data.Code)
+	if err != nil {
+		helpers.SuccessResponse(false, w, r)
+		helpers.ThrowErr(w, r, "Checking two-factor code error", err)
+		return
+	}
+
+	if !valid {
+		err = users.LoginFailed(user.Email, ip)
+		if err != nil {
+			helpers.SuccessResponse(false, w, r)
+			helpers.ThrowErr(w, r, "Counting login failure error", err)
+			return
+		}
+
+		helpers.SuccessResponse(false, w, r)
+		return
+	}
+
+	err = users.LoginSucceeded(user.Email)
+	if err != nil {
+		helpers.SuccessResponse(false, w, r)
+		helpers.ThrowErr(w, r, "Clearing login failures error", err)
+		return
+	}
+
+	authTokenString, refreshTokenString, csrfSecret, err := myJWT.CreateNewTokens(uuidString, r)
+	if err != nil {
+		helpers.SuccessResponse(false, w, r)
+		helpers.ThrowErr(w, r, "Creating tokens error", err)
+		return
+	}
+
+	middleware.WriteNewAuth(w, r, authTokenString, refreshTokenString, csrfSecret)
+
+	helpers.SuccessResponse(true, w, r)
+}
 
-	if valid {
-		authTokenString, refreshTokenString, csrfSecret, err := myJWT.CreateNewTokens(strconv.Itoa(user.UUID))
+// loginPasskeyBegin sends the options for logging in with a passkey.
+// With a two-factor challenge only the passkeys of the user who entered their password can be used.
+func loginPasskeyBegin(w http.ResponseWriter, r *http.Request) {
+	var data passkeyLoginData                    // Create struct to store data.
+	err := json.NewDecoder(r.Body).Decode(&data) // Decode response to struct.
+	if err != nil {
+		helpers.SuccessResponse(false, w, r)
+		helpers.ThrowErr(w, r, "JSON decoding error", err)
+		return
+	}
+
+	uuid := 0
+	if data.Challenge != "" {
+		valid, uuidString := myJWT.CheckChallengeToken(data.Challenge)
+		if !valid {
+			helpers.SuccessResponse(false, w, r)
+			return // The challenge is invalid or has expired.
+		}
+
+		uuid, err = strconv.Atoi(uuidString)
 		if err != nil {
 			helpers.SuccessResponse(false, w, r)
-			helpers.ThrowErr(w, r, "Creating tokens error", err)
 			return
 		}
+	}
+
+	options, err := users.PasskeyLoginOptions(uuid)
+	if err != nil {
+		helpers.SuccessResponse(false, w, r)
+		helpers.ThrowErr(w, r, "Creating passkey challenge error", err)
+		return
+	}
 
-		middleware.WriteNewAuth(w, r, authTokenString, refreshTokenString, csrfSecret)
+	if uuid != 0 && len(options.CredentialIDs) == 0 {
+		helpers.SuccessResponse(false, w, r)
+		return // The user doesn't have any passkeys.
+	}
 
-		helpers.SuccessResponse(true, w, r)
+	err = helpers.JSONResponse(options, w)
+	if err != nil {
+		helpers.ThrowErr(w, r, "Sending JSON response error", err)
+	}
+}
+
+// loginPasskey logs a user in with a passkey, either on its own or after their password.
+func loginPasskey(w http.ResponseWriter, r *http.Request) {
+	var data passkeyLoginData                    // Create struct to store data.
+	err := json.NewDecoder(r.Body).Decode(&data) // Decode response to struct.
+	if err != nil {
+		helpers.SuccessResponse(false, w, r)
+		helpers.ThrowErr(w, r, "JSON decoding error", err)
 		return
 	}
 
-	helpers.SuccessResponse(false, w, r)
+	// After a password the failures are counted for the user's email, otherwise only for the IP address.
+	email := ""
+	if data.Challenge != "" {
+		valid, uuidString := myJWT.CheckChallengeToken(data.Challenge)
+		if !valid {
+			helpers.SuccessResponse(false, w, r)
+			return // The challenge is invalid or has expired.
+		}
+
+		uuid, err := strconv.Atoi(uuidString)
+		if err != nil {
+			helpers.SuccessResponse(false, w, r)
+			return
+		}
+
+		user, err := db.GetUserFromID(uuid)
+		if err != nil {
+			helpers.SuccessResponse(false, w, r)
+			helpers.ThrowErr(w, r, "Getting user from DB error", err)
+			return
+		}
+
+		email = user.Email
+	}
+
+	// Wrong passkeys count towards the same lockout as wrong passwords.
+	ip := helpers.ClientIP(r)
+	retryAfter, err := users.LoginLocked(email, ip)
+	if err != nil {
+		helpers.SuccessResponse(false, w, r)
+		helpers.ThrowErr(w, r, "Checking login lockout error", err)
+		return
+	}
+	if retryAfter > 0 {
+		loginLocked(w, r, retryAfter)
+		return // Too many failed logins.
+	}
+
+	uuid, valid, err := users.CheckPasskey(data.PasskeyAssertion)
+	if err != nil {
+		helpers.SuccessResponse(false, w, r)
+		helpers.ThrowErr(w, r, "Checking passkey error", err)
+		return
+	}
+
+	if !valid {
+		err = users.LoginFailed(email, ip)
+		if err != nil {
+			helpers.SuccessResponse(false, w, r)
+			helpers.ThrowErr(w, r, "Counting login failure error", err)
+			return
+		}
+
+		helpers.SuccessResponse(false, w, r)
+		return
+	}
+
+	user, err := db.GetUserFromID(uuid)
+	if err != nil {
+		helpers.SuccessResponse(false, w, r)
+		helpers.ThrowErr(w, r, "Getting user from DB error", err)
+		return
+	}
+
+	err = users.LoginSucceeded(user.Email)
+	if err != nil {
+		helpers.SuccessResponse(false, w, r)
+		helpers.ThrowErr(w, r, "Clearing login failures error", err)
+		return
+	}
+
+	authTokenString, refreshTokenString, csrfSecret, err := myJWT.CreateNewTokens(strconv.Itoa(uuid), r)
+	if err != nil {
+		helpers.SuccessResponse(false, w, r)
+		helpers.ThrowErr(w, r, "Creating tokens error", err)
+		return
+	}
+
+	middleware.WriteNewAuth(w, r, authTokenString, refreshTokenString, csrfSecret)
+
+	helpers.SuccessResponse(true, w, r)
 }
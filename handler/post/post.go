@@ -3,13 +3,19 @@ package post
 import (
 	"bufio"
 	"encoding/json"
+	"errors"
 	"html/template"
+	"image"
+	_ "image/gif"  // Necessary for reading the dimensions of GIFs.
+	_ "image/jpeg" // Necessary for reading the dimensions of JPEGs.
+	_ "image/png"  // Necessary for reading the dimensions of PNGs.
+	"io"
+	"log"
+	"mime"
 	"mime/multipart"
 	"net/http"
-	"net/url"
 	"path/filepath"
 	"strconv"
-	"strings"
 	"sync"
 	"time"
 
@@ -21,30 +27,26 @@ import (
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
-	"github.com/gorilla/context"
 	"github.com/gorilla/mux"
 	"github.com/zemirco/uid"
 )
 
+// ErrInvalidPost is returned when a new post form is missing a field or has an invalid value.
+var ErrInvalidPost = errors.New("invalid new post")
+
 type deleteCommentData struct {
-	PostID                int
-	CommentID, CsrfSecret string
+	PostID    int
+	CommentID string
+}
+
+type editCommentData struct {
+	PostID             int
+	CommentID, Comment string
 }
 
 // Posts is the handler for the posts page.
 func Posts(w http.ResponseWriter, r *http.Request) {
-	uuidString := context.Get(r, "uuid").(string)
-	uuid, err := strconv.Atoi(uuidString)
-	if err != nil {
-		helpers.ThrowErr(w, r, "Error converting string to int", err)
-		return
-	}
-
-	user, err := db.GetUserFromID(uuid)
-	if err != nil {
-		helpers.ThrowErr(w, r, "Error getting user from ID", err)
-		return
-	}
+	user := middleware.User(r)
 
 	t, err := template.ParseFiles("handler/templates/post/posts.html", "handler/templates/nested.html") // Parse the HTML pages
 	if err != nil {
@@ -65,7 +67,7 @@ func Posts(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	posts, err := db.GetPosts(7, 6, page)
+	posts, err := db.GetPosts(7, 6, page, models.Authorize(user, models.PermPostsUnpublished))
 	if err != nil {
 		helpers.ThrowErr(w, r, "Getting posts error", err)
 		return
@@ -77,15 +79,6 @@ func Posts(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	for i := 0; i < len(posts); i++ {
-		post := &posts[i]
-		err = json.Unmarshal([]byte(post.ImagesJSON), &post.Images)
-		if err != nil {
-			helpers.ThrowErr(w, r, "Unmarshalling images error", err)
-			return
-		}
-	}
-
 	nextPage := 0
 	if len(posts) == 7 {
 		posts = append(posts[:6], posts[7:]...) // Delete the last post.
@@ -97,7 +90,7 @@ func Posts(w http.ResponseWriter, r *http.Request) {
 	variables := models.TemplateVariables{
 		User:       user,
 		CsrfSecret: csrfSecret.Value,
-		Users:      db.Users,
+		Users:      db.Users(),
 		Posts:      posts,
 		Page: models.Page{
 			Next:    nextPage,
@@ -114,22 +107,7 @@ func Posts(w http.ResponseWriter, r *http.Request) {
 
 // Post is the handler for a post's page.
 func Post(w http.ResponseWriter, r *http.Request) {
-	uuidString := context.Get(r, "uuid").(string)
-	uuid, err := strconv.Atoi(uuidString)
-	if err != nil {
-		helpers.ThrowErr(w, r, "Error converting string to int", err)
-		return
-	}
-
-	user, err := db.GetUserFromID(uuid)
-	if err != nil {
-		helpers.ThrowErr(w, r, "Error getting user from ID", err)
-		return
-	}
-
-	if user.Priv != models.PrivUser && user.Priv != models.PrivAdmin && user.Priv != models.PrivSuperAdmin {
-		return
-	}
+	user := middleware.User(r)
 
 	csrfSecret, err := r.Cookie("csrfSecret")
 	if err != nil {
@@ -149,52 +127,22 @@ func Post(w http.ResponseWriter, r *http.Request) {
 		helpers.ThrowErr(w, r, "Getting post error", err)
 		return
 	}
-	if !exists {
+	if !exists || (post.Status != models.PostPublished && !models.Authorize(user, models.PermPostsUnpublished)) {
 		return
 	}
 
+	markPermissions(post.Comments, user)
+
 	t, err := template.ParseFiles("handler/templates/post/post.html", "handler/templates/nested.html") // Parse the HTML pages
 	if err != nil {
 		helpers.ThrowErr(w, r, "Template parsing error", err)
 		return
 	}
 
-	err = json.Unmarshal([]byte(post.ImagesJSON), &post.Images)
-	if err != nil {
-		helpers.ThrowErr(w, r, "Unmarshalling images error", err)
-		return
-	}
-	err = json.Unmarshal([]byte(post.CommentsJSON), &post.Comments)
-	if err != nil {
-		helpers.ThrowErr(w, r, "Unmarshalling comments error", err)
-		return
-	}
-
-	users := make(map[int]models.User)
-	for i := range post.Comments {
-		userUUID := post.Comments[i].UserUUID
-
-		if user, ok := users[userUUID]; ok {
-			post.Comments[i].User = user
-		} else {
-			user, err := db.GetUserFromID(userUUID)
-			if err != nil {
-				helpers.ThrowErr(w, r, "Getting user from ID error", err)
-			}
-			users[userUUID] = user
-			post.Comments[i].User = user
-		}
-	}
-
-	// Reverse the comments (newest first).
-	for i, j := 0, len(post.Comments)-1; i < j; i, j = i+1, j-1 {
-		post.Comments[i], post.Comments[j] = post.Comments[j], post.Comments[i]
-	}
-
 	variables := models.TemplateVariables{
 		User:       user,
 		CsrfSecret: csrfSecret.Value,
-		Users:      db.Users,
+		Users:      db.Users(),
 		Post:       post,
 		UnixTime:   time.Now().Unix(),
 	}
@@ -204,29 +152,41 @@ func Post(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// NewPage is the handler for the new post page.
-func NewPage(w http.ResponseWriter, r *http.Request) {
-	uuidString := context.Get(r, "uuid").(string)
-	uuid, err := strconv.Atoi(uuidString)
-	if err != nil {
-		helpers.ThrowErr(w, r, "Error converting string to int", err)
-		return
-	}
+// CheckStatus validates a requested post status and returns the status and publish time to store.
+// Posts scheduled in the past are published straight away.
+func CheckStatus(status int, publishTime int64) (int, int64, bool) {
+	now := time.Now().Unix()
+
+	switch status {
+	case models.PostDraft:
+		return models.PostDraft, 0, true
+	case models.PostScheduled:
+		if publishTime > now {
+			return models.PostScheduled, publishTime, true
+		}
 
-	user, err := db.GetUserFromID(uuid)
-	if err != nil {
-		helpers.ThrowErr(w, r, "Error getting user from ID", err)
-		return
+		return models.PostPublished, now, true
+	case models.PostPublished:
+		return models.PostPublished, now, true
 	}
 
-	if user.Priv != models.PrivUser && user.Priv != models.PrivAdmin && user.Priv != models.PrivSuperAdmin {
-		return
-	}
+	return 0, 0, false
+}
 
-	if err != nil {
-		helpers.ThrowErr(w, r, "Template parsing error", err)
-		return
+// markPermissions marks the comments in a thread which the user is allowed to edit and delete.
+func markPermissions(comments []models.DisplayComment, user models.User) {
+	for i := range comments {
+		comment := &comments[i]
+		own := comment.UserUUID == user.UUID && models.Authorize(user, models.PermCommentsCreate)
+		comment.Deletable = !comment.Deleted && (own || models.Authorize(user, models.PermCommentsDeleteAny))
+		comment.Editable = !comment.Deleted && (own || models.Authorize(user, models.PermCommentsEditAny))
+		markPermissions(comment.Replies, user)
 	}
+}
+
+// NewPage is the handler for the new post page.
+func NewPage(w http.ResponseWriter, r *http.Request) {
+	user := middleware.User(r)
 
 	csrfSecret, err := r.Cookie("csrfSecret")
 	if err != nil {
@@ -260,83 +220,145 @@ func New(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	form := r.MultipartForm // Declare the multipart form.
-
-	uploader := s3manager.NewUploader(session.Must(session.NewSession(&aws.Config{
-		Region: aws.String("eu-west-2"),
-	}))) // Create an uploader with default uploader with session
-
-	var imageLocations []string
-
-	// Upload the thumbnail.
-	location, err := uploadImage(form.File["thumbnail"][0], uploader)
+	_, err = NewFromForm(r.MultipartForm)
+	if err == ErrInvalidPost {
+		helpers.SuccessResponse(false, w, r)
+		return
+	}
 	if err != nil {
 		helpers.SuccessResponse(false, w, r)
-		helpers.ThrowErr(w, r, "Uploading image error", err)
+		helpers.ThrowErr(w, r, "Adding post error", err)
 		return
 	}
 
-	imageLocations = append(imageLocations, location)
+	helpers.SuccessResponse(true, w, r)
+}
+
+// NewFromForm uploads the images from a new post form to S3 then adds the post to the DB.
+func NewFromForm(form *multipart.Form) (id int, err error) {
+	if len(form.Value["title"]) == 0 || len(form.Value["description"]) == 0 || len(form.File["thumbnail"]) == 0 {
+		return 0, ErrInvalidPost
+	}
+
+	// Posts are published straight away unless a status is specified.
+	status, publishTime := models.PostPublished, int64(0)
+	if len(form.Value["status"]) != 0 {
+		status, err = strconv.Atoi(form.Value["status"][0])
+		if err != nil {
+			return 0, ErrInvalidPost
+		}
+	}
+
+	if len(form.Value["publishTime"]) != 0 && form.Value["publishTime"][0] != "" {
+		publishTime, err = strconv.ParseInt(form.Value["publishTime"][0], 10, 64)
+		if err != nil {
+			return 0, ErrInvalidPost
+		}
+	}
+
+	status, publishTime, ok := CheckStatus(status, publishTime)
+	if !ok {
+		return 0, ErrInvalidPost
+	}
+
+	uploader := s3manager.NewUploader(session.Must(session.NewSession(&aws.Config{
+		Region: aws.String("eu-west-2"),
+	}))) // Create an uploader with default uploader with session
+
+	// The thumbnail is always the first image.
+	files := append([]*multipart.FileHeader{form.File["thumbnail"][0]}, form.File["images"]...)
+	images := make([]models.Image, len(files))
+	uploaded := make([]bool, len(files))
 
 	// Upload the images.
-	images := form.File["images"]
 	var wg sync.WaitGroup // Declare a waitgroup.
-	wg.Add(len(images))   // Make the waitgroup wait until every image is done.
-	for inc := range images {
+	var mutex sync.Mutex  // Protects the first upload error.
+	var uploadErr error
+	wg.Add(len(files)) // Make the waitgroup wait until every image is done.
+	for inc := range files {
 		go func(i int) {
 			defer wg.Done()
 
-			if images[i].Filename == "" {
+			if files[i].Filename == "" {
 				return
 			}
 
-			location, err := uploadImage(images[i], uploader)
+			image, err := uploadImage(files[i], uploader)
 			if err != nil {
-				helpers.SuccessResponse(false, w, r)
-				helpers.ThrowErr(w, r, "Uploading image error", err)
+				mutex.Lock()
+				uploadErr = err
+				mutex.Unlock()
 				return
 			}
 
-			imageLocations = append(imageLocations, location)
+			images[i] = image // Each goroutine has its own index so the order is kept.
+			uploaded[i] = true
 		}(inc)
 	}
 	wg.Wait() // Wait until all of the images have been uploaded.
 
-	err = db.NewPost(form.Value["title"][0], form.Value["description"][0], imageLocations)
+	if uploadErr != nil {
+		return 0, uploadErr
+	}
+
+	var postImages []models.Image
+	for i := range images {
+		if uploaded[i] {
+			postImages = append(postImages, images[i])
+		}
+	}
+
+	return db.NewPost(form.Value["title"][0], form.Value["description"][0], postImages, status, publishTime)
+}
+
+func uploadImage(file *multipart.FileHeader, uploader *s3manager.Uploader) (postImage models.Image, err error) {
+	imageFile, err := file.Open()
 	if err != nil {
-		helpers.SuccessResponse(false, w, r)
-		helpers.ThrowErr(w, r, "Adding Post to DB error", err)
 		return
 	}
 
-	helpers.SuccessResponse(true, w, r)
-}
+	defer imageFile.Close()
+
+	// Read the dimensions from the image header then go back to the start for the upload.
+	// Formats Go can't decode, such as WebP and HEIC from phones, are still uploaded with an unknown size of 0x0.
+	config, _, err := image.DecodeConfig(imageFile)
+	if err != nil {
+		config = image.Config{}
+	}
 
-func uploadImage(file *multipart.FileHeader, uploader *s3manager.Uploader) (location string, err error) {
-	image, err := file.Open()
-	defer image.Close()
+	_, err = imageFile.Seek(0, io.SeekStart)
 	if err != nil {
 		return
 	}
 
+	contentType := file.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = mime.TypeByExtension(filepath.Ext(file.Filename))
+	}
+
 	imageID := uid.New(32)
-	fileName := imageID + filepath.Ext(file.Filename)
+	key := models.ImageKeyPrefix + imageID + filepath.Ext(file.Filename)
 
 	// Upload file to S3
-	result, err := uploader.Upload(&s3manager.UploadInput{
-		Bucket: aws.String("s.froogo.co.uk"),                               // Bucket name to upload (not necessarily domain)
-		Key:    aws.String("Static/berniesbusybees.co.uk/img/" + fileName), // Directory to upload in S3
-		Body:   bufio.NewReader(image),                                     // Body to upload (just bytes)
-		ACL:    aws.String("public-read"),                                  // Set to public read (no key required to read)
+	_, err = uploader.Upload(&s3manager.UploadInput{
+		Bucket:      aws.String(models.ImageBucket), // Bucket name to upload (not necessarily domain)
+		Key:         aws.String(key),                // Directory to upload in S3
+		Body:        bufio.NewReader(imageFile),     // Body to upload (just bytes)
+		ContentType: aws.String(contentType),        // Served to browsers as the content type
+		ACL:         aws.String("public-read"),      // Set to public read (no key required to read)
 	})
-
-	url, err := url.Parse(result.Location)
 	if err != nil {
 		return
 	}
-	urlSplit := strings.Split(url.Path, "/")
 
-	location = urlSplit[len(urlSplit)-1]
+	postImage = models.Image{
+		Key:         key,
+		Filename:    file.Filename,
+		ContentType: contentType,
+		Size:        file.Size,
+		Width:       config.Width,
+		Height:      config.Height,
+	}
 	return
 }
 
@@ -350,32 +372,6 @@ func Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !middleware.AJAX(w, r, models.AJAXData{CsrfSecret: data.CsrfSecret}) {
-		// Failed middleware (invalid credentials)
-		helpers.SuccessResponse(false, w, r)
-		return
-	}
-
-	uuidString := context.Get(r, "uuid").(string)
-	uuid, err := strconv.Atoi(uuidString)
-	if err != nil {
-		helpers.SuccessResponse(false, w, r)
-		helpers.ThrowErr(w, r, "Error converting string to int", err)
-		return
-	}
-
-	user, err := db.GetUserFromID(uuid)
-	if err != nil {
-		helpers.SuccessResponse(false, w, r)
-		helpers.ThrowErr(w, r, "Error getting user from ID", err)
-		return
-	}
-
-	if user.Priv != models.PrivAdmin && user.Priv != models.PrivSuperAdmin {
-		helpers.SuccessResponse(false, w, r)
-		return
-	}
-
 	images, err := db.DeletePost(data.ID)
 	if err != nil {
 		helpers.SuccessResponse(false, w, r)
@@ -383,6 +379,13 @@ func Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	DeleteImages(images)
+
+	helpers.SuccessResponse(true, w, r)
+}
+
+// DeleteImages removes the images of a deleted post from S3 in the background.
+func DeleteImages(images []models.Image) {
 	svc := s3.New(session.Must(session.NewSession(&aws.Config{
 		Region: aws.String("eu-west-2"),
 	})))
@@ -390,20 +393,16 @@ func Delete(w http.ResponseWriter, r *http.Request) {
 	for inc := range images {
 		go func(i int) {
 			object := &s3.DeleteObjectInput{
-				Bucket: aws.String("s.froogo.co.uk"),
-				Key:    aws.String("Static/berniesbusybees.co.uk/img/" + images[i]),
+				Bucket: aws.String(models.ImageBucket),
+				Key:    aws.String(images[i].Key),
 			}
 
-			_, err = svc.DeleteObject(object)
+			_, err := svc.DeleteObject(object)
 			if err != nil {
-				helpers.SuccessResponse(false, w, r)
-				helpers.ThrowErr(w, r, "Deleting object error", err)
-				return
+				log.Printf("Deleting object error: %v", err)
 			}
 		}(inc)
 	}
-
-	helpers.SuccessResponse(true, w, r)
 }
 
 // Update is an AJAX request response.
@@ -416,42 +415,62 @@ func Update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !middleware.AJAX(w, r, models.AJAXData{CsrfSecret: data.CsrfSecret}) {
-		// Failed middleware (invalid credentials)
+	err = db.EditPost(data.ID, data.Title, data.Description)
+	if err != nil {
 		helpers.SuccessResponse(false, w, r)
+		helpers.ThrowErr(w, r, "Editing menu item error", err)
 		return
 	}
 
-	uuidString := context.Get(r, "uuid").(string)
-	uuid, err := strconv.Atoi(uuidString)
+	helpers.SuccessResponse(true, w, r)
+}
+
+// StatusUpdate is an AJAX request response for publishing, scheduling or unpublishing a post.
+func StatusUpdate(w http.ResponseWriter, r *http.Request) {
+	var data models.PostStatusEdit               // Create struct to store data.
+	err := json.NewDecoder(r.Body).Decode(&data) // Decode response to struct.
 	if err != nil {
-		helpers.ThrowErr(w, r, "Error converting string to int", err)
+		helpers.SuccessResponse(false, w, r)
+		helpers.ThrowErr(w, r, "JSON decoding error", err)
 		return
 	}
 
-	user, err := db.GetUserFromID(uuid)
+	post, exists, err := db.GetPost(data.ID)
 	if err != nil {
-		helpers.ThrowErr(w, r, "Error getting user from ID", err)
+		helpers.SuccessResponse(false, w, r)
+		helpers.ThrowErr(w, r, "Getting post error", err)
+		return
+	}
+	if !exists {
+		helpers.SuccessResponse(false, w, r)
 		return
 	}
 
-	if user.Priv != models.PrivAdmin && user.Priv != models.PrivSuperAdmin {
+	// Publishing a post again would move it back to the top.
+	if post.Status == models.PostPublished && data.Status == models.PostPublished {
+		helpers.SuccessResponse(true, w, r)
 		return
 	}
 
-	err = db.EditPost(data.ID, data.Title, data.Description)
+	status, publishTime, ok := CheckStatus(data.Status, data.PublishTime)
+	if !ok {
+		helpers.SuccessResponse(false, w, r)
+		return
+	}
+
+	err = db.EditPostStatus(data.ID, status, publishTime)
 	if err != nil {
 		helpers.SuccessResponse(false, w, r)
-		helpers.ThrowErr(w, r, "Editing menu item error", err)
+		helpers.ThrowErr(w, r, "Editing post status error", err)
 		return
 	}
 
 	helpers.SuccessResponse(true, w, r)
 }
 
-// Comment is an AJAX request response.
-func Comment(w http.ResponseWriter, r *http.Request) {
-	var data models.NewComment                   // Create struct to store data.
+// ImageUpdate is an AJAX request response for reordering or captioning an image.
+func ImageUpdate(w http.ResponseWriter, r *http.Request) {
+	var data models.ImageEdit                    // Create struct to store data.
 	err := json.NewDecoder(r.Body).Decode(&data) // Decode response to struct.
 	if err != nil {
 		helpers.SuccessResponse(false, w, r)
@@ -459,26 +478,37 @@ func Comment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !middleware.AJAX(w, r, models.AJAXData{CsrfSecret: data.CsrfSecret}) {
-		// Failed middleware (invalid credentials)
+	err = db.EditImage(data.ID, data.Position, data.Caption)
+	if err != nil {
 		helpers.SuccessResponse(false, w, r)
+		helpers.ThrowErr(w, r, "Editing image error", err)
 		return
 	}
 
-	uuidString := context.Get(r, "uuid").(string)
-	uuid, err := strconv.Atoi(uuidString)
+	helpers.SuccessResponse(true, w, r)
+}
+
+// Comment is an AJAX request response.
+func Comment(w http.ResponseWriter, r *http.Request) {
+	var data models.NewComment                   // Create struct to store data.
+	err := json.NewDecoder(r.Body).Decode(&data) // Decode response to struct.
 	if err != nil {
-		helpers.ThrowErr(w, r, "Error converting string to int", err)
+		helpers.SuccessResponse(false, w, r)
+		helpers.ThrowErr(w, r, "JSON decoding error", err)
 		return
 	}
 
-	user, err := db.GetUserFromID(uuid)
+	user := middleware.User(r)
+
+	// Users can only comment on posts they can see.
+	post, exists, err := db.GetPost(data.ID)
 	if err != nil {
-		helpers.ThrowErr(w, r, "Error getting user from ID", err)
+		helpers.SuccessResponse(false, w, r)
+		helpers.ThrowErr(w, r, "Getting post error", err)
 		return
 	}
-
-	if user.Priv != models.PrivUser && user.Priv != models.PrivAdmin && user.Priv != models.PrivSuperAdmin {
+	if !exists || (post.Status != models.PostPublished && !models.Authorize(user, models.PermPostsUnpublished)) {
+		helpers.SuccessResponse(false, w, r)
 		return
 	}
 
@@ -502,9 +532,9 @@ func Comment(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// CommentDelete is an AJAX request response.
-func CommentDelete(w http.ResponseWriter, r *http.Request) {
-	var data deleteCommentData                   // Create struct to store data.
+// CommentUpdate is an AJAX request response for editing a comment.
+func CommentUpdate(w http.ResponseWriter, r *http.Request) {
+	var data editCommentData                     // Create struct to store data.
 	err := json.NewDecoder(r.Body).Decode(&data) // Decode response to struct.
 	if err != nil {
 		helpers.SuccessResponse(false, w, r)
@@ -512,26 +542,58 @@ func CommentDelete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !middleware.AJAX(w, r, models.AJAXData{CsrfSecret: data.CsrfSecret}) {
-		// Failed middleware (invalid credentials)
+	if data.Comment == "" {
 		helpers.SuccessResponse(false, w, r)
 		return
 	}
 
-	uuidString := context.Get(r, "uuid").(string)
-	uuid, err := strconv.Atoi(uuidString)
+	user := middleware.User(r)
+
+	if !models.Authorize(user, models.PermCommentsEditAny) {
+		if !models.Authorize(user, models.PermCommentsCreate) {
+			helpers.SuccessResponse(false, w, r)
+			return
+		}
+
+		owner, err := db.EditCommentPostIfOwner(data.CommentID, data.PostID, user.UUID, data.Comment, time.Now().Unix())
+		if err != nil {
+			helpers.SuccessResponse(false, w, r)
+			helpers.ThrowErr(w, r, "Editing comment error", err)
+			return
+		}
+
+		helpers.SuccessResponse(owner, w, r) // The user may not have had valid permission.
+		return
+	}
+
+	err = db.EditCommentPost(data.CommentID, data.PostID, data.Comment, time.Now().Unix())
 	if err != nil {
-		helpers.ThrowErr(w, r, "Error converting string to int", err)
+		helpers.SuccessResponse(false, w, r)
+		helpers.ThrowErr(w, r, "Editing comment error", err)
 		return
 	}
 
-	user, err := db.GetUserFromID(uuid)
+	helpers.SuccessResponse(true, w, r)
+}
+
+// CommentDelete is an AJAX request response.
+func CommentDelete(w http.ResponseWriter, r *http.Request) {
+	var data deleteCommentData                   // Create struct to store data.
+	err := json.NewDecoder(r.Body).Decode(&data) // Decode response to struct.
 	if err != nil {
-		helpers.ThrowErr(w, r, "Error getting user from ID", err)
+		helpers.SuccessResponse(false, w, r)
+		helpers.ThrowErr(w, r, "JSON decoding error", err)
 		return
 	}
 
-	if user.Priv != models.PrivAdmin && user.Priv != models.PrivSuperAdmin {
+	user := middleware.User(r)
+
+	if !models.Authorize(user, models.PermCommentsDeleteAny) {
+		if !models.Authorize(user, models.PermCommentsCreate) {
+			helpers.SuccessResponse(false, w, r)
+			return
+		}
+
 		owner, err := db.DeleteCommentPostIfOwner(data.CommentID, data.PostID, user.UUID)
 		if err != nil {
 			helpers.SuccessResponse(false, w, r)
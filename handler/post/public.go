@@ -0,0 +1,101 @@
+package post
+
+import (
+	"html/template"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/VolticFroogo/Bernies-Busy-Bees/db"
+	"github.com/VolticFroogo/Bernies-Busy-Bees/helpers"
+	"github.com/VolticFroogo/Bernies-Busy-Bees/models"
+	"github.com/gorilla/mux"
+)
+
+// PublicPosts is the handler for the public archive of posts.
+func PublicPosts(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	page, err := strconv.Atoi(vars["page"])
+	if err != nil || page < 1 {
+		// The user is trying to get an unexpected result; throw an error.
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	posts, err := db.GetPosts(7, 6, page, false)
+	if err != nil {
+		helpers.ThrowErr(w, r, "Getting posts error", err)
+		return
+	}
+
+	nextPage := 0
+	if len(posts) == 7 {
+		posts = posts[:6] // Delete the last post.
+		nextPage = page + 1
+	} else if len(posts) == 0 && page != 1 {
+		http.Redirect(w, r, "/posts/1", http.StatusTemporaryRedirect)
+		return
+	}
+
+	t, err := template.ParseFiles("handler/templates/public/posts.html", "handler/templates/nested.html") // Parse the HTML pages
+	if err != nil {
+		helpers.ThrowErr(w, r, "Template parsing error", err)
+		return
+	}
+
+	variables := models.TemplateVariables{
+		Posts: posts,
+		Page: models.Page{
+			Next:    nextPage,
+			Current: page,
+			Last:    page - 1,
+		},
+	}
+
+	err = t.Execute(w, variables) // Execute temmplate with variables
+	if err != nil {
+		helpers.ThrowErr(w, r, "Template execution error", err)
+	}
+}
+
+// PublicPost is the handler for the public page of a post.
+func PublicPost(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	postID, err := strconv.Atoi(vars["postID"])
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	post, exists, err := db.GetPost(postID)
+	if err != nil {
+		helpers.ThrowErr(w, r, "Getting post error", err)
+		return
+	}
+	if !exists || post.Status != models.PostPublished {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	// Keep one address for each post even if its title changes.
+	if vars["slug"] != post.Slug() {
+		http.Redirect(w, r, post.URL(), http.StatusMovedPermanently)
+		return
+	}
+
+	t, err := template.ParseFiles("handler/templates/public/post.html", "handler/templates/nested.html") // Parse the HTML pages
+	if err != nil {
+		helpers.ThrowErr(w, r, "Template parsing error", err)
+		return
+	}
+
+	variables := models.TemplateVariables{
+		Post:     post,
+		UnixTime: time.Now().Unix(),
+	}
+
+	err = t.Execute(w, variables) // Execute temmplate with variables
+	if err != nil {
+		helpers.ThrowErr(w, r, "Template execution error", err)
+	}
+}
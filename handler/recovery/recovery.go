@@ -3,22 +3,14 @@ package recovery
 import (
 	"encoding/json"
 	"net/http"
-	"os"
 
 	"github.com/VolticFroogo/Bernies-Busy-Bees/db"
+	"github.com/VolticFroogo/Bernies-Busy-Bees/handler/users"
 	"github.com/VolticFroogo/Bernies-Busy-Bees/helpers"
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/ses"
-	"github.com/go-recaptcha/recaptcha"
+	"github.com/VolticFroogo/Bernies-Busy-Bees/models"
 	"github.com/zemirco/uid"
 )
 
-var (
-	captchaSecret = os.Getenv("CAPTCHA_SECRET")
-	captcha       = recaptcha.New(captchaSecret)
-)
-
 // Response codes.
 const (
 	Success = iota
@@ -37,155 +29,124 @@ type response struct {
 	Code int
 }
 
-// Begin is the function called after an AJAX request is sent from the forgot password page.
-func Begin(w http.ResponseWriter, r *http.Request) {
-	var data message                             // Create struct to store data.
-	err := json.NewDecoder(r.Body).Decode(&data) // Decode response to struct.
-	if err != nil {
-		helpers.JSONResponse(response{Code: Internal}, w)
-		helpers.ThrowErr(w, r, "JSON decoding error", err)
-		return
-	}
-
-	if data.Captcha == "" {
-		helpers.JSONResponse(response{Code: Recaptcha}, w)
-		return // There is no captcha response.
-	}
-	captchaSuccess, err := captcha.Verify(data.Captcha, r.Header.Get("CF-Connecting-IP")) // Check the captcha.
-	if err != nil {
-		helpers.JSONResponse(response{Code: Recaptcha}, w)
-		helpers.ThrowErr(w, r, "Recaptcha error", err)
-		return
-	}
-	if !captchaSuccess {
-		helpers.JSONResponse(response{Code: Recaptcha}, w)
-		return // Unsuccessful captcha.
-	}
-
-	user, err := db.GetUserFromEmail(data.Email)
-	if err != nil {
-		helpers.JSONResponse(response{Code: Internal}, w)
-		helpers.ThrowErr(w, r, "Getting user error", err)
-		return
+// Begin returns the handler for an AJAX request sent from the forgot password page, checking CAPTCHAs with captcha.
+func Begin(captcha helpers.CaptchaVerifier) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var data message                             // Create struct to store data.
+		err := json.NewDecoder(r.Body).Decode(&data) // Decode response to struct.
+		if err != nil {
+			helpers.JSONResponse(response{Code: Internal}, w)
+			helpers.ThrowErr(w, r, "JSON decoding error", err)
+			return
+		}
+
+		captchaSuccess, err := captcha.Verify(data.Captcha, helpers.ClientIP(r)) // Check the captcha.
+		if err != nil {
+			helpers.JSONResponse(response{Code: Recaptcha}, w)
+			helpers.ThrowErr(w, r, "Captcha error", err)
+			return
+		}
+		if !captchaSuccess {
+			helpers.JSONResponse(response{Code: Recaptcha}, w)
+			return // Unsuccessful captcha.
+		}
+
+		user, err := db.GetUserFromEmail(data.Email)
+		if err != nil {
+			helpers.JSONResponse(response{Code: Internal}, w)
+			helpers.ThrowErr(w, r, "Getting user error", err)
+			return
+		}
+		if user.UUID == 0 {
+			helpers.JSONResponse(response{Code: InvalidEmail}, w)
+			return
+		}
+
+		id := uid.New(64)
+
+		err = db.AddRecovery(id, user.UUID, data.Email)
+		if err != nil {
+			helpers.JSONResponse(response{Code: Internal}, w)
+			helpers.ThrowErr(w, r, "Adding recovery error", err)
+			return
+		}
+
+		err = SendEmail(id, data.Email)
+		if err != nil {
+			helpers.JSONResponse(response{Code: SendingEmail}, w)
+			helpers.ThrowErr(w, r, "Send email error", err)
+			return
+		}
+
+		helpers.JSONResponse(response{Code: Success}, w)
 	}
-	if user.UUID == 0 {
-		helpers.JSONResponse(response{Code: InvalidEmail}, w)
-		return
-	}
-
-	id := uid.New(64)
-
-	err = db.AddRecovery(id, user.UUID, data.Email)
-	if err != nil {
-		helpers.JSONResponse(response{Code: Internal}, w)
-		helpers.ThrowErr(w, r, "Adding recovery error", err)
-		return
-	}
-
-	err = SendEmail(id, data.Email)
-	if err != nil {
-		helpers.JSONResponse(response{Code: SendingEmail}, w)
-		helpers.ThrowErr(w, r, "Send email error", err)
-		return
-	}
-
-	helpers.JSONResponse(response{Code: Success}, w)
 }
 
 // SendEmail sends the recovery email.
 func SendEmail(id, email string) (err error) {
-	sess, err := session.NewSession(&aws.Config{
-		Region: aws.String("eu-west-1")},
-	)
-	if err != nil {
-		return
-	}
+	link := models.SiteURL + "/password-recovery?code=" + id
 
-	// Create an SES session.
-	svc := ses.New(sess)
-
-	// Assemble the email.
-	input := &ses.SendEmailInput{
-		Destination: &ses.Destination{
-			CcAddresses: []*string{},
-			ToAddresses: []*string{
-				aws.String(email),
-			},
-		},
-		Message: &ses.Message{
-			Body: &ses.Body{
-				Html: &ses.Content{
-					Charset: aws.String("UTF-8"),
-					Data:    aws.String("To recover your password please click this link: <a href=\"https://berniesbusybees.co.uk/password-recovery?code=" + id + "\">recover password</a>."),
-				},
-				Text: &ses.Content{
-					Charset: aws.String("UTF-8"),
-					Data:    aws.String("To recover your password please click this link: https://berniesbusybees.co.uk/password-recovery?code=" + id),
-				},
-			},
-			Subject: &ses.Content{
-				Charset: aws.String("UTF-8"),
-				Data:    aws.String("Password Recovery"),
-			},
-		},
-		Source: aws.String("noreply@berniesbusybees.co.uk"),
-	}
-
-	// Attempt to send the email.
-	_, err = svc.SendEmail(input)
-	return
+	return helpers.SendEmail(email, "Password Recovery",
+		"To recover your password please click this link: "+link,
+		"To recover your password please click this link: <a href=\""+link+"\">recover password</a>.")
 }
 
-// End is the final function which is called when a user submits their new password.
-func End(w http.ResponseWriter, r *http.Request) {
-	var data message                             // Create struct to store data.
-	err := json.NewDecoder(r.Body).Decode(&data) // Decode response to struct.
-	if err != nil {
-		helpers.JSONResponse(response{Code: Internal}, w)
-		helpers.ThrowErr(w, r, "JSON decoding error", err)
-		return
-	}
-
-	if data.Captcha == "" {
-		helpers.JSONResponse(response{Code: Recaptcha}, w)
-		return // There is no captcha response.
-	}
-	captchaSuccess, err := captcha.Verify(data.Captcha, r.Header.Get("CF-Connecting-IP")) // Check the captcha.
-	if err != nil {
-		helpers.JSONResponse(response{Code: Recaptcha}, w)
-		helpers.ThrowErr(w, r, "Recaptcha error", err)
-		return
-	}
-	if !captchaSuccess {
-		helpers.JSONResponse(response{Code: Recaptcha}, w)
-		return // Unsuccessful captcha.
-	}
-
-	userUUID, email, err := db.GetRecovery(data.Code)
-	if err != nil {
-		helpers.JSONResponse(response{Code: Internal}, w)
-		helpers.ThrowErr(w, r, "Getting recovery error", err)
-		return
+// End returns the final handler, called when a user submits their new password, checking CAPTCHAs with captcha.
+func End(captcha helpers.CaptchaVerifier) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var data message                             // Create struct to store data.
+		err := json.NewDecoder(r.Body).Decode(&data) // Decode response to struct.
+		if err != nil {
+			helpers.JSONResponse(response{Code: Internal}, w)
+			helpers.ThrowErr(w, r, "JSON decoding error", err)
+			return
+		}
+
+		captchaSuccess, err := captcha.Verify(data.Captcha, helpers.ClientIP(r)) // Check the captcha.
+		if err != nil {
+			helpers.JSONResponse(response{Code: Recaptcha}, w)
+			helpers.ThrowErr(w, r, "Captcha error", err)
+			return
+		}
+		if !captchaSuccess {
+			helpers.JSONResponse(response{Code: Recaptcha}, w)
+			return // Unsuccessful captcha.
+		}
+
+		userUUID, email, err := db.GetRecovery(data.Code)
+		if err != nil {
+			helpers.JSONResponse(response{Code: Internal}, w)
+			helpers.ThrowErr(w, r, "Getting recovery error", err)
+			return
+		}
+
+		if userUUID == 0 || email == "" {
+			helpers.JSONResponse(response{Code: Internal}, w)
+			return
+		}
+
+		hash, err := helpers.HashPassword(data.Password)
+		if err != nil {
+			helpers.JSONResponse(response{Code: Internal}, w)
+			helpers.ThrowErr(w, r, "Hashing password error", err)
+			return
+		}
+
+		err = db.EditPassword(userUUID, hash)
+		if err != nil {
+			helpers.JSONResponse(response{Code: Internal}, w)
+			helpers.ThrowErr(w, r, "Editing password error", err)
+			return
+		}
+
+		// A new password unlocks the account if guessing the old one locked it.
+		err = users.LoginSucceeded(email)
+		if err != nil {
+			helpers.JSONResponse(response{Code: Internal}, w)
+			helpers.ThrowErr(w, r, "Clearing login failures error", err)
+			return
+		}
+
+		helpers.JSONResponse(response{Code: Success}, w)
 	}
-
-	if userUUID == 0 || email == "" {
-		helpers.JSONResponse(response{Code: Internal}, w)
-		return
-	}
-
-	hash, err := helpers.HashPassword(data.Password)
-	if err != nil {
-		helpers.JSONResponse(response{Code: Internal}, w)
-		helpers.ThrowErr(w, r, "Hashing password error", err)
-		return
-	}
-
-	err = db.EditPassword(userUUID, hash)
-	if err != nil {
-		helpers.JSONResponse(response{Code: Internal}, w)
-		helpers.ThrowErr(w, r, "Editing password error", err)
-		return
-	}
-
-	helpers.JSONResponse(response{Code: Success}, w)
 }
@@ -3,18 +3,15 @@ package users
 import (
 	"encoding/json"
 	"net/http"
-	"strconv"
 
 	"github.com/VolticFroogo/Bernies-Busy-Bees/db"
 	"github.com/VolticFroogo/Bernies-Busy-Bees/helpers"
 	"github.com/VolticFroogo/Bernies-Busy-Bees/middleware"
-	"github.com/VolticFroogo/Bernies-Busy-Bees/models"
-	"github.com/gorilla/context"
 )
 
 type edit struct {
-	ID, Privileges                            int
-	CsrfSecret, Email, Password, Fname, Lname string
+	ID, Role                      int
+	Email, Password, Fname, Lname string
 }
 
 // Update is the handler for the update user request.
@@ -27,33 +24,22 @@ func Update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !middleware.AJAX(w, r, models.AJAXData{CsrfSecret: data.CsrfSecret}) {
-		// Failed middleware (invalid credentials)
-		helpers.SuccessResponse(false, w, r)
-		return
-	}
-
-	uuidString := context.Get(r, "uuid").(string)
-	uuid, err := strconv.Atoi(uuidString)
-	if err != nil {
-		helpers.SuccessResponse(false, w, r)
-		helpers.ThrowErr(w, r, "Error converting string to int", err)
-	}
-
-	user, err := db.GetUserFromID(uuid)
+	user, err := db.GetUserFromID(data.ID)
 	if err != nil {
 		helpers.SuccessResponse(false, w, r)
-		helpers.ThrowErr(w, r, "Error getting user from ID", err)
+		helpers.ThrowErr(w, r, "Getting user error", err)
+		return
 	}
 
-	if user.Priv != models.PrivSuperAdmin {
-		// User isn't a super admin.
+	// Editing someone with a role you couldn't give them would let you take over their account.
+	current := middleware.User(r)
+	if !CanGrantRole(current, user.Role.ID) || !CanGrantRole(current, data.Role) {
 		helpers.SuccessResponse(false, w, r)
 		return
 	}
 
 	if data.Password == "" {
-		err = db.EditUserNoPassword(data.ID, data.Email, data.Fname, data.Lname, data.Privileges)
+		err = db.EditUserNoPassword(data.ID, data.Email, data.Fname, data.Lname, data.Role)
 		if err != nil {
 			helpers.SuccessResponse(false, w, r)
 			helpers.ThrowErr(w, r, "Editing user (no password) error", err)
@@ -67,7 +53,7 @@ func Update(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		err = db.EditUser(data.ID, data.Email, password, data.Fname, data.Lname, data.Privileges)
+		err = db.EditUser(data.ID, data.Email, password, data.Fname, data.Lname, data.Role)
 		if err != nil {
 			helpers.SuccessResponse(false, w, r)
 			helpers.ThrowErr(w, r, "Editing user error", err)
@@ -81,65 +67,6 @@ func Update(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// New is the handler for the new user request.
-func New(w http.ResponseWriter, r *http.Request) {
-	var data edit                                // Create struct to store data.
-	err := json.NewDecoder(r.Body).Decode(&data) // Decode response to struct.
-	if err != nil {
-		helpers.ThrowErr(w, r, "JSON decoding error", err)
-		helpers.SuccessResponse(false, w, r)
-		return
-	}
-
-	if !middleware.AJAX(w, r, models.AJAXData{CsrfSecret: data.CsrfSecret}) {
-		// Failed middleware (invalid credentials)
-		helpers.SuccessResponse(false, w, r)
-		return
-	}
-
-	uuidString := context.Get(r, "uuid").(string)
-	uuid, err := strconv.Atoi(uuidString)
-	if err != nil {
-		helpers.SuccessResponse(false, w, r)
-		helpers.ThrowErr(w, r, "Error converting string to int", err)
-	}
-
-	user, err := db.GetUserFromID(uuid)
-	if err != nil {
-		helpers.SuccessResponse(false, w, r)
-		helpers.ThrowErr(w, r, "Error getting user from ID", err)
-	}
-
-	if user.Priv != models.PrivSuperAdmin {
-		// User isn't a super admin.
-		helpers.SuccessResponse(false, w, r)
-		return
-	}
-
-	password, err := helpers.HashPassword(data.Password)
-	if err != nil {
-		helpers.SuccessResponse(false, w, r)
-		helpers.ThrowErr(w, r, "Hashing password error", err)
-		return
-	}
-
-	id, err := db.NewUser(data.Email, password, data.Fname, data.Lname, data.Privileges)
-	if err != nil {
-		helpers.SuccessResponse(false, w, r)
-		helpers.ThrowErr(w, r, "Creating user error", err)
-		return
-	}
-
-	err = helpers.JSONResponse(models.ResponseWithIDInt{
-		Success: true,
-		ID:      id,
-	}, w)
-	if err != nil {
-		helpers.ThrowErr(w, r, "Sending JSON response error", err)
-		return
-	}
-}
-
 // Delete is the handler for the delete user request.
 func Delete(w http.ResponseWriter, r *http.Request) {
 	var data edit                                // Create struct to store data.
@@ -150,27 +77,14 @@ func Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !middleware.AJAX(w, r, models.AJAXData{CsrfSecret: data.CsrfSecret}) {
-		// Failed middleware (invalid credentials)
-		helpers.SuccessResponse(false, w, r)
-		return
-	}
-
-	uuidString := context.Get(r, "uuid").(string)
-	uuid, err := strconv.Atoi(uuidString)
+	user, err := db.GetUserFromID(data.ID)
 	if err != nil {
 		helpers.SuccessResponse(false, w, r)
-		helpers.ThrowErr(w, r, "Error converting string to int", err)
-	}
-
-	user, err := db.GetUserFromID(uuid)
-	if err != nil {
-		helpers.SuccessResponse(false, w, r)
-		helpers.ThrowErr(w, r, "Error getting user from ID", err)
+		helpers.ThrowErr(w, r, "Getting user error", err)
+		return
 	}
 
-	if user.Priv != models.PrivSuperAdmin {
-		// User isn't a super admin.
+	if !CanGrantRole(middleware.User(r), user.Role.ID) {
 		helpers.SuccessResponse(false, w, r)
 		return
 	}
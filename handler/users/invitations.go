@@ -0,0 +1,238 @@
+package users
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/VolticFroogo/Bernies-Busy-Bees/db"
+	"github.com/VolticFroogo/Bernies-Busy-Bees/helpers"
+	"github.com/VolticFroogo/Bernies-Busy-Bees/middleware"
+	"github.com/VolticFroogo/Bernies-Busy-Bees/middleware/myJWT"
+	"github.com/VolticFroogo/Bernies-Busy-Bees/models"
+)
+
+// Invitation accept response codes.
+const (
+	AcceptSuccess = iota
+	AcceptInvalid
+	AcceptExpired
+	AcceptInternal
+)
+
+type invitationEdit struct {
+	ID, Role int
+	Email    string
+}
+
+type invitationAccept struct {
+	Token, Password, Fname, Lname string
+}
+
+type acceptResponse struct {
+	Code int
+}
+
+// sendInvitation emails an invitation's newest link.
+func sendInvitation(invitation models.Invitation, invitedBy models.User) (err error) {
+	token, err := myJWT.CreateInvitationToken(invitation)
+	if err != nil {
+		return
+	}
+
+	days := strconv.Itoa(int(models.InvitationValidTime.Hours() / 24))
+	message := invitedBy.Fname + " " + invitedBy.Lname + " has invited you to make an account at " + siteName + ". " +
+		"To choose your name and password, click this link within " + days + " days: " + models.SiteURL + "/invitation?token=" + url.QueryEscape(token)
+
+	return helpers.SendEmail(invitation.Email, "You've been invited to "+siteName, message, "")
+}
+
+// Invite invites an email address to make an account with a role, emailing them a link.
+func Invite(email string, role int, invitedBy models.User) (invitation models.Invitation, err error) {
+	invitation, err = db.NewInvitation(email, role, invitedBy.UUID)
+	if err != nil {
+		return
+	}
+
+	err = sendInvitation(invitation, invitedBy)
+	return
+}
+
+// InvitationNew is the handler for an admin inviting someone to make an account with a role.
+func InvitationNew(w http.ResponseWriter, r *http.Request) {
+	var data invitationEdit                      // Create struct to store data.
+	err := json.NewDecoder(r.Body).Decode(&data) // Decode response to struct.
+	if err != nil {
+		helpers.SuccessResponse(false, w, r)
+		helpers.ThrowErr(w, r, "JSON decoding error", err)
+		return
+	}
+
+	data.Email = strings.TrimSpace(data.Email)
+	if len(data.Email) > maxEmailLength || helpers.CheckEmail(data.Email) != nil || !CanGrantRole(middleware.User(r), data.Role) {
+		helpers.SuccessResponse(false, w, r)
+		return
+	}
+
+	existing, err := db.GetUserFromEmail(data.Email)
+	if err != nil {
+		helpers.SuccessResponse(false, w, r)
+		helpers.ThrowErr(w, r, "Getting user error", err)
+		return
+	}
+
+	if existing.UUID != 0 {
+		helpers.SuccessResponse(false, w, r)
+		return // They already have an account.
+	}
+
+	invitation, err := Invite(data.Email, data.Role, middleware.User(r))
+	if err != nil {
+		helpers.SuccessResponse(false, w, r)
+		helpers.ThrowErr(w, r, "Inviting user error", err)
+		return
+	}
+
+	err = helpers.JSONResponse(models.ResponseWithIDInt{
+		Success: true,
+		ID:      invitation.ID,
+	}, w)
+	if err != nil {
+		helpers.ThrowErr(w, r, "Sending JSON response error", err)
+	}
+}
+
+// InvitationResend is the handler for an admin emailing a new link for an invitation, which stops the old one working.
+func InvitationResend(w http.ResponseWriter, r *http.Request) {
+	var data invitationEdit                      // Create struct to store data.
+	err := json.NewDecoder(r.Body).Decode(&data) // Decode response to struct.
+	if err != nil {
+		helpers.SuccessResponse(false, w, r)
+		helpers.ThrowErr(w, r, "JSON decoding error", err)
+		return
+	}
+
+	invitation, err := db.ResendInvitation(data.ID)
+	if err != nil {
+		helpers.SuccessResponse(false, w, r)
+		helpers.ThrowErr(w, r, "Resending invitation error", err)
+		return
+	}
+
+	if invitation.ID == 0 {
+		helpers.SuccessResponse(false, w, r)
+		return
+	}
+
+	err = sendInvitation(invitation, middleware.User(r))
+	if err != nil {
+		helpers.SuccessResponse(false, w, r)
+		helpers.ThrowErr(w, r, "Sending invitation error", err)
+		return
+	}
+
+	helpers.SuccessResponse(true, w, r)
+}
+
+// InvitationRevoke is the handler for an admin revoking an invitation, so its link stops working.
+func InvitationRevoke(w http.ResponseWriter, r *http.Request) {
+	var data invitationEdit                      // Create struct to store data.
+	err := json.NewDecoder(r.Body).Decode(&data) // Decode response to struct.
+	if err != nil {
+		helpers.SuccessResponse(false, w, r)
+		helpers.ThrowErr(w, r, "JSON decoding error", err)
+		return
+	}
+
+	deleted, err := db.DeleteInvitation(data.ID)
+	if err != nil {
+		helpers.SuccessResponse(false, w, r)
+		helpers.ThrowErr(w, r, "Deleting invitation error", err)
+		return
+	}
+
+	helpers.SuccessResponse(deleted, w, r)
+}
+
+// InvitationAccept is the handler for someone following an invitation link, choosing their name and password.
+// Their account is made with the invitation's role and they are logged in.
+func InvitationAccept(w http.ResponseWriter, r *http.Request) {
+	var data invitationAccept                    // Create struct to store data.
+	err := json.NewDecoder(r.Body).Decode(&data) // Decode response to struct.
+	if err != nil {
+		helpers.JSONResponse(acceptResponse{Code: AcceptInternal}, w)
+		helpers.ThrowErr(w, r, "JSON decoding error", err)
+		return
+	}
+
+	valid, id, version := myJWT.CheckInvitationToken(data.Token)
+	if !valid {
+		helpers.JSONResponse(acceptResponse{Code: AcceptExpired}, w)
+		return
+	}
+
+	data.Fname = strings.TrimSpace(data.Fname)
+	data.Lname = strings.TrimSpace(data.Lname)
+
+	if data.Fname == "" || len(data.Fname) > maxNameLength || data.Lname == "" || len(data.Lname) > maxNameLength || len(data.Password) < minPasswordLength {
+		helpers.JSONResponse(acceptResponse{Code: AcceptInvalid}, w)
+		return
+	}
+
+	invitation, err := db.GetInvitation(id)
+	if err != nil {
+		helpers.JSONResponse(acceptResponse{Code: AcceptInternal}, w)
+		helpers.ThrowErr(w, r, "Getting invitation error", err)
+		return
+	}
+
+	if invitation.ID == 0 || !db.RoleExists(invitation.Role.ID) {
+		helpers.JSONResponse(acceptResponse{Code: AcceptExpired}, w)
+		return
+	}
+
+	// Someone may have made an account with the email since they were invited.
+	existing, err := db.GetUserFromEmail(invitation.Email)
+	if err != nil {
+		helpers.JSONResponse(acceptResponse{Code: AcceptInternal}, w)
+		helpers.ThrowErr(w, r, "Getting user error", err)
+		return
+	}
+
+	if existing.UUID != 0 {
+		helpers.JSONResponse(acceptResponse{Code: AcceptExpired}, w)
+		return
+	}
+
+	password, err := helpers.HashPassword(data.Password)
+	if err != nil {
+		helpers.JSONResponse(acceptResponse{Code: AcceptInternal}, w)
+		helpers.ThrowErr(w, r, "Hashing password error", err)
+		return
+	}
+
+	uuid, accepted, err := db.AcceptInvitation(id, version, password, data.Fname, data.Lname)
+	if err != nil {
+		helpers.JSONResponse(acceptResponse{Code: AcceptInternal}, w)
+		helpers.ThrowErr(w, r, "Accepting invitation error", err)
+		return
+	}
+
+	if !accepted {
+		helpers.JSONResponse(acceptResponse{Code: AcceptExpired}, w)
+		return
+	}
+
+	authTokenString, refreshTokenString, csrfSecret, err := myJWT.CreateNewTokens(strconv.Itoa(uuid), r)
+	if err != nil {
+		helpers.JSONResponse(acceptResponse{Code: AcceptInternal}, w)
+		helpers.ThrowErr(w, r, "Creating tokens error", err)
+		return
+	}
+
+	middleware.WriteNewAuth(w, r, authTokenString, refreshTokenString, csrfSecret)
+
+	helpers.JSONResponse(acceptResponse{Code: AcceptSuccess}, w)
+}
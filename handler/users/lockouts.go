@@ -0,0 +1,158 @@
+package users
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/VolticFroogo/Bernies-Busy-Bees/db"
+	"github.com/VolticFroogo/Bernies-Busy-Bees/helpers"
+	"github.com/VolticFroogo/Bernies-Busy-Bees/models"
+)
+
+type lockoutEdit struct {
+	ID int
+}
+
+// loginEmail is the email address failures are counted for, so changing its case doesn't get around a lockout.
+func loginEmail(email string) string {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if len(email) > 255 {
+		email = email[:255]
+	}
+
+	return email
+}
+
+// lockoutTime returns how long to lock logging in for after a number of failures, it doubles with each failure.
+func lockoutTime(failures, allowed int) (lockout time.Duration) {
+	if failures < allowed {
+		return 0
+	}
+
+	lockout = models.LoginLockoutTime
+	for i := allowed; i < failures && lockout < models.LoginLockoutMaxTime; i++ {
+		lockout *= 2
+	}
+
+	if lockout > models.LoginLockoutMaxTime {
+		lockout = models.LoginLockoutMaxTime
+	}
+
+	return
+}
+
+// LoginLocked returns how long until an email and IP address can try to log in again, which is 0 if they can now.
+// An empty email, such as for a passkey login without a password, only checks the IP address.
+func LoginLocked(email, ip string) (retryAfter time.Duration, err error) {
+	var emailLockedUntil int64
+	if email != "" {
+		emailLockedUntil, err = db.GetLockedUntil(models.LoginFailureEmail, loginEmail(email))
+		if err != nil {
+			return
+		}
+	}
+
+	ipLockedUntil, err := db.GetLockedUntil(models.LoginFailureIP, ip)
+	if err != nil {
+		return
+	}
+
+	lockedUntil := emailLockedUntil
+	if ipLockedUntil > lockedUntil {
+		lockedUntil = ipLockedUntil
+	}
+
+	if now := time.Now().Unix(); lockedUntil > now {
+		retryAfter = time.Duration(lockedUntil-now) * time.Second
+	}
+
+	return
+}
+
+// LoginFailed counts a failed login for an email and IP address, locking them after too many failures.
+// The owner of the email address is told the first time it is locked. An empty email only counts the IP address.
+func LoginFailed(email, ip string) (err error) {
+	if email != "" {
+		var failures int
+		failures, err = db.AddLoginFailure(models.LoginFailureEmail, loginEmail(email))
+		if err != nil {
+			return
+		}
+
+		if lockout := lockoutTime(failures, models.LoginFailuresAllowed); lockout > 0 {
+			err = db.LockLogin(models.LoginFailureEmail, loginEmail(email), time.Now().Add(lockout).Unix())
+			if err != nil {
+				return
+			}
+
+			// The login has still failed if the email can't be sent.
+			if err := notifyLockout(email); err != nil {
+				log.Printf("Sending lockout email error: %v", err)
+			}
+		}
+	}
+
+	failures, err := db.AddLoginFailure(models.LoginFailureIP, ip)
+	if err != nil {
+		return
+	}
+
+	if lockout := lockoutTime(failures, models.LoginFailuresAllowedIP); lockout > 0 {
+		err = db.LockLogin(models.LoginFailureIP, ip, time.Now().Add(lockout).Unix())
+	}
+
+	return
+}
+
+// LoginSucceeded forgets the failures of an email address once its owner has logged in or reset their password.
+// The IP address's failures are kept, so someone can't clear them by logging in to their own account.
+func LoginSucceeded(email string) (err error) {
+	return db.ClearLoginFailures(models.LoginFailureEmail, loginEmail(email))
+}
+
+// notifyLockout emails the owner of an account the first time it is locked since its failures were last forgotten.
+func notifyLockout(email string) (err error) {
+	marked, err := db.MarkLoginFailureNotified(models.LoginFailureEmail, loginEmail(email))
+	if err != nil || !marked {
+		return
+	}
+
+	user, err := db.GetUserFromEmail(email)
+	if err != nil || user.UUID == 0 {
+		return // Failures are counted for emails without accounts so they can't be told apart.
+	}
+
+	return sendLockoutEmail(user.Email)
+}
+
+// sendLockoutEmail tells someone logging in to their account has been locked after too many failed attempts.
+func sendLockoutEmail(email string) (err error) {
+	message := "There have been " + strconv.Itoa(models.LoginFailuresAllowed) + " or more failed attempts to log in to your account, so logging in has been paused for a while. " +
+		"If this wasn't you, someone may be trying to guess your password. You can change it here: " + models.SiteURL + "/forgot-password"
+
+	return helpers.SendEmail(email, "Failed login attempts", message, "")
+}
+
+// LockoutClear is the handler for an admin forgetting the failures of an email or IP address, unlocking it.
+func LockoutClear(w http.ResponseWriter, r *http.Request) {
+	var data lockoutEdit                         // Create struct to store data.
+	err := json.NewDecoder(r.Body).Decode(&data) // Decode response to struct.
+	if err != nil {
+		helpers.SuccessResponse(false, w, r)
+		helpers.ThrowErr(w, r, "JSON decoding error", err)
+		return
+	}
+
+	deleted, err := db.DeleteLoginFailure(data.ID)
+	if err != nil {
+		helpers.SuccessResponse(false, w, r)
+		helpers.ThrowErr(w, r, "Deleting login failure error", err)
+		return
+	}
+
+	helpers.SuccessResponse(deleted, w, r)
+}
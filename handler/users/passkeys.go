@@ -0,0 +1,349 @@
+package users
+
+import (
+	cryptoRand "crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/VolticFroogo/Bernies-Busy-Bees/db"
+	"github.com/VolticFroogo/Bernies-Busy-Bees/helpers"
+	"github.com/VolticFroogo/Bernies-Busy-Bees/middleware"
+	"github.com/VolticFroogo/Bernies-Busy-Bees/models"
+)
+
+const (
+	// passkeyChallengeTime is how long a browser has to answer a passkey challenge.
+	passkeyChallengeTime = time.Minute * 5
+	// passkeyChallengeLimit stops unanswered challenges using up memory.
+	passkeyChallengeLimit = 10000
+)
+
+// passkeyOrigin is the address passkeys are used from, WEBAUTHN_ORIGIN changes it for running locally.
+var passkeyOrigin = os.Getenv("WEBAUTHN_ORIGIN")
+
+// passkeyChallenge is what a challenge sent to a browser was for.
+type passkeyChallenge struct {
+	// UUID is the user the passkey must belong to, or 0 when logging in without a password.
+	UUID                    int
+	Registration, RequireUV bool
+	Expiry                  time.Time
+}
+
+var (
+	passkeyChallenges     = map[string]passkeyChallenge{}
+	passkeyChallengesLock sync.Mutex
+)
+
+type passkeyEdit struct {
+	ID                                      int
+	Name, ClientDataJSON, AttestationObject string
+}
+
+// PasskeyAssertion is a browser's answer to a passkey login challenge, every value is base64url.
+type PasskeyAssertion struct {
+	CredentialID, ClientDataJSON, AuthenticatorData, Signature, UserHandle string
+}
+
+// relyingParty returns the origin passkeys are used from and the ID they are registered to.
+func relyingParty() (origin, rpID string) {
+	origin = passkeyOrigin
+	if origin == "" {
+		origin = models.SiteURL
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return origin, ""
+	}
+
+	return origin, u.Hostname()
+}
+
+// newPasskeyChallenge returns a new challenge for a browser to answer, which can only be answered once.
+func newPasskeyChallenge(c passkeyChallenge) (challenge string, err error) {
+	b := make([]byte, 32)
+	_, err = cryptoRand.Read(b)
+	if err != nil {
+		return
+	}
+
+	challenge = base64.RawURLEncoding.EncodeToString(b)
+	c.Expiry = time.Now().Add(passkeyChallengeTime)
+
+	passkeyChallengesLock.Lock()
+	defer passkeyChallengesLock.Unlock()
+
+	for id, existing := range passkeyChallenges {
+		if time.Now().After(existing.Expiry) {
+			delete(passkeyChallenges, id)
+		}
+	}
+
+	if len(passkeyChallenges) >= passkeyChallengeLimit {
+		return "", errors.New("too many passkey challenges")
+	}
+
+	passkeyChallenges[challenge] = c
+	return
+}
+
+// takePasskeyChallenge returns the challenge a browser answered, ok is false if it has expired or been answered.
+func takePasskeyChallenge(clientDataJSON []byte) (challenge string, c passkeyChallenge, ok bool) {
+	challenge = helpers.WebAuthnChallenge(clientDataJSON)
+
+	passkeyChallengesLock.Lock()
+	c, ok = passkeyChallenges[challenge]
+	delete(passkeyChallenges, challenge)
+	passkeyChallengesLock.Unlock()
+
+	return challenge, c, ok && time.Now().Before(c.Expiry)
+}
+
+// passkeyUserID is the user handle passkeys store for a user.
+func passkeyUserID(uuid int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(uuid)))
+}
+
+// PasskeyLoginOptions returns the options for logging in with a passkey.
+// uuid is the user who has already entered their password, or 0 when logging in without a password,
+// in which case the passkey must verify the user with a PIN or biometrics.
+func PasskeyLoginOptions(uuid int) (options models.PasskeyOptions, err error) {
+	_, rpID := relyingParty()
+	options = models.PasskeyOptions{
+		Success:          true,
+		RPID:             rpID,
+		CredentialIDs:    []string{},
+		UserVerification: "required",
+	}
+
+	if uuid != 0 {
+		var passkeys []models.Passkey
+		passkeys, err = db.GetPasskeys(uuid)
+		if err != nil {
+			return
+		}
+
+		for _, passkey := range passkeys {
+			options.CredentialIDs = append(options.CredentialIDs, passkey.CredentialID)
+		}
+
+		options.UserVerification = "discouraged"
+	}
+
+	options.Challenge, err = newPasskeyChallenge(passkeyChallenge{
+		UUID:      uuid,
+		RequireUV: uuid == 0,
+	})
+	return
+}
+
+// CheckPasskey checks a browser's answer to a passkey login challenge, returning the user it logs in.
+func CheckPasskey(assertion PasskeyAssertion) (uuid int, valid bool, err error) {
+	clientDataJSON, err1 := base64.RawURLEncoding.DecodeString(assertion.ClientDataJSON)
+	authenticatorData, err2 := base64.RawURLEncoding.DecodeString(assertion.AuthenticatorData)
+	signature, err3 := base64.RawURLEncoding.DecodeString(assertion.Signature)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return
+	}
+
+	challenge, c, ok := takePasskeyChallenge(clientDataJSON)
+	if !ok || c.Registration {
+		return
+	}
+
+	passkey, exists, err := db.GetPasskeyFromHash(helpers.HashCredentialID(assertion.CredentialID))
+	if err != nil || !exists {
+		return
+	}
+
+	// A user who has entered their password must use one of their own passkeys.
+	if c.UUID != 0 && passkey.UserUUID != c.UUID {
+		return
+	}
+
+	if assertion.UserHandle != "" && assertion.UserHandle != passkeyUserID(passkey.UserUUID) {
+		return
+	}
+
+	publicKey, err := base64.RawURLEncoding.DecodeString(passkey.PublicKey)
+	if err != nil {
+		return
+	}
+
+	origin, rpID := relyingParty()
+	signCount, err := helpers.WebAuthnAssertion(clientDataJSON, authenticatorData, signature, challenge, origin, rpID, publicKey, c.RequireUV)
+	if err != nil {
+		return 0, false, nil // An invalid answer isn't an error.
+	}
+
+	used, err := db.UsePasskey(passkey.ID, int64(signCount), time.Now().Unix())
+	if err != nil {
+		return
+	}
+
+	if !used {
+		log.Printf("Security: passkey %v of user %v sent signature counter %v after %v, it may have been cloned",
+			passkey.ID, passkey.UserUUID, signCount, passkey.SignCount)
+		return
+	}
+
+	return passkey.UserUUID, true, nil
+}
+
+// PasskeyBegin is the handler for a user starting to add a passkey.
+func PasskeyBegin(w http.ResponseWriter, r *http.Request) {
+	user := middleware.User(r)
+
+	passkeys, err := db.GetPasskeys(user.UUID)
+	if err != nil {
+		helpers.SuccessResponse(false, w, r)
+		helpers.ThrowErr(w, r, "Getting passkeys error", err)
+		return
+	}
+
+	challenge, err := newPasskeyChallenge(passkeyChallenge{
+		UUID:         user.UUID,
+		Registration: true,
+	})
+	if err != nil {
+		helpers.SuccessResponse(false, w, r)
+		helpers.ThrowErr(w, r, "Creating passkey challenge error", err)
+		return
+	}
+
+	_, rpID := relyingParty()
+	options := models.PasskeyOptions{
+		Success:          true,
+		Challenge:        challenge,
+		RPID:             rpID,
+		RPName:           siteName,
+		UserID:           passkeyUserID(user.UUID),
+		UserName:         user.Email,
+		UserDisplayName:  user.Fname + " " + user.Lname,
+		CredentialIDs:    []string{}, // Stop the same authenticator being added twice.
+		UserVerification: "preferred",
+	}
+	for _, passkey := range passkeys {
+		options.CredentialIDs = append(options.CredentialIDs, passkey.CredentialID)
+	}
+
+	err = helpers.JSONResponse(options, w)
+	if err != nil {
+		helpers.ThrowErr(w, r, "Sending JSON response error", err)
+	}
+}
+
+// PasskeyNew is the handler for a user finishing adding a passkey.
+func PasskeyNew(w http.ResponseWriter, r *http.Request) {
+	var data passkeyEdit                         // Create struct to store data.
+	err := json.NewDecoder(r.Body).Decode(&data) // Decode response to struct.
+	if err != nil {
+		helpers.SuccessResponse(false, w, r)
+		helpers.ThrowErr(w, r, "JSON decoding error", err)
+		return
+	}
+
+	user := middleware.User(r)
+
+	clientDataJSON, err1 := base64.RawURLEncoding.DecodeString(data.ClientDataJSON)
+	attestationObject, err2 := base64.RawURLEncoding.DecodeString(data.AttestationObject)
+	if data.Name == "" || len(data.Name) > 64 || err1 != nil || err2 != nil {
+		helpers.SuccessResponse(false, w, r)
+		return
+	}
+
+	challenge, c, ok := takePasskeyChallenge(clientDataJSON)
+	if !ok || !c.Registration || c.UUID != user.UUID {
+		helpers.SuccessResponse(false, w, r)
+		return
+	}
+
+	origin, rpID := relyingParty()
+	credentialID, publicKey, signCount, err := helpers.WebAuthnRegistration(clientDataJSON, attestationObject, challenge, origin, rpID, false)
+	if err != nil {
+		helpers.SuccessResponse(false, w, r)
+		return
+	}
+
+	passkey := models.Passkey{
+		UserUUID:     user.UUID,
+		CredentialID: base64.RawURLEncoding.EncodeToString(credentialID),
+		PublicKey:    base64.RawURLEncoding.EncodeToString(publicKey),
+		Name:         data.Name,
+		SignCount:    int64(signCount),
+		CreateTime:   time.Now().Unix(),
+	}
+	hash := helpers.HashCredentialID(passkey.CredentialID)
+
+	_, exists, err := db.GetPasskeyFromHash(hash)
+	if err != nil {
+		helpers.SuccessResponse(false, w, r)
+		helpers.ThrowErr(w, r, "Getting passkey error", err)
+		return
+	}
+
+	if exists {
+		helpers.SuccessResponse(false, w, r)
+		return
+	}
+
+	id, err := db.NewPasskey(passkey, hash)
+	if err != nil {
+		helpers.SuccessResponse(false, w, r)
+		helpers.ThrowErr(w, r, "Creating passkey error", err)
+		return
+	}
+
+	err = helpers.JSONResponse(models.ResponseWithIDInt{
+		Success: true,
+		ID:      id,
+	}, w)
+	if err != nil {
+		helpers.ThrowErr(w, r, "Sending JSON response error", err)
+	}
+}
+
+// PasskeyDelete is the handler for a user removing one of their passkeys.
+func PasskeyDelete(w http.ResponseWriter, r *http.Request) {
+	var data passkeyEdit                         // Create struct to store data.
+	err := json.NewDecoder(r.Body).Decode(&data) // Decode response to struct.
+	if err != nil {
+		helpers.SuccessResponse(false, w, r)
+		helpers.ThrowErr(w, r, "JSON decoding error", err)
+		return
+	}
+
+	user := middleware.User(r)
+
+	// A user whose role requires two-factor authentication can't delete their only second factor.
+	if user.Role.RequireTwoFactor && !user.TwoFactor {
+		passkeys, err := db.GetPasskeys(user.UUID)
+		if err != nil {
+			helpers.SuccessResponse(false, w, r)
+			helpers.ThrowErr(w, r, "Getting passkeys error", err)
+			return
+		}
+
+		if len(passkeys) <= 1 {
+			helpers.SuccessResponse(false, w, r)
+			return
+		}
+	}
+
+	deleted, err := db.DeletePasskey(data.ID, user.UUID)
+	if err != nil {
+		helpers.SuccessResponse(false, w, r)
+		helpers.ThrowErr(w, r, "Deleting passkey error", err)
+		return
+	}
+
+	helpers.SuccessResponse(deleted, w, r)
+}
@@ -0,0 +1,244 @@
+package users
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/VolticFroogo/Bernies-Busy-Bees/db"
+	"github.com/VolticFroogo/Bernies-Busy-Bees/helpers/webauthntest"
+	"github.com/VolticFroogo/Bernies-Busy-Bees/middleware"
+	"github.com/VolticFroogo/Bernies-Busy-Bees/models"
+)
+
+// setupPasskeys opens an empty database with two users.
+func setupPasskeys(t *testing.T) (user, other models.User) {
+	s, err := db.NewSQLite(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.InitStore(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, email := range []string{"user@example.com", "other@example.com"} {
+		id, err := db.NewUser(email, "", "Test", "User", models.RoleParent)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		u, err := db.GetUserFromID(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if i == 0 {
+			user = u
+		} else {
+			other = u
+		}
+	}
+
+	return
+}
+
+// call runs a handler as a logged in user, decoding its JSON response.
+func call(t *testing.T, handler http.HandlerFunc, user models.User, body, response interface{}) {
+	b, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(b))
+	w := httptest.NewRecorder()
+	handler(w, middleware.WithUser(r, user))
+
+	err = json.NewDecoder(w.Body).Decode(response)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// addPasskey registers a new software authenticator for a user through the settings handlers.
+func addPasskey(t *testing.T, user models.User) *webauthntest.Authenticator {
+	origin, rpID := relyingParty()
+	a, err := webauthntest.New(rpID, origin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var options models.PasskeyOptions
+	call(t, PasskeyBegin, user, nil, &options)
+	if !options.Success {
+		t.Fatal("beginning to add a passkey failed")
+	}
+
+	clientDataJSON, attestationObject := a.Create(options.Challenge)
+
+	var response models.ResponseWithIDInt
+	call(t, PasskeyNew, user, passkeyEdit{
+		Name:              "Phone",
+		ClientDataJSON:    base64.RawURLEncoding.EncodeToString(clientDataJSON),
+		AttestationObject: base64.RawURLEncoding.EncodeToString(attestationObject),
+	}, &response)
+	if !response.Success {
+		t.Fatal("adding a passkey failed")
+	}
+
+	return a
+}
+
+// assert has an authenticator answer a login challenge.
+func assert(t *testing.T, a *webauthntest.Authenticator, challenge string) PasskeyAssertion {
+	clientDataJSON, authenticatorData, signature, err := a.Get(challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return PasskeyAssertion{
+		CredentialID:      base64.RawURLEncoding.EncodeToString(a.CredentialID),
+		ClientDataJSON:    base64.RawURLEncoding.EncodeToString(clientDataJSON),
+		AuthenticatorData: base64.RawURLEncoding.EncodeToString(authenticatorData),
+		Signature:         base64.RawURLEncoding.EncodeToString(signature),
+	}
+}
+
+// login answers a new login challenge, uuid is the user who entered their password or 0 for a passwordless login.
+func login(t *testing.T, a *webauthntest.Authenticator, uuid int) (loggedIn int, valid bool) {
+	options, err := PasskeyLoginOptions(uuid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loggedIn, valid, err = CheckPasskey(assert(t, a, options.Challenge))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return
+}
+
+func TestPasskeyRegistration(t *testing.T) {
+	user, _ := setupPasskeys(t)
+
+	a := addPasskey(t, user)
+
+	passkeys, err := db.GetPasskeys(user.UUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(passkeys) != 1 || passkeys[0].CredentialID != base64.RawURLEncoding.EncodeToString(a.CredentialID) {
+		t.Fatalf("the passkey wasn't stored: %+v", passkeys)
+	}
+
+	// A passkey is a second factor, so logging in with a password asks for it and roles requiring one are satisfied.
+	user, err = db.GetUserFromID(user.UUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user.Role.RequireTwoFactor = true
+	if !user.HasTwoFactor() || user.NeedsTwoFactor() {
+		t.Error("the passkey doesn't count as two-factor authentication")
+	}
+
+	// The same authenticator can't be added twice.
+	var options models.PasskeyOptions
+	call(t, PasskeyBegin, user, nil, &options)
+	clientDataJSON, attestationObject := a.Create(options.Challenge)
+
+	var response models.ResponseWithIDInt
+	call(t, PasskeyNew, user, passkeyEdit{
+		Name:              "Again",
+		ClientDataJSON:    base64.RawURLEncoding.EncodeToString(clientDataJSON),
+		AttestationObject: base64.RawURLEncoding.EncodeToString(attestationObject),
+	}, &response)
+	if response.Success {
+		t.Error("the same passkey was added twice")
+	}
+}
+
+func TestPasskeyPasswordless(t *testing.T) {
+	user, _ := setupPasskeys(t)
+	a := addPasskey(t, user)
+
+	uuid, valid := login(t, a, 0)
+	if !valid || uuid != user.UUID {
+		t.Fatalf("passwordless login failed, logged in as %v", uuid)
+	}
+
+	// Without a password, the passkey has to check it's really the user.
+	a.UserVerified = false
+	_, valid = login(t, a, 0)
+	if valid {
+		t.Error("passwordless login without user verification was accepted")
+	}
+}
+
+func TestPasskeySecondFactor(t *testing.T) {
+	user, other := setupPasskeys(t)
+	a := addPasskey(t, user)
+	otherPasskey := addPasskey(t, other)
+
+	// After a password, the passkey only needs to show the user is present.
+	a.UserVerified = false
+	uuid, valid := login(t, a, user.UUID)
+	if !valid || uuid != user.UUID {
+		t.Fatalf("second factor login failed, logged in as %v", uuid)
+	}
+
+	// A passkey belonging to someone else can't be used after entering the user's password.
+	_, valid = login(t, otherPasskey, user.UUID)
+	if valid {
+		t.Error("another user's passkey was accepted as a second factor")
+	}
+}
+
+func TestPasskeyChallengeReplay(t *testing.T) {
+	user, _ := setupPasskeys(t)
+	a := addPasskey(t, user)
+
+	options, err := PasskeyLoginOptions(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertion := assert(t, a, options.Challenge)
+
+	_, valid, err := CheckPasskey(assertion)
+	if err != nil || !valid {
+		t.Fatalf("login failed: %v", err)
+	}
+
+	_, valid, err = CheckPasskey(assertion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if valid {
+		t.Error("a used challenge was accepted again")
+	}
+}
+
+func TestPasskeySignCountRegression(t *testing.T) {
+	user, _ := setupPasskeys(t)
+	a := addPasskey(t, user)
+
+	a.SignCount = 10
+	_, valid := login(t, a, 0)
+	if !valid {
+		t.Fatal("login failed")
+	}
+
+	// A counter going backwards means the passkey may have been cloned.
+	a.SignCount = 5
+	_, valid = login(t, a, 0)
+	if valid {
+		t.Error("a signature counter which went backwards was accepted")
+	}
+}
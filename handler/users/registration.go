@@ -0,0 +1,256 @@
+package users
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VolticFroogo/Bernies-Busy-Bees/db"
+	"github.com/VolticFroogo/Bernies-Busy-Bees/helpers"
+	"github.com/VolticFroogo/Bernies-Busy-Bees/middleware"
+	"github.com/VolticFroogo/Bernies-Busy-Bees/models"
+)
+
+// Register response codes.
+const (
+	RegisterSuccess = iota
+	RegisterInvalid
+	RegisterCaptcha
+	RegisterInternal
+	RegisterSendingEmail
+)
+
+// Lengths of the users table's columns.
+const (
+	maxEmailLength = 256
+	maxNameLength  = 16
+)
+
+// minPasswordLength is the shortest password someone signing up can choose.
+const minPasswordLength = 8
+
+type registration struct {
+	Email, Password, Fname, Lname, Captcha string
+}
+
+type registrationEdit struct {
+	ID, Role int
+}
+
+type registerResponse struct {
+	Code int
+}
+
+type verifiedEmail struct {
+	Email   string
+	Pending bool
+	// CsrfSecret is read by the global JavaScript, the page doesn't send any requests so it is left empty.
+	CsrfSecret string
+}
+
+// checkEmail checks an email address is valid, it is replaced by tests as it looks up the address's mail server.
+var checkEmail = helpers.CheckEmail
+
+var (
+	verificationsSent     = map[int]time.Time{}
+	verificationsSentLock sync.Mutex
+)
+
+// verificationSendAllowed records sending a verification email to a user who signed up, allowed is false if one was
+// sent to them less than VerificationResendTime ago, so signing up again can't be used to flood someone with emails.
+func verificationSendAllowed(uuid int) (allowed bool) {
+	now := time.Now()
+
+	verificationsSentLock.Lock()
+	defer verificationsSentLock.Unlock()
+
+	for key, sent := range verificationsSent {
+		if now.Sub(sent) >= models.VerificationResendTime {
+			delete(verificationsSent, key) // Forget users whose wait is over.
+		}
+	}
+
+	if _, ok := verificationsSent[uuid]; ok {
+		return false
+	}
+
+	verificationsSent[uuid] = now
+	return true
+}
+
+// Register returns the handler for someone signing up from the register page, checking CAPTCHAs with captcha.
+// Their account has no access until they verify their email and an admin approves them.
+func Register(captcha helpers.CaptchaVerifier) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var data registration                        // Create struct to store data.
+		err := json.NewDecoder(r.Body).Decode(&data) // Decode response to struct.
+		if err != nil {
+			helpers.JSONResponse(registerResponse{Code: RegisterInternal}, w)
+			helpers.ThrowErr(w, r, "JSON decoding error", err)
+			return
+		}
+
+		captchaSuccess, err := captcha.Verify(data.Captcha, helpers.ClientIP(r)) // Check the captcha.
+		if err != nil {
+			helpers.JSONResponse(registerResponse{Code: RegisterCaptcha}, w)
+			helpers.ThrowErr(w, r, "Captcha error", err)
+			return
+		}
+		if !captchaSuccess {
+			helpers.JSONResponse(registerResponse{Code: RegisterCaptcha}, w)
+			return // Unsuccessful captcha.
+		}
+
+		data.Email = strings.TrimSpace(data.Email)
+		data.Fname = strings.TrimSpace(data.Fname)
+		data.Lname = strings.TrimSpace(data.Lname)
+
+		if len(data.Email) > maxEmailLength || data.Fname == "" || len(data.Fname) > maxNameLength || data.Lname == "" || len(data.Lname) > maxNameLength || len(data.Password) < minPasswordLength {
+			helpers.JSONResponse(registerResponse{Code: RegisterInvalid}, w)
+			return
+		}
+
+		if checkEmail(data.Email) != nil {
+			helpers.JSONResponse(registerResponse{Code: RegisterInvalid}, w)
+			return
+		}
+
+		existing, err := db.GetUserFromEmail(data.Email)
+		if err != nil {
+			helpers.JSONResponse(registerResponse{Code: RegisterInternal}, w)
+			helpers.ThrowErr(w, r, "Getting user error", err)
+			return
+		}
+
+		password, err := helpers.HashPassword(data.Password)
+		if err != nil {
+			helpers.JSONResponse(registerResponse{Code: RegisterInternal}, w)
+			helpers.ThrowErr(w, r, "Hashing password error", err)
+			return
+		}
+
+		if existing.UUID != 0 {
+			// Nobody has proven they own an unverified email yet, so signing up again replaces the details and sends a
+			// new link, which stops the old links working. A link only ever verifies the details it was sent for,
+			// so nobody can sign up with someone else's email and have them verify a password they didn't choose.
+			if existing.Registration == models.RegistrationUnverified && verificationSendAllowed(existing.UUID) {
+				renewed, err := db.RenewRegistration(existing.UUID, password, data.Fname, data.Lname)
+				if err != nil {
+					helpers.JSONResponse(registerResponse{Code: RegisterInternal}, w)
+					helpers.ThrowErr(w, r, "Renewing registration error", err)
+					return
+				}
+
+				if renewed {
+					err = SendEmailVerification(existing, data.Email)
+					if err != nil {
+						helpers.JSONResponse(registerResponse{Code: RegisterSendingEmail}, w)
+						helpers.ThrowErr(w, r, "Sending verification email error", err)
+						return
+					}
+				}
+			}
+
+			// Reply the same as signing up so the page can't be used to find out who has an account.
+			helpers.JSONResponse(registerResponse{Code: RegisterSuccess}, w)
+			return
+		}
+
+		uuid, err := db.NewRegistration(data.Email, password, data.Fname, data.Lname)
+		if err != nil {
+			helpers.JSONResponse(registerResponse{Code: RegisterInternal}, w)
+			helpers.ThrowErr(w, r, "Creating registration error", err)
+			return
+		}
+
+		user := models.User{
+			UUID:  uuid,
+			Fname: data.Fname,
+			Lname: data.Lname,
+		}
+
+		verificationSendAllowed(uuid) // Start waiting before the verification email can be sent again.
+
+		err = SendEmailVerification(user, data.Email)
+		if err != nil {
+			helpers.JSONResponse(registerResponse{Code: RegisterSendingEmail}, w)
+			helpers.ThrowErr(w, r, "Sending verification email error", err)
+			return
+		}
+
+		helpers.JSONResponse(registerResponse{Code: RegisterSuccess}, w)
+	}
+}
+
+// RegistrationApprove is the handler for an admin approving someone who signed up, giving them a role.
+func RegistrationApprove(w http.ResponseWriter, r *http.Request) {
+	var data registrationEdit                    // Create struct to store data.
+	err := json.NewDecoder(r.Body).Decode(&data) // Decode response to struct.
+	if err != nil {
+		helpers.SuccessResponse(false, w, r)
+		helpers.ThrowErr(w, r, "JSON decoding error", err)
+		return
+	}
+
+	if !CanGrantRole(middleware.User(r), data.Role) {
+		helpers.SuccessResponse(false, w, r)
+		return
+	}
+
+	// The user is read in the same step as approving them, which only succeeds if they are waiting and the role exists.
+	user, approved, err := db.ApproveRegistration(data.ID, data.Role)
+	if err != nil {
+		helpers.SuccessResponse(false, w, r)
+		helpers.ThrowErr(w, r, "Approving registration error", err)
+		return
+	}
+
+	helpers.SuccessResponse(approved, w, r)
+	if !approved {
+		return
+	}
+
+	err = helpers.SendEmail(user.Email, "Your account has been approved", "Hi "+user.Fname+", your account at "+siteName+" has been approved. You can log in here: "+models.SiteURL+"/login", "")
+	if err != nil {
+		helpers.ThrowErr(w, r, "Sending approval email error", err)
+	}
+}
+
+// RegistrationReject is the handler for an admin rejecting someone who signed up, deleting their account.
+func RegistrationReject(w http.ResponseWriter, r *http.Request) {
+	var data registrationEdit                    // Create struct to store data.
+	err := json.NewDecoder(r.Body).Decode(&data) // Decode response to struct.
+	if err != nil {
+		helpers.SuccessResponse(false, w, r)
+		helpers.ThrowErr(w, r, "JSON decoding error", err)
+		return
+	}
+
+	user, err := db.GetUserFromID(data.ID)
+	if err != nil {
+		helpers.SuccessResponse(false, w, r)
+		helpers.ThrowErr(w, r, "Getting user error", err)
+		return
+	}
+
+	if user.Registration != models.RegistrationPending {
+		helpers.SuccessResponse(false, w, r)
+		return
+	}
+
+	err = db.DeleteUser(data.ID)
+	if err != nil {
+		helpers.SuccessResponse(false, w, r)
+		helpers.ThrowErr(w, r, "Deleting user error", err)
+		return
+	}
+
+	helpers.SuccessResponse(true, w, r)
+
+	err = helpers.SendEmail(user.Email, "Your account wasn't approved", "Hi "+user.Fname+", sorry, your request for an account at "+siteName+" wasn't approved. If you think this was a mistake, contact Bernie.", "")
+	if err != nil {
+		helpers.ThrowErr(w, r, "Sending rejection email error", err)
+	}
+}
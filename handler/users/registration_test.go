@@ -0,0 +1,125 @@
+package users
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/VolticFroogo/Bernies-Busy-Bees/db"
+	"github.com/VolticFroogo/Bernies-Busy-Bees/helpers"
+	"github.com/VolticFroogo/Bernies-Busy-Bees/models"
+	"github.com/gorilla/mux"
+)
+
+// testMailer keeps every email instead of sending it.
+type testMailer struct {
+	emails *[]helpers.Email
+}
+
+func (m testMailer) Send(email helpers.Email) (err error) {
+	*m.emails = append(*m.emails, email)
+	return
+}
+
+// setupRegistration opens an empty database, returning the emails sent after it.
+func setupRegistration(t *testing.T) (emails *[]helpers.Email) {
+	s, err := db.NewSQLite(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.InitStore(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	emails = &[]helpers.Email{}
+	helpers.InitMailer(testMailer{emails})
+
+	checkEmail = func(email string) error { return nil } // There are no mail servers to look up.
+	verificationsSent = map[int]time.Time{}
+
+	return
+}
+
+// signUp signs up from the register page, returning the verification code emailed for it, if any.
+func signUp(t *testing.T, emails *[]helpers.Email, email, password string) (code string) {
+	sent := len(*emails)
+
+	body := `{"Email":"` + email + `","Password":"` + password + `","Fname":"Test","Lname":"User"}`
+	w := httptest.NewRecorder()
+	Register(helpers.FakeCaptcha{})(w, httptest.NewRequest(http.MethodPost, "/register", bytes.NewBufferString(body)))
+
+	if !strings.Contains(w.Body.String(), `"Code":0`) {
+		t.Fatalf("signing up failed: %v", w.Body.String())
+	}
+
+	if len(*emails) == sent {
+		return
+	}
+
+	text := (*emails)[len(*emails)-1].Text
+	return text[strings.LastIndex(text, "/verify-email/")+len("/verify-email/"):]
+}
+
+// verify clicks a verification link.
+func verify(code string) {
+	r := httptest.NewRequest(http.MethodGet, "/verify-email/"+code, nil)
+	VerifyEmail(httptest.NewRecorder(), mux.SetURLVars(r, map[string]string{"code": code}))
+}
+
+func TestRegisterAgainReplacesDetails(t *testing.T) {
+	emails := setupRegistration(t)
+
+	// Someone signs up first with an email they don't own.
+	attackerCode := signUp(t, emails, "victim@example.com", "attacker-password")
+	if attackerCode == "" {
+		t.Fatal("no verification email was sent")
+	}
+
+	user, err := db.GetUserFromEmail("victim@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Signing up again straight away changes nothing and sends no email.
+	if signUp(t, emails, "victim@example.com", "impatient-password") != "" {
+		t.Error("a verification email was sent again before the wait was over")
+	}
+
+	verificationsSent[user.UUID] = time.Now().Add(-models.VerificationResendTime)
+
+	// The owner of the email signs up after the wait.
+	victimCode := signUp(t, emails, "victim@example.com", "victim-password")
+	if victimCode == "" {
+		t.Fatal("no verification email was sent for the second sign up")
+	}
+
+	verify(attackerCode)
+	user, err = db.GetUserFromID(user.UUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Registration != models.RegistrationUnverified {
+		t.Fatal("the first sign up's link verified the email after signing up again")
+	}
+
+	verify(victimCode)
+	user, err = db.GetUserFromID(user.UUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Registration != models.RegistrationPending {
+		t.Fatal("the second sign up's link didn't verify the email")
+	}
+
+	if !helpers.CheckPassword("victim-password", user.Password) {
+		t.Error("the second sign up's password doesn't work after verifying")
+	}
+	if helpers.CheckPassword("attacker-password", user.Password) || helpers.CheckPassword("impatient-password", user.Password) {
+		t.Error("another sign up's password works after verifying")
+	}
+}
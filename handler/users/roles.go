@@ -0,0 +1,169 @@
+package users
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/VolticFroogo/Bernies-Busy-Bees/db"
+	"github.com/VolticFroogo/Bernies-Busy-Bees/helpers"
+	"github.com/VolticFroogo/Bernies-Busy-Bees/middleware"
+	"github.com/VolticFroogo/Bernies-Busy-Bees/models"
+)
+
+// ErrInvalidRole is returned when a role's name or permissions aren't allowed.
+var ErrInvalidRole = errors.New("invalid role")
+
+type roleEdit struct {
+	ID               int
+	Name             string
+	Permissions      []string
+	RequireTwoFactor bool
+}
+
+// CheckRole validates a role's name and permissions, which user must have every one of themselves.
+// ID is the role being edited, or 0 for a new role, so it doesn't clash with its own name.
+func CheckRole(user models.User, ID int, name string, permissions []string) (err error) {
+	if name == "" || len(name) > 32 {
+		return ErrInvalidRole
+	}
+
+	for _, role := range db.Roles() {
+		if role.ID != ID && role.Name == name {
+			return ErrInvalidRole
+		}
+	}
+
+	for i, permission := range permissions {
+		if !models.ValidPermission(permission) || !models.Authorize(user, permission) {
+			return ErrInvalidRole
+		}
+
+		for _, previous := range permissions[:i] {
+			if previous == permission {
+				return ErrInvalidRole
+			}
+		}
+	}
+
+	return
+}
+
+// CanGrantRole returns if a role exists and a user is allowed to give it to someone.
+// Like the scopes of a token, a user can only give a role which has no permissions they don't have themselves.
+func CanGrantRole(user models.User, ID int) bool {
+	if !db.RoleExists(ID) {
+		return false
+	}
+
+	for _, permission := range db.GetRole(ID).Permissions {
+		if !models.Authorize(user, permission) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// GrantableRoles returns every role a user is allowed to give to someone.
+func GrantableRoles(user models.User) (roles models.Roles) {
+	for _, role := range db.Roles() {
+		if CanGrantRole(user, role.ID) {
+			roles = append(roles, role)
+		}
+	}
+
+	return
+}
+
+// RoleNew is the handler for the new role request.
+func RoleNew(w http.ResponseWriter, r *http.Request) {
+	var data roleEdit                            // Create struct to store data.
+	err := json.NewDecoder(r.Body).Decode(&data) // Decode response to struct.
+	if err != nil {
+		helpers.SuccessResponse(false, w, r)
+		helpers.ThrowErr(w, r, "JSON decoding error", err)
+		return
+	}
+
+	if CheckRole(middleware.User(r), 0, data.Name, data.Permissions) != nil {
+		helpers.SuccessResponse(false, w, r)
+		return
+	}
+
+	id, err := db.NewRole(data.Name, data.Permissions, data.RequireTwoFactor)
+	if err != nil {
+		helpers.SuccessResponse(false, w, r)
+		helpers.ThrowErr(w, r, "Creating role error", err)
+		return
+	}
+
+	err = helpers.JSONResponse(models.ResponseWithIDInt{
+		Success: true,
+		ID:      id,
+	}, w)
+	if err != nil {
+		helpers.ThrowErr(w, r, "Sending JSON response error", err)
+	}
+}
+
+// RoleUpdate is the handler for the update role request.
+func RoleUpdate(w http.ResponseWriter, r *http.Request) {
+	var data roleEdit                            // Create struct to store data.
+	err := json.NewDecoder(r.Body).Decode(&data) // Decode response to struct.
+	if err != nil {
+		helpers.SuccessResponse(false, w, r)
+		helpers.ThrowErr(w, r, "JSON decoding error", err)
+		return
+	}
+
+	user := middleware.User(r)
+
+	// Like giving a role, a user can only edit roles with no permissions they don't have themselves.
+	if !CanGrantRole(user, data.ID) || CheckRole(user, data.ID, data.Name, data.Permissions) != nil {
+		helpers.SuccessResponse(false, w, r)
+		return
+	}
+
+	// Stop the user locking themselves out of the role editor.
+	if data.ID == user.Role.ID && !(models.Role{Permissions: data.Permissions}).Has(models.PermRolesManage) {
+		helpers.SuccessResponse(false, w, r)
+		return
+	}
+
+	err = db.EditRole(data.ID, data.Name, data.Permissions, data.RequireTwoFactor)
+	if err != nil {
+		helpers.SuccessResponse(false, w, r)
+		helpers.ThrowErr(w, r, "Editing role error", err)
+		return
+	}
+
+	helpers.SuccessResponse(true, w, r)
+}
+
+// RoleDelete is the handler for the delete role request.
+// Roles which users still have can't be deleted, nor can the default role new users are given,
+// nor roles with permissions the user doesn't have.
+func RoleDelete(w http.ResponseWriter, r *http.Request) {
+	var data roleEdit                            // Create struct to store data.
+	err := json.NewDecoder(r.Body).Decode(&data) // Decode response to struct.
+	if err != nil {
+		helpers.SuccessResponse(false, w, r)
+		helpers.ThrowErr(w, r, "JSON decoding error", err)
+		return
+	}
+
+	if data.ID == models.RoleNone || !CanGrantRole(middleware.User(r), data.ID) {
+		helpers.SuccessResponse(false, w, r)
+		return
+	}
+
+	inUse, err := db.DeleteRole(data.ID)
+	if err != nil {
+		helpers.SuccessResponse(false, w, r)
+		helpers.ThrowErr(w, r, "Deleting role error", err)
+		return
+	}
+
+	helpers.SuccessResponse(!inUse, w, r)
+}
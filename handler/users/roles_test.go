@@ -0,0 +1,100 @@
+package users
+
+import (
+	"testing"
+
+	"github.com/VolticFroogo/Bernies-Busy-Bees/db"
+	"github.com/VolticFroogo/Bernies-Busy-Bees/models"
+)
+
+// setupRoles opens an empty database with a user whose role can manage roles but not users.
+func setupRoles(t *testing.T) (manager models.User) {
+	s, err := db.NewSQLite(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.InitStore(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	role, err := db.NewRole("Role manager", []string{models.PermPanel, models.PermRolesManage, models.PermCommentsCreate}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := db.NewUser("manager@example.com", "", "Role", "Manager", role)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manager, err = db.GetUserFromID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return
+}
+
+func TestRoleNewPermissions(t *testing.T) {
+	manager := setupRoles(t)
+
+	var response models.ResponseWithIDInt
+	call(t, RoleNew, manager, roleEdit{Name: "Escalated", Permissions: []string{models.PermPanel, models.PermUsersManage}}, &response)
+	if response.Success {
+		t.Error("a role was created with a permission the user doesn't have")
+	}
+
+	response = models.ResponseWithIDInt{}
+	call(t, RoleNew, manager, roleEdit{Name: "Commenter", Permissions: []string{models.PermPanel, models.PermCommentsCreate}}, &response)
+	if !response.Success {
+		t.Error("a role with the user's own permissions couldn't be created")
+	}
+}
+
+func TestRoleUpdatePermissions(t *testing.T) {
+	manager := setupRoles(t)
+
+	// Adding a permission to their own role would give it to the user.
+	var response models.ResponseWithIDInt
+	call(t, RoleUpdate, manager, roleEdit{ID: manager.Role.ID, Name: manager.Role.Name, Permissions: append(manager.Role.Permissions, models.PermUsersManage)}, &response)
+	if response.Success {
+		t.Error("a permission the user doesn't have was added to their role")
+	}
+
+	admin := db.GetRole(models.RoleAdmin)
+	response = models.ResponseWithIDInt{}
+	call(t, RoleUpdate, manager, roleEdit{ID: admin.ID, Name: "Renamed", Permissions: []string{models.PermPanel}}, &response)
+	if response.Success {
+		t.Error("a role with permissions the user doesn't have was edited")
+	}
+
+	parent := db.GetRole(models.RoleParent)
+	response = models.ResponseWithIDInt{}
+	call(t, RoleUpdate, manager, roleEdit{ID: parent.ID, Name: parent.Name, Permissions: []string{models.PermPanel}}, &response)
+	if !response.Success {
+		t.Error("a role with the user's own permissions couldn't be edited")
+	}
+}
+
+func TestRoleDeletePermissions(t *testing.T) {
+	manager := setupRoles(t)
+
+	var response models.ResponseWithIDInt
+	call(t, RoleDelete, manager, roleEdit{ID: models.RoleAdmin}, &response)
+	if response.Success || !db.RoleExists(models.RoleAdmin) {
+		t.Error("a role with permissions the user doesn't have was deleted")
+	}
+
+	id, err := db.NewRole("Unused", []string{models.PermPanel}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response = models.ResponseWithIDInt{}
+	call(t, RoleDelete, manager, roleEdit{ID: id}, &response)
+	if !response.Success {
+		t.Error("an unused role with the user's own permissions couldn't be deleted")
+	}
+}
@@ -9,11 +9,8 @@ import (
 	"github.com/VolticFroogo/Bernies-Busy-Bees/db"
 	"github.com/VolticFroogo/Bernies-Busy-Bees/helpers"
 	"github.com/VolticFroogo/Bernies-Busy-Bees/middleware"
+	"github.com/VolticFroogo/Bernies-Busy-Bees/middleware/myJWT"
 	"github.com/VolticFroogo/Bernies-Busy-Bees/models"
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/ses"
-	"github.com/gorilla/context"
 	"github.com/gorilla/mux"
 	"github.com/zemirco/uid"
 )
@@ -28,24 +25,7 @@ func Settings(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !middleware.AJAX(w, r, models.AJAXData{CsrfSecret: data.CsrfSecret}) {
-		// Failed middleware (invalid credentials)
-		helpers.SuccessResponse(false, w, r)
-		return
-	}
-
-	uuidString := context.Get(r, "uuid").(string)
-	uuid, err := strconv.Atoi(uuidString)
-	if err != nil {
-		helpers.SuccessResponse(false, w, r)
-		helpers.ThrowErr(w, r, "Error converting string to int", err)
-	}
-
-	user, err := db.GetUserFromID(uuid)
-	if err != nil {
-		helpers.SuccessResponse(false, w, r)
-		helpers.ThrowErr(w, r, "Error getting user from ID", err)
-	}
+	user := middleware.User(r)
 
 	if data.Password == "" {
 		err = db.EditSelfNoPassword(user.UUID, data.Fname, data.Lname)
@@ -68,6 +48,16 @@ func Settings(w http.ResponseWriter, r *http.Request) {
 			helpers.ThrowErr(w, r, "Editing user error", err)
 			return
 		}
+
+		// Changing the password logs out every session, so keep this one logged in with new tokens.
+		authTokenString, refreshTokenString, csrfSecret, err := myJWT.CreateNewTokens(strconv.Itoa(user.UUID), r)
+		if err != nil {
+			helpers.SuccessResponse(false, w, r)
+			helpers.ThrowErr(w, r, "Creating tokens error", err)
+			return
+		}
+
+		middleware.WriteNewAuth(w, r, authTokenString, refreshTokenString, csrfSecret)
 	}
 
 	if data.Email != user.Email {
@@ -89,7 +79,7 @@ func Settings(w http.ResponseWriter, r *http.Request) {
 
 // SendEmailVerification is the start of the email verification process.
 func SendEmailVerification(user models.User, email string) (err error) {
-	err = helpers.CheckEmail(email)
+	err = checkEmail(email)
 	if err != nil {
 		return
 	}
@@ -101,47 +91,11 @@ func SendEmailVerification(user models.User, email string) (err error) {
 		return
 	}
 
-	sess, err := session.NewSession(&aws.Config{
-		Region: aws.String("eu-west-1")},
-	)
-	if err != nil {
-		return
-	}
-
-	// Create an SES session.
-	svc := ses.New(sess)
-
-	// Assemble the email.
-	input := &ses.SendEmailInput{
-		Destination: &ses.Destination{
-			CcAddresses: []*string{},
-			ToAddresses: []*string{
-				aws.String(email),
-			},
-		},
-		Message: &ses.Message{
-			Body: &ses.Body{
-				Html: &ses.Content{
-					Charset: aws.String("UTF-8"),
-					Data:    aws.String("To verify your email please click this link: <a href=\"https://berniesbusybees.co.uk/verify-email/" + id + "\">verify email</a>."),
-				},
-				Text: &ses.Content{
-					Charset: aws.String("UTF-8"),
-					Data:    aws.String("To verify your email please click this link: https://berniesbusybees.co.uk/verify-email/" + id),
-				},
-			},
-			Subject: &ses.Content{
-				Charset: aws.String("UTF-8"),
-				Data:    aws.String("Verify your email"),
-			},
-		},
-		Source: aws.String("noreply@berniesbusybees.co.uk"),
-	}
-
-	// Attempt to send the email.
-	_, err = svc.SendEmail(input)
+	link := models.SiteURL + "/verify-email/" + id
 
-	return
+	return helpers.SendEmail(email, "Verify your email",
+		"To verify your email please click this link: "+link,
+		"To verify your email please click this link: <a href=\""+link+"\">verify email</a>.")
 }
 
 // VerifyEmail is for verifying emails after a client clicks the verification URL.
@@ -165,13 +119,24 @@ func VerifyEmail(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Someone who signed up themselves waits for approval once their email is verified.
+	pending, err := db.VerifyRegistration(userUUID)
+	if err != nil {
+		helpers.ThrowErr(w, r, "Verifying registration error", err)
+		return
+	}
+
 	t, err := template.ParseFiles("handler/templates/verified-email.html", "handler/templates/nested.html") // Parse the HTML pages
 	if err != nil {
 		helpers.ThrowErr(w, r, "Template parsing error", err)
 		return
 	}
 
-	err = t.Execute(w, email) // Execute temmplate with variables
+	variables := verifiedEmail{
+		Email:   email,
+		Pending: pending,
+	}
+	err = t.Execute(w, variables) // Execute temmplate with variables
 	if err != nil {
 		helpers.ThrowErr(w, r, "Template execution error", err)
 	}
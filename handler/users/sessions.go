@@ -0,0 +1,93 @@
+package users
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/VolticFroogo/Bernies-Busy-Bees/db"
+	"github.com/VolticFroogo/Bernies-Busy-Bees/helpers"
+	"github.com/VolticFroogo/Bernies-Busy-Bees/middleware"
+	"github.com/VolticFroogo/Bernies-Busy-Bees/middleware/myJWT"
+	"github.com/VolticFroogo/Bernies-Busy-Bees/models"
+)
+
+type sessionEdit struct {
+	Family string
+}
+
+// Sessions returns every session a user is logged in with, marking the one making the request.
+func Sessions(r *http.Request, userUUID int) (sessions []models.Session, err error) {
+	sessions, err = db.GetSessions(userUUID)
+	if err != nil {
+		return
+	}
+
+	refreshTokenString, err := r.Cookie("refreshToken")
+	if err != nil {
+		return sessions, nil // Bearer token requests aren't a session.
+	}
+
+	current := myJWT.Family(refreshTokenString.Value)
+	for i := range sessions {
+		sessions[i].Current = current != "" && sessions[i].Family == current
+	}
+
+	return
+}
+
+// SessionDelete is the handler for a user logging out one of their sessions.
+func SessionDelete(w http.ResponseWriter, r *http.Request) {
+	var data sessionEdit                         // Create struct to store data.
+	err := json.NewDecoder(r.Body).Decode(&data) // Decode response to struct.
+	if err != nil {
+		helpers.SuccessResponse(false, w, r)
+		helpers.ThrowErr(w, r, "JSON decoding error", err)
+		return
+	}
+
+	user := middleware.User(r)
+
+	deleted, err := db.DeleteSession(data.Family, user.UUID)
+	if err != nil {
+		helpers.SuccessResponse(false, w, r)
+		helpers.ThrowErr(w, r, "Deleting session error", err)
+		return
+	}
+
+	helpers.SuccessResponse(deleted, w, r)
+}
+
+// SessionDeleteAll is the handler for a user logging out everywhere, including the session making the request.
+func SessionDeleteAll(w http.ResponseWriter, r *http.Request) {
+	user := middleware.User(r)
+
+	err := db.DeleteSessions(user.UUID)
+	if err != nil {
+		helpers.SuccessResponse(false, w, r)
+		helpers.ThrowErr(w, r, "Deleting sessions error", err)
+		return
+	}
+
+	middleware.WriteNewAuth(w, r, "", "", "")
+	helpers.SuccessResponse(true, w, r)
+}
+
+// UserSessionsDelete is the handler for logging another user out everywhere.
+func UserSessionsDelete(w http.ResponseWriter, r *http.Request) {
+	var data edit                                // Create struct to store data.
+	err := json.NewDecoder(r.Body).Decode(&data) // Decode response to struct.
+	if err != nil {
+		helpers.SuccessResponse(false, w, r)
+		helpers.ThrowErr(w, r, "JSON decoding error", err)
+		return
+	}
+
+	err = db.DeleteSessions(data.ID)
+	if err != nil {
+		helpers.SuccessResponse(false, w, r)
+		helpers.ThrowErr(w, r, "Deleting sessions error", err)
+		return
+	}
+
+	helpers.SuccessResponse(true, w, r)
+}
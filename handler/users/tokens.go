@@ -0,0 +1,148 @@
+package users
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/VolticFroogo/Bernies-Busy-Bees/db"
+	"github.com/VolticFroogo/Bernies-Busy-Bees/helpers"
+	"github.com/VolticFroogo/Bernies-Busy-Bees/middleware"
+	"github.com/VolticFroogo/Bernies-Busy-Bees/models"
+)
+
+type tokenEdit struct {
+	ID     int
+	Name   string
+	Scopes []string
+}
+
+type newTokenResponse struct {
+	Success bool   `json:"success"`
+	ID      int    `json:"id"`
+	Token   string `json:"token"`
+	Prefix  string `json:"prefix"`
+}
+
+// ErrInvalidAccessToken is returned when a new access token has no name or a scope the user can't give it.
+var ErrInvalidAccessToken = errors.New("invalid new access token")
+
+// NewAccessToken creates a personal access token for a user.
+// The token itself is only ever returned here, afterwards only its prefix is known.
+func NewAccessToken(user models.User, name string, scopes []string) (tokenString string, token models.AccessToken, err error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 64 || len(scopes) == 0 {
+		err = ErrInvalidAccessToken
+		return
+	}
+
+	for i, scope := range scopes {
+		if !CanGrantScope(user, scope) {
+			err = ErrInvalidAccessToken
+			return
+		}
+
+		for _, previous := range scopes[:i] {
+			if previous == scope {
+				err = ErrInvalidAccessToken
+				return
+			}
+		}
+	}
+
+	tokenString, hash, err := helpers.GenerateAccessToken(models.AccessTokenPrefix)
+	if err != nil {
+		return
+	}
+
+	token = models.AccessToken{
+		UserUUID:   user.UUID,
+		Name:       name,
+		Prefix:     tokenString[:len(models.AccessTokenPrefix)+6],
+		Scopes:     scopes,
+		CreateTime: time.Now().Unix(),
+	}
+
+	token.ID, err = db.NewAccessToken(token, hash)
+	return
+}
+
+// CanGrantScope returns if a scope exists and a user is allowed to give it to a token.
+func CanGrantScope(user models.User, scope string) bool {
+	for _, s := range models.Scopes {
+		if s.Name == scope {
+			return s.Permission == "" || models.Authorize(user, s.Permission)
+		}
+	}
+
+	return false
+}
+
+// GrantableScopes returns every scope a user is allowed to give to a token.
+func GrantableScopes(user models.User) (scopes []models.Scope) {
+	for _, s := range models.Scopes {
+		if CanGrantScope(user, s.Name) {
+			scopes = append(scopes, s)
+		}
+	}
+
+	return
+}
+
+// TokenNew is the handler for a user creating a personal access token.
+func TokenNew(w http.ResponseWriter, r *http.Request) {
+	var data tokenEdit                           // Create struct to store data.
+	err := json.NewDecoder(r.Body).Decode(&data) // Decode response to struct.
+	if err != nil {
+		helpers.SuccessResponse(false, w, r)
+		helpers.ThrowErr(w, r, "JSON decoding error", err)
+		return
+	}
+
+	user := middleware.User(r)
+
+	tokenString, token, err := NewAccessToken(user, data.Name, data.Scopes)
+	if err == ErrInvalidAccessToken {
+		helpers.SuccessResponse(false, w, r)
+		return
+	}
+	if err != nil {
+		helpers.SuccessResponse(false, w, r)
+		helpers.ThrowErr(w, r, "Creating access token error", err)
+		return
+	}
+
+	err = helpers.JSONResponse(newTokenResponse{
+		Success: true,
+		ID:      token.ID,
+		Token:   tokenString,
+		Prefix:  token.Prefix,
+	}, w)
+	if err != nil {
+		helpers.ThrowErr(w, r, "Sending JSON response error", err)
+	}
+}
+
+// TokenDelete is the handler for a user revoking one of their personal access tokens.
+func TokenDelete(w http.ResponseWriter, r *http.Request) {
+	var data tokenEdit                           // Create struct to store data.
+	err := json.NewDecoder(r.Body).Decode(&data) // Decode response to struct.
+	if err != nil {
+		helpers.SuccessResponse(false, w, r)
+		helpers.ThrowErr(w, r, "JSON decoding error", err)
+		return
+	}
+
+	user := middleware.User(r)
+
+	deleted, err := db.DeleteAccessToken(data.ID, user.UUID)
+	if err != nil {
+		helpers.SuccessResponse(false, w, r)
+		helpers.ThrowErr(w, r, "Deleting access token error", err)
+		return
+	}
+
+	helpers.SuccessResponse(deleted, w, r)
+}
@@ -0,0 +1,200 @@
+package users
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/VolticFroogo/Bernies-Busy-Bees/db"
+	"github.com/VolticFroogo/Bernies-Busy-Bees/helpers"
+	"github.com/VolticFroogo/Bernies-Busy-Bees/middleware"
+	"github.com/VolticFroogo/Bernies-Busy-Bees/models"
+)
+
+// siteName is the name authenticator apps and passkeys show for the site.
+const siteName = "Bernie's Busy Bees"
+
+type twoFactorEdit struct {
+	Secret, Code string
+}
+
+// CheckTwoFactor checks a user's TOTP code or one of their recovery codes, using it up so it can't be used again.
+func CheckTwoFactor(uuid int, code string) (valid bool, err error) {
+	secret, lastStep, err := db.GetTwoFactor(uuid)
+	if err != nil || secret == "" {
+		return
+	}
+
+	if step, ok := helpers.CheckTOTP(secret, code, lastStep, time.Now()); ok {
+		return db.UseTOTPStep(uuid, step)
+	}
+
+	return db.UseRecoveryCode(uuid, helpers.HashRecoveryCode(code))
+}
+
+// TwoFactorNew is the handler for a user starting to set up two-factor authentication.
+// The secret isn't stored until they confirm it with a code from their authenticator app.
+func TwoFactorNew(w http.ResponseWriter, r *http.Request) {
+	user := middleware.User(r)
+
+	secret, err := helpers.GenerateTOTPSecret()
+	if err != nil {
+		helpers.SuccessResponse(false, w, r)
+		helpers.ThrowErr(w, r, "Generating TOTP secret error", err)
+		return
+	}
+
+	err = helpers.JSONResponse(models.TwoFactorSecret{
+		Success: true,
+		Secret:  secret,
+		URI:     helpers.TOTPURI(siteName, user.Email, secret),
+	}, w)
+	if err != nil {
+		helpers.ThrowErr(w, r, "Sending JSON response error", err)
+	}
+}
+
+// TwoFactorEnable is the handler for a user confirming their new TOTP secret, which gives them their recovery codes.
+func TwoFactorEnable(w http.ResponseWriter, r *http.Request) {
+	var data twoFactorEdit                       // Create struct to store data.
+	err := json.NewDecoder(r.Body).Decode(&data) // Decode response to struct.
+	if err != nil {
+		helpers.SuccessResponse(false, w, r)
+		helpers.ThrowErr(w, r, "JSON decoding error", err)
+		return
+	}
+
+	user := middleware.User(r)
+
+	if user.TwoFactor {
+		helpers.SuccessResponse(false, w, r)
+		return
+	}
+
+	step, valid := helpers.CheckTOTP(data.Secret, data.Code, 0, time.Now())
+	if !valid {
+		helpers.SuccessResponse(false, w, r)
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		helpers.SuccessResponse(false, w, r)
+		helpers.ThrowErr(w, r, "Generating recovery codes error", err)
+		return
+	}
+
+	err = db.EnableTwoFactor(user.UUID, data.Secret, step, hashes)
+	if err != nil {
+		helpers.SuccessResponse(false, w, r)
+		helpers.ThrowErr(w, r, "Enabling two-factor authentication error", err)
+		return
+	}
+
+	recoveryCodesResponse(codes, w, r)
+}
+
+// TwoFactorDisable is the handler for a user turning off two-factor authentication.
+// Users whose role requires it can't turn it off.
+func TwoFactorDisable(w http.ResponseWriter, r *http.Request) {
+	var data twoFactorEdit                       // Create struct to store data.
+	err := json.NewDecoder(r.Body).Decode(&data) // Decode response to struct.
+	if err != nil {
+		helpers.SuccessResponse(false, w, r)
+		helpers.ThrowErr(w, r, "JSON decoding error", err)
+		return
+	}
+
+	user := middleware.User(r)
+
+	if user.Role.RequireTwoFactor {
+		helpers.SuccessResponse(false, w, r)
+		return
+	}
+
+	valid, err := CheckTwoFactor(user.UUID, data.Code)
+	if err != nil {
+		helpers.SuccessResponse(false, w, r)
+		helpers.ThrowErr(w, r, "Checking two-factor code error", err)
+		return
+	}
+
+	if !valid {
+		helpers.SuccessResponse(false, w, r)
+		return
+	}
+
+	err = db.DisableTwoFactor(user.UUID)
+	if err != nil {
+		helpers.SuccessResponse(false, w, r)
+		helpers.ThrowErr(w, r, "Disabling two-factor authentication error", err)
+		return
+	}
+
+	helpers.SuccessResponse(true, w, r)
+}
+
+// TwoFactorRecoveryCodes is the handler for a user replacing their recovery codes.
+func TwoFactorRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	var data twoFactorEdit                       // Create struct to store data.
+	err := json.NewDecoder(r.Body).Decode(&data) // Decode response to struct.
+	if err != nil {
+		helpers.SuccessResponse(false, w, r)
+		helpers.ThrowErr(w, r, "JSON decoding error", err)
+		return
+	}
+
+	user := middleware.User(r)
+
+	valid, err := CheckTwoFactor(user.UUID, data.Code)
+	if err != nil {
+		helpers.SuccessResponse(false, w, r)
+		helpers.ThrowErr(w, r, "Checking two-factor code error", err)
+		return
+	}
+
+	if !valid {
+		helpers.SuccessResponse(false, w, r)
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		helpers.SuccessResponse(false, w, r)
+		helpers.ThrowErr(w, r, "Generating recovery codes error", err)
+		return
+	}
+
+	err = db.ReplaceRecoveryCodes(user.UUID, hashes)
+	if err != nil {
+		helpers.SuccessResponse(false, w, r)
+		helpers.ThrowErr(w, r, "Replacing recovery codes error", err)
+		return
+	}
+
+	recoveryCodesResponse(codes, w, r)
+}
+
+// newRecoveryCodes generates recovery codes along with the hashes to store.
+func newRecoveryCodes() (codes, hashes []string, err error) {
+	codes, err = helpers.GenerateRecoveryCodes()
+	if err != nil {
+		return
+	}
+
+	for _, code := range codes {
+		hashes = append(hashes, helpers.HashRecoveryCode(code))
+	}
+
+	return
+}
+
+func recoveryCodesResponse(codes []string, w http.ResponseWriter, r *http.Request) {
+	err := helpers.JSONResponse(models.RecoveryCodes{
+		Success:       true,
+		RecoveryCodes: codes,
+	}, w)
+	if err != nil {
+		helpers.ThrowErr(w, r, "Sending JSON response error", err)
+	}
+}
@@ -0,0 +1,204 @@
+package helpers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+	CAPTCHA
+*/
+
+// CaptchaVerifier checks the response a client got for solving a CAPTCHA.
+type CaptchaVerifier interface {
+	Verify(response, remoteIP string) (success bool, err error)
+}
+
+// CAPTCHA providers, chosen with the CAPTCHA_PROVIDER environment variable.
+const (
+	CaptchaReCaptcha = "recaptcha"
+	CaptchaHCaptcha  = "hcaptcha"
+	CaptchaFake      = "fake"
+)
+
+// Addresses CAPTCHA responses are checked with.
+const (
+	reCaptchaVerifyURL = "https://www.google.com/recaptcha/api/siteverify"
+	hCaptchaVerifyURL  = "https://api.hcaptcha.com/siteverify"
+)
+
+// FakeCaptchaFailure is the only response FakeCaptcha refuses.
+const FakeCaptchaFailure = "fail"
+
+// defaultReCaptchaSiteKey is the site's reCAPTCHA v2 key, used when CAPTCHA_SITEKEY isn't set.
+const defaultReCaptchaSiteKey = "6LcImFEUAAAAANyiCqnp3w_CSSSdhO6YgE4LP7kv"
+
+var captchaClient = &http.Client{Timeout: time.Second * 10}
+
+// Captcha is a CaptchaVerifier along with the widget the pages show to get responses for it.
+type Captcha struct {
+	CaptchaVerifier
+	Widget CaptchaWidget
+}
+
+// CaptchaWidget is what the login, register and password recovery pages need to show a provider's CAPTCHA.
+type CaptchaWidget struct {
+	Provider string `json:"provider"`
+	SiteKey  string `json:"siteKey"`
+	// Invisible is set for reCAPTCHA v3, which scores the user in the background instead of showing a checkbox.
+	Invisible bool `json:"invisible"`
+}
+
+// OpenCaptcha returns the Captcha for a provider.
+// minScore is the lowest reCAPTCHA v3 score accepted, it is ignored by the other providers.
+func OpenCaptcha(provider, secret, siteKey string, minScore float64) (c Captcha, err error) {
+	c.Widget = CaptchaWidget{Provider: provider, SiteKey: siteKey}
+
+	switch provider {
+	case CaptchaReCaptcha:
+		c.CaptchaVerifier = ReCaptcha{Secret: secret, MinScore: minScore}
+		c.Widget.Invisible = minScore > 0
+		if siteKey == "" && !c.Widget.Invisible {
+			c.Widget.SiteKey = defaultReCaptchaSiteKey
+		}
+	case CaptchaHCaptcha:
+		c.CaptchaVerifier = HCaptcha{Secret: secret}
+	case CaptchaFake:
+		c.CaptchaVerifier = FakeCaptcha{}
+		return
+	default:
+		return c, fmt.Errorf("unknown CAPTCHA provider %q", provider)
+	}
+
+	if c.Widget.SiteKey == "" {
+		return c, fmt.Errorf("a site key is needed for the %v CAPTCHA widget", provider)
+	}
+
+	return
+}
+
+// OpenDefaultCaptcha returns the Captcha set by the CAPTCHA_PROVIDER, CAPTCHA_SECRET, CAPTCHA_SITEKEY and CAPTCHA_MIN_SCORE
+// environment variables, which is reCAPTCHA unless the provider is set.
+func OpenDefaultCaptcha() (c Captcha, err error) {
+	provider := os.Getenv("CAPTCHA_PROVIDER")
+	if provider == "" {
+		provider = CaptchaReCaptcha
+	}
+
+	minScore := 0.0
+	if s := os.Getenv("CAPTCHA_MIN_SCORE"); s != "" {
+		minScore, err = strconv.ParseFloat(s, 64)
+		if err != nil || minScore < 0 || minScore > 1 {
+			return c, fmt.Errorf("CAPTCHA_MIN_SCORE must be between 0 and 1, not %q", s)
+		}
+	}
+
+	if provider == CaptchaFake {
+		log.Printf("Warning: CAPTCHAs aren't being checked as CAPTCHA_PROVIDER is %v", CaptchaFake)
+	}
+
+	return OpenCaptcha(provider, os.Getenv("CAPTCHA_SECRET"), os.Getenv("CAPTCHA_SITEKEY"), minScore)
+}
+
+// siteVerifyResponse is the response from reCAPTCHA or hCaptcha after checking a CAPTCHA response.
+type siteVerifyResponse struct {
+	Success bool `json:"success"`
+	// Score is only sent by reCAPTCHA v3, 1 is very likely a person and 0 very likely a bot.
+	Score      *float64 `json:"score"`
+	ErrorCodes []string `json:"error-codes"`
+}
+
+// siteVerify checks a CAPTCHA response with reCAPTCHA or hCaptcha, which share the same API.
+func siteVerify(verifyURL, secret, response, remoteIP string) (result siteVerifyResponse, err error) {
+	values := url.Values{}
+	values.Set("secret", secret)
+	values.Set("response", response)
+	if remoteIP != "" {
+		values.Set("remoteip", remoteIP)
+	}
+
+	res, err := captchaClient.PostForm(verifyURL, values)
+	if err != nil {
+		return
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return result, fmt.Errorf("CAPTCHA verification returned status %v", res.StatusCode)
+	}
+
+	err = json.NewDecoder(res.Body).Decode(&result)
+	if err != nil {
+		return
+	}
+
+	// Problems with our secret need fixing rather than treating as a failed CAPTCHA.
+	for _, code := range result.ErrorCodes {
+		if strings.Contains(code, "secret") {
+			return result, fmt.Errorf("CAPTCHA verification error %v", code)
+		}
+	}
+
+	return
+}
+
+// ReCaptcha checks reCAPTCHA v2 and v3 responses.
+type ReCaptcha struct {
+	Secret string
+	// MinScore is the lowest v3 score accepted, it must be 0 for v2 as its responses don't have a score.
+	MinScore float64
+}
+
+// Verify checks a reCAPTCHA response.
+func (c ReCaptcha) Verify(response, remoteIP string) (success bool, err error) {
+	if response == "" {
+		return false, nil // There is no captcha response.
+	}
+
+	result, err := siteVerify(reCaptchaVerifyURL, c.Secret, response, remoteIP)
+	if err != nil || !result.Success {
+		return
+	}
+
+	if c.MinScore > 0 && (result.Score == nil || *result.Score < c.MinScore) {
+		return false, nil // Probably a bot.
+	}
+
+	return true, nil
+}
+
+// HCaptcha checks hCaptcha responses.
+type HCaptcha struct {
+	Secret string
+}
+
+// Verify checks an hCaptcha response.
+func (c HCaptcha) Verify(response, remoteIP string) (success bool, err error) {
+	if response == "" {
+		return false, nil // There is no captcha response.
+	}
+
+	result, err := siteVerify(hCaptchaVerifyURL, c.Secret, response, remoteIP)
+	if err != nil {
+		return
+	}
+
+	return result.Success, nil
+}
+
+// FakeCaptcha passes every response except FakeCaptchaFailure without any network requests,
+// so the site can be run locally and tested offline.
+type FakeCaptcha struct{}
+
+// Verify passes any response except FakeCaptchaFailure, including an empty one.
+func (FakeCaptcha) Verify(response, remoteIP string) (success bool, err error) {
+	return response != FakeCaptchaFailure, nil
+}
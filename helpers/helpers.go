@@ -1,10 +1,14 @@
 package helpers
 
 import (
+	cryptoRand "crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"log"
 	"math/rand"
+	"net"
 	"net/http"
 
 	"github.com/badoux/checkmail"
@@ -32,6 +36,26 @@ func GenerateRandomString(size int) (string, error) {
 	return base64.URLEncoding.EncodeToString(b), err
 }
 
+// GenerateAccessToken returns a new personal access token along with the hash to store it by.
+// The token is read from crypto/rand as it is a long lived credential.
+func GenerateAccessToken(prefix string) (token, hash string, err error) {
+	bytes := make([]byte, 32)
+	_, err = cryptoRand.Read(bytes)
+	if err != nil {
+		return
+	}
+
+	token = prefix + base64.RawURLEncoding.EncodeToString(bytes)
+	return token, HashAccessToken(token), nil
+}
+
+// HashAccessToken hashes a personal access token.
+// The tokens are random enough that a fast hash can't be brute forced, unlike a password.
+func HashAccessToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
 // HashPassword hashes a password.
 func HashPassword(password string) (string, error) {
 	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 14)
@@ -83,3 +107,17 @@ func CheckEmail(email string) (err error) {
 	err = checkmail.ValidateHost(email)
 	return
 }
+
+// ClientIP returns the IP address of a client, which Cloudflare sends as CF-Connecting-IP.
+func ClientIP(r *http.Request) string {
+	if ip := r.Header.Get("CF-Connecting-IP"); ip != "" {
+		return ip
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
@@ -0,0 +1,320 @@
+package helpers
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ses"
+)
+
+/*
+	Mailer
+*/
+
+// Mailer sends emails.
+type Mailer interface {
+	Send(email Email) (err error)
+}
+
+// Email is an email to one address, HTML is optional and sent as an alternative to Text.
+type Email struct {
+	To, Subject, Text, HTML string
+}
+
+// Mail providers, chosen with the MAIL_PROVIDER environment variable.
+const (
+	MailerSES  = "ses"
+	MailerSMTP = "smtp"
+	MailerFile = "file"
+)
+
+// Defaults for the mail environment variables.
+const (
+	defaultMailFrom  = "noreply@berniesbusybees.co.uk"
+	defaultSESRegion = "eu-west-1"
+	defaultSMTPPort  = 587
+	defaultMailDir   = "mail"
+)
+
+var mailer Mailer
+
+// InitMailer sets the Mailer every email is sent with.
+func InitMailer(m Mailer) {
+	mailer = m
+}
+
+// SendEmail sends an email with the Mailer, html can be left empty to only send text.
+func SendEmail(to, subject, text, html string) (err error) {
+	if mailer == nil {
+		return errors.New("no mailer has been set")
+	}
+
+	return mailer.Send(Email{
+		To:      to,
+		Subject: subject,
+		Text:    text,
+		HTML:    html,
+	})
+}
+
+// OpenDefaultMailer returns the Mailer set by the MAIL_PROVIDER environment variable, which is SES unless it is set.
+// Emails are sent from MAIL_FROM. SES uses the AWS_REGION region, SMTP uses SMTP_HOST, SMTP_PORT, SMTP_USERNAME
+// and SMTP_PASSWORD, and the file sink writes to the MAIL_DIR maildir.
+func OpenDefaultMailer() (Mailer, error) {
+	provider := os.Getenv("MAIL_PROVIDER")
+	if provider == "" {
+		provider = MailerSES
+	}
+
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = defaultMailFrom
+	}
+
+	switch provider {
+	case MailerSES:
+		region := os.Getenv("AWS_REGION")
+		if region == "" {
+			region = defaultSESRegion
+		}
+
+		return SESMailer{Region: region, From: from}, nil
+	case MailerSMTP:
+		host := os.Getenv("SMTP_HOST")
+		if host == "" {
+			return nil, errors.New("SMTP_HOST must be set to send emails with SMTP")
+		}
+
+		port := defaultSMTPPort
+		if s := os.Getenv("SMTP_PORT"); s != "" {
+			var err error
+			port, err = strconv.Atoi(s)
+			if err != nil || port <= 0 || port > 65535 {
+				return nil, fmt.Errorf("SMTP_PORT must be a port number, not %q", s)
+			}
+		}
+
+		return SMTPMailer{Host: host, Port: port, Username: os.Getenv("SMTP_USERNAME"), Password: os.Getenv("SMTP_PASSWORD"), From: from}, nil
+	case MailerFile:
+		dir := os.Getenv("MAIL_DIR")
+		if dir == "" {
+			dir = defaultMailDir
+		}
+
+		return FileMailer{Dir: dir, From: from}, nil
+	}
+
+	return nil, fmt.Errorf("unknown mail provider %q", provider)
+}
+
+// message builds an email in the internet message format, as sent by SMTP and stored in a maildir.
+func (e Email) message(from string) (message []byte, err error) {
+	var buf bytes.Buffer
+	buf.WriteString("From: " + from + "\r\n")
+	buf.WriteString("To: " + e.To + "\r\n")
+	buf.WriteString("Subject: " + mime.QEncoding.Encode("UTF-8", e.Subject) + "\r\n")
+	buf.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	buf.WriteString("MIME-Version: 1.0\r\n")
+
+	if e.HTML == "" {
+		buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+		buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+
+		err = writeQuotedPrintable(&buf, e.Text)
+		return buf.Bytes(), err
+	}
+
+	// Mail readers show the last part they can, so the HTML is after the text.
+	parts := multipart.NewWriter(&buf)
+	buf.WriteString("Content-Type: multipart/alternative; boundary=" + parts.Boundary() + "\r\n\r\n")
+
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=UTF-8", e.Text},
+		{"text/html; charset=UTF-8", e.HTML},
+	} {
+		w, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		err = writeQuotedPrintable(w, part.content)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = parts.Close()
+	return buf.Bytes(), err
+}
+
+// writeQuotedPrintable writes part of an email's body, encoded so any line length and characters are safe to send.
+func writeQuotedPrintable(w io.Writer, content string) (err error) {
+	qp := quotedprintable.NewWriter(w)
+	_, err = qp.Write([]byte(content))
+	if err != nil {
+		return
+	}
+
+	return qp.Close()
+}
+
+// checkAddress stops header injection through an address, which could add recipients or change the email.
+func checkAddress(address string) (err error) {
+	if strings.ContainsAny(address, "\r\n") {
+		return fmt.Errorf("invalid email address %q", address)
+	}
+
+	return
+}
+
+// SESMailer sends emails with Amazon SES.
+type SESMailer struct {
+	Region, From string
+}
+
+// Send sends an email with SES.
+func (m SESMailer) Send(email Email) (err error) {
+	sess, err := session.NewSession(&aws.Config{
+		Region: aws.String(m.Region)},
+	)
+	if err != nil {
+		return
+	}
+
+	// Create an SES session.
+	svc := ses.New(sess)
+
+	body := &ses.Body{
+		Text: &ses.Content{
+			Charset: aws.String("UTF-8"),
+			Data:    aws.String(email.Text),
+		},
+	}
+	if email.HTML != "" {
+		body.Html = &ses.Content{
+			Charset: aws.String("UTF-8"),
+			Data:    aws.String(email.HTML),
+		}
+	}
+
+	// Assemble the email.
+	input := &ses.SendEmailInput{
+		Destination: &ses.Destination{
+			CcAddresses: []*string{},
+			ToAddresses: []*string{
+				aws.String(email.To),
+			},
+		},
+		Message: &ses.Message{
+			Body: body,
+			Subject: &ses.Content{
+				Charset: aws.String("UTF-8"),
+				Data:    aws.String(email.Subject),
+			},
+		},
+		Source: aws.String(m.From),
+	}
+
+	// Attempt to send the email.
+	_, err = svc.SendEmail(input)
+	return
+}
+
+// SMTPMailer sends emails through an SMTP server, using STARTTLS when the server supports it.
+// Username and Password can be left empty for servers which don't need logging in to.
+type SMTPMailer struct {
+	Host               string
+	Port               int
+	Username, Password string
+	From               string
+}
+
+// Send sends an email through the SMTP server.
+func (m SMTPMailer) Send(email Email) (err error) {
+	err = checkAddress(email.To)
+	if err != nil {
+		return
+	}
+
+	message, err := email.message(m.From)
+	if err != nil {
+		return
+	}
+
+	// The sender can have a name, such as "Bernie's Busy Bees <noreply@berniesbusybees.co.uk>", which SMTP doesn't take.
+	from, err := mail.ParseAddress(m.From)
+	if err != nil {
+		return
+	}
+
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+
+	return smtp.SendMail(net.JoinHostPort(m.Host, strconv.Itoa(m.Port)), auth, from.Address, []string{email.To}, message)
+}
+
+// FileMailer writes emails to a maildir instead of sending them, so they can be read when running locally or testing.
+type FileMailer struct {
+	Dir, From string
+}
+
+// Send writes an email to the maildir's new directory.
+// It is written to tmp first and then moved, so a mail reader never sees half an email.
+func (m FileMailer) Send(email Email) (err error) {
+	err = checkAddress(email.To)
+	if err != nil {
+		return
+	}
+
+	message, err := email.message(m.From)
+	if err != nil {
+		return
+	}
+
+	for _, dir := range []string{"tmp", "new", "cur"} {
+		err = os.MkdirAll(filepath.Join(m.Dir, dir), 0700)
+		if err != nil {
+			return
+		}
+	}
+
+	unique := make([]byte, 8)
+	_, err = rand.Read(unique)
+	if err != nil {
+		return
+	}
+
+	name := strconv.FormatInt(time.Now().UnixNano(), 10) + "." + hex.EncodeToString(unique) + ".eml"
+
+	tmp := filepath.Join(m.Dir, "tmp", name)
+	err = ioutil.WriteFile(tmp, message, 0600)
+	if err != nil {
+		return
+	}
+
+	return os.Rename(tmp, filepath.Join(m.Dir, "new", name))
+}
@@ -0,0 +1,100 @@
+package helpers
+
+import (
+	"crypto/hmac"
+	cryptoRand "crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TOTP settings, these are the defaults every authenticator app supports.
+const (
+	totpDigits = 6
+	totpPeriod = 30
+	// totpSkew is how many periods either side of now a code is accepted for, in case a clock is slightly off.
+	totpSkew = 1
+	// RecoveryCodeCount is how many recovery codes a user is given at a time.
+	RecoveryCodeCount = 10
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateTOTPSecret returns a new random base32 TOTP secret.
+func GenerateTOTPSecret() (secret string, err error) {
+	b := make([]byte, 20)
+	_, err = cryptoRand.Read(b)
+	if err != nil {
+		return
+	}
+
+	return totpEncoding.EncodeToString(b), nil
+}
+
+// TOTPURI returns the otpauth URI an authenticator app adds a secret from, which is shown as a QR code.
+func TOTPURI(issuer, account, secret string) string {
+	values := url.Values{}
+	values.Set("secret", secret)
+	values.Set("issuer", issuer)
+
+	return "otpauth://totp/" + url.PathEscape(issuer+":"+account) + "?" + values.Encode()
+}
+
+// CheckTOTP checks a TOTP code, returning the time step it was for.
+// Codes for lastStep or before are refused, so a code can't be used twice.
+func CheckTOTP(secret, code string, lastStep int64, now time.Time) (step int64, valid bool) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil || len(code) != totpDigits {
+		return
+	}
+
+	current := now.Unix() / totpPeriod
+	for step = current - totpSkew; step <= current+totpSkew; step++ {
+		if step > lastStep && hmac.Equal([]byte(totpCode(key, step)), []byte(code)) {
+			return step, true
+		}
+	}
+
+	return 0, false
+}
+
+// totpCode returns the code for a time step as described in RFC 6238.
+func totpCode(key []byte, step int64) string {
+	counter := make([]byte, 8)
+	binary.BigEndian.PutUint64(counter, uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%06d", value%1000000)
+}
+
+// GenerateRecoveryCodes returns new recovery codes, which can each be used once instead of a TOTP code.
+func GenerateRecoveryCodes() (codes []string, err error) {
+	for i := 0; i < RecoveryCodeCount; i++ {
+		b := make([]byte, 10)
+		_, err = cryptoRand.Read(b)
+		if err != nil {
+			return
+		}
+
+		code := strings.ToLower(totpEncoding.EncodeToString(b))
+		codes = append(codes, code[:4]+"-"+code[4:8]+"-"+code[8:12]+"-"+code[12:])
+	}
+
+	return
+}
+
+// HashRecoveryCode hashes a recovery code to be stored, ignoring case, spaces and dashes.
+func HashRecoveryCode(code string) string {
+	code = strings.NewReplacer("-", "", " ", "").Replace(strings.ToLower(code))
+	return HashAccessToken(code)
+}
@@ -0,0 +1,358 @@
+package helpers
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+/*
+	WebAuthn
+*/
+
+// WebAuthn authenticator data flags.
+const (
+	webAuthnUserPresent      = 0x01
+	webAuthnUserVerified     = 0x04
+	webAuthnAttestedCredData = 0x40
+)
+
+// ErrWebAuthn is returned when a passkey's response is invalid.
+var ErrWebAuthn = errors.New("invalid webauthn response")
+
+// WebAuthnRegistration checks a new passkey's response to a registration challenge.
+// It returns the passkey's credential ID and its public key as PKIX DER.
+// Attestation isn't checked, so any authenticator the user trusts can be registered.
+func WebAuthnRegistration(clientDataJSON, attestationObject []byte, challenge, origin, rpID string, requireUV bool) (credentialID, publicKey []byte, signCount uint32, err error) {
+	err = checkClientData(clientDataJSON, "webauthn.create", challenge, origin)
+	if err != nil {
+		return
+	}
+
+	decoded, rest, err := cborDecode(attestationObject, 0)
+	if err != nil || len(rest) != 0 {
+		return nil, nil, 0, ErrWebAuthn
+	}
+
+	attestation, ok := decoded.(map[interface{}]interface{})
+	if !ok {
+		return nil, nil, 0, ErrWebAuthn
+	}
+
+	authData, ok := attestation["authData"].([]byte)
+	if !ok {
+		return nil, nil, 0, ErrWebAuthn
+	}
+
+	flags, signCount, rest, err := checkAuthenticatorData(authData, rpID, requireUV)
+	if err != nil {
+		return
+	}
+
+	// The attested credential data is a 16 byte AAGUID, the credential ID's length and ID, then a COSE key.
+	if flags&webAuthnAttestedCredData == 0 || len(rest) < 18 {
+		return nil, nil, 0, ErrWebAuthn
+	}
+
+	idLength := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+	if idLength == 0 || idLength > 1023 || len(rest) < idLength {
+		return nil, nil, 0, ErrWebAuthn
+	}
+
+	credentialID = rest[:idLength]
+
+	public, err := parseCOSEKey(rest[idLength:])
+	if err != nil {
+		return
+	}
+
+	publicKey, err = x509.MarshalPKIXPublicKey(public)
+	return
+}
+
+// WebAuthnAssertion checks a passkey's signed response to a login challenge, returning its new signature counter.
+func WebAuthnAssertion(clientDataJSON, authenticatorData, signature []byte, challenge, origin, rpID string, publicKey []byte, requireUV bool) (signCount uint32, err error) {
+	err = checkClientData(clientDataJSON, "webauthn.get", challenge, origin)
+	if err != nil {
+		return
+	}
+
+	_, signCount, _, err = checkAuthenticatorData(authenticatorData, rpID, requireUV)
+	if err != nil {
+		return
+	}
+
+	public, err := x509.ParsePKIXPublicKey(publicKey)
+	if err != nil {
+		return
+	}
+
+	// The authenticator signs its data followed by a hash of the client data.
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte{}, authenticatorData...), clientDataHash[:]...)
+	digest := sha256.Sum256(signed)
+
+	valid := false
+	switch public := public.(type) {
+	case *ecdsa.PublicKey:
+		valid = ecdsa.VerifyASN1(public, digest[:], signature)
+	case *rsa.PublicKey:
+		valid = rsa.VerifyPKCS1v15(public, crypto.SHA256, digest[:], signature) == nil
+	case ed25519.PublicKey:
+		valid = ed25519.Verify(public, signed, signature)
+	}
+
+	if !valid {
+		return 0, ErrWebAuthn
+	}
+
+	return
+}
+
+// WebAuthnChallenge returns the challenge a passkey's client data answers, so it can be looked up.
+func WebAuthnChallenge(clientDataJSON []byte) (challenge string) {
+	var data struct {
+		Challenge string `json:"challenge"`
+	}
+
+	json.Unmarshal(clientDataJSON, &data)
+	return data.Challenge
+}
+
+// HashCredentialID hashes a passkey's credential ID, which can be too long to index itself.
+func HashCredentialID(credentialID string) string {
+	return HashAccessToken(credentialID)
+}
+
+// checkClientData checks the client data the browser made for a ceremony.
+func checkClientData(clientDataJSON []byte, ceremony, challenge, origin string) (err error) {
+	var data struct {
+		Type        string `json:"type"`
+		Challenge   string `json:"challenge"`
+		Origin      string `json:"origin"`
+		CrossOrigin bool   `json:"crossOrigin"`
+	}
+
+	err = json.Unmarshal(clientDataJSON, &data)
+	if err != nil {
+		return ErrWebAuthn
+	}
+
+	if data.Type != ceremony || data.Origin != origin || data.CrossOrigin ||
+		subtle.ConstantTimeCompare([]byte(data.Challenge), []byte(challenge)) != 1 {
+		return ErrWebAuthn
+	}
+
+	return
+}
+
+// checkAuthenticatorData checks the relying party and flags of authenticator data, returning what follows them.
+func checkAuthenticatorData(authData []byte, rpID string, requireUV bool) (flags byte, signCount uint32, rest []byte, err error) {
+	if len(authData) < 37 {
+		return 0, 0, nil, ErrWebAuthn
+	}
+
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	if !bytes.Equal(authData[:32], rpIDHash[:]) {
+		return 0, 0, nil, ErrWebAuthn
+	}
+
+	flags = authData[32]
+	if flags&webAuthnUserPresent == 0 || (requireUV && flags&webAuthnUserVerified == 0) {
+		return 0, 0, nil, ErrWebAuthn
+	}
+
+	return flags, binary.BigEndian.Uint32(authData[33:37]), authData[37:], nil
+}
+
+// parseCOSEKey parses an ES256, RS256 or EdDSA public key in COSE format.
+func parseCOSEKey(data []byte) (public crypto.PublicKey, err error) {
+	decoded, _, err := cborDecode(data, 0)
+	if err != nil {
+		return
+	}
+
+	key, ok := decoded.(map[interface{}]interface{})
+	if !ok {
+		return nil, ErrWebAuthn
+	}
+
+	parameter := func(label int64) []byte {
+		b, _ := key[label].([]byte)
+		return b
+	}
+
+	switch key[int64(3)] {
+	case int64(-7): // ES256
+		x, y := parameter(-2), parameter(-3)
+		if key[int64(-1)] != int64(1) || len(x) != 32 || len(y) != 32 {
+			return nil, ErrWebAuthn
+		}
+
+		// ECDH checks the point is on the curve.
+		_, err = ecdh.P256().NewPublicKey(append(append([]byte{4}, x...), y...))
+		if err != nil {
+			return nil, ErrWebAuthn
+		}
+
+		return &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}, nil
+	case int64(-257): // RS256
+		n, e := parameter(-1), parameter(-2)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return nil, ErrWebAuthn
+		}
+
+		rsaKey := &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+		if rsaKey.E < 3 {
+			return nil, ErrWebAuthn
+		}
+
+		return rsaKey, nil
+	case int64(-8): // EdDSA
+		x := parameter(-2)
+		if key[int64(-1)] != int64(6) || len(x) != ed25519.PublicKeySize {
+			return nil, ErrWebAuthn
+		}
+
+		return ed25519.PublicKey(x), nil
+	}
+
+	return nil, fmt.Errorf("unsupported passkey algorithm %v", key[int64(3)])
+}
+
+/*
+	CBOR
+*/
+
+// cborMaxDepth stops deeply nested data using up the stack.
+const cborMaxDepth = 16
+
+// cborDecode decodes the CBOR data item at the start of data, which is all WebAuthn needs.
+// Maps become map[interface{}]interface{} with int64 or string keys.
+func cborDecode(data []byte, depth int) (value interface{}, rest []byte, err error) {
+	if len(data) == 0 || depth > cborMaxDepth {
+		return nil, nil, ErrWebAuthn
+	}
+
+	major, info := data[0]>>5, data[0]&0x1f
+	data = data[1:]
+
+	// Simple values and floats are only used by WebAuthn extensions, which are skipped.
+	if major == 7 {
+		switch {
+		case info < 24:
+			return int64(info), data, nil
+		case info >= 24 && info <= 27:
+			size := 1 << (info - 24)
+			if len(data) < size {
+				return nil, nil, ErrWebAuthn
+			}
+			return nil, data[size:], nil
+		}
+		return nil, nil, ErrWebAuthn
+	}
+
+	var argument uint64
+	switch {
+	case info < 24:
+		argument = uint64(info)
+	case info >= 24 && info <= 27:
+		size := 1 << (info - 24)
+		if len(data) < size {
+			return nil, nil, ErrWebAuthn
+		}
+
+		for _, b := range data[:size] {
+			argument = argument<<8 | uint64(b)
+		}
+		data = data[size:]
+	default:
+		return nil, nil, ErrWebAuthn // Indefinite lengths aren't used by authenticators.
+	}
+
+	switch major {
+	case 0:
+		if argument > 1<<63-1 {
+			return nil, nil, ErrWebAuthn
+		}
+		return int64(argument), data, nil
+	case 1:
+		if argument > 1<<63-1 {
+			return nil, nil, ErrWebAuthn
+		}
+		return -1 - int64(argument), data, nil
+	case 2, 3:
+		if argument > uint64(len(data)) {
+			return nil, nil, ErrWebAuthn
+		}
+		if major == 3 {
+			return string(data[:argument]), data[argument:], nil
+		}
+		return data[:argument], data[argument:], nil
+	case 4:
+		if argument > uint64(len(data)) {
+			return nil, nil, ErrWebAuthn
+		}
+
+		array := []interface{}{}
+		for i := uint64(0); i < argument; i++ {
+			var item interface{}
+			item, data, err = cborDecode(data, depth+1)
+			if err != nil {
+				return
+			}
+			array = append(array, item)
+		}
+		return array, data, nil
+	case 5:
+		if argument > uint64(len(data)) {
+			return nil, nil, ErrWebAuthn
+		}
+
+		m := map[interface{}]interface{}{}
+		for i := uint64(0); i < argument; i++ {
+			var key, item interface{}
+			key, data, err = cborDecode(data, depth+1)
+			if err != nil {
+				return
+			}
+
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, nil, ErrWebAuthn
+			}
+
+			item, data, err = cborDecode(data, depth+1)
+			if err != nil {
+				return
+			}
+			m[key] = item
+		}
+		return m, data, nil
+	case 6:
+		return cborDecode(data, depth+1) // Tags are ignored.
+	}
+
+	return nil, nil, ErrWebAuthn
+}
@@ -0,0 +1,111 @@
+package helpers
+
+import (
+	"testing"
+
+	"github.com/VolticFroogo/Bernies-Busy-Bees/helpers/webauthntest"
+)
+
+const (
+	testRPID      = "berniesbusybees.co.uk"
+	testOrigin    = "https://berniesbusybees.co.uk"
+	testChallenge = "Y2hhbGxlbmdl"
+)
+
+// register registers a software authenticator, returning the public key it was stored with.
+func register(t *testing.T, a *webauthntest.Authenticator) (publicKey []byte) {
+	clientDataJSON, attestationObject := a.Create(testChallenge)
+
+	credentialID, publicKey, _, err := WebAuthnRegistration(clientDataJSON, attestationObject, testChallenge, testOrigin, testRPID, false)
+	if err != nil {
+		t.Fatalf("registration failed: %v", err)
+	}
+
+	if string(credentialID) != string(a.CredentialID) {
+		t.Fatal("registration returned the wrong credential ID")
+	}
+
+	return
+}
+
+func TestWebAuthnRegistration(t *testing.T) {
+	a, err := webauthntest.New(testRPID, testOrigin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	register(t, a)
+
+	tests := []struct {
+		name                    string
+		challenge, origin, rpID string
+		userVerified, requireUV bool
+	}{
+		{"wrong challenge", "b3RoZXI", testOrigin, testRPID, true, false},
+		{"wrong origin", testChallenge, "https://example.com", testRPID, true, false},
+		{"wrong relying party", testChallenge, testOrigin, "example.com", true, false},
+		{"user not verified", testChallenge, testOrigin, testRPID, false, true},
+	}
+
+	for _, test := range tests {
+		a.UserVerified = test.userVerified
+		clientDataJSON, attestationObject := a.Create(test.challenge)
+
+		_, _, _, err = WebAuthnRegistration(clientDataJSON, attestationObject, testChallenge, test.origin, test.rpID, test.requireUV)
+		if err == nil {
+			t.Errorf("%s: registration was accepted", test.name)
+		}
+	}
+}
+
+func TestWebAuthnAssertion(t *testing.T) {
+	a, err := webauthntest.New(testRPID, testOrigin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	publicKey := register(t, a)
+
+	clientDataJSON, authenticatorData, signature, err := a.Get(testChallenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signCount, err := WebAuthnAssertion(clientDataJSON, authenticatorData, signature, testChallenge, testOrigin, testRPID, publicKey, true)
+	if err != nil {
+		t.Fatalf("assertion failed: %v", err)
+	}
+
+	if signCount != a.SignCount {
+		t.Errorf("signature counter is %v, not %v", signCount, a.SignCount)
+	}
+
+	// Changing the signed data, such as to set the user verified flag, breaks the signature.
+	tampered := append([]byte{}, authenticatorData...)
+	tampered[36]++
+	_, err = WebAuthnAssertion(clientDataJSON, tampered, signature, testChallenge, testOrigin, testRPID, publicKey, true)
+	if err == nil {
+		t.Error("assertion with tampered authenticator data was accepted")
+	}
+
+	_, err = WebAuthnAssertion(clientDataJSON, authenticatorData, signature, "b3RoZXI", testOrigin, testRPID, publicKey, true)
+	if err == nil {
+		t.Error("assertion for another challenge was accepted")
+	}
+
+	a.UserVerified = false
+	clientDataJSON, authenticatorData, signature, err = a.Get(testChallenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = WebAuthnAssertion(clientDataJSON, authenticatorData, signature, testChallenge, testOrigin, testRPID, publicKey, true)
+	if err == nil {
+		t.Error("assertion without user verification was accepted when it was required")
+	}
+
+	_, err = WebAuthnAssertion(clientDataJSON, authenticatorData, signature, testChallenge, testOrigin, testRPID, publicKey, false)
+	if err != nil {
+		t.Errorf("assertion without user verification failed when it wasn't required: %v", err)
+	}
+}
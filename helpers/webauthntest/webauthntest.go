@@ -0,0 +1,170 @@
+// Package webauthntest is a software passkey authenticator, so passkeys can be tested without any hardware.
+package webauthntest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+)
+
+// Authenticator flags.
+const (
+	flagUserPresent      = 0x01
+	flagUserVerified     = 0x04
+	flagAttestedCredData = 0x40
+)
+
+// Authenticator is a passkey with an ES256 key, which answers challenges like a browser and authenticator would.
+type Authenticator struct {
+	CredentialID []byte
+	Key          *ecdsa.PrivateKey
+	// RPID and Origin are the site the authenticator thinks it is being used on.
+	RPID, Origin string
+	// UserVerified is whether the authenticator says it checked the user's PIN or biometrics.
+	UserVerified bool
+	// SignCount is the signature counter, which goes up before each assertion is signed.
+	SignCount uint32
+}
+
+// New returns an authenticator with a new key and credential ID for a site.
+func New(rpID, origin string) (a *Authenticator, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return
+	}
+
+	a = &Authenticator{
+		CredentialID: make([]byte, 16),
+		Key:          key,
+		RPID:         rpID,
+		Origin:       origin,
+		UserVerified: true,
+	}
+
+	_, err = rand.Read(a.CredentialID)
+	return
+}
+
+// Create answers a registration challenge, returning the client data and an attestation object with no attestation.
+func (a *Authenticator) Create(challenge string) (clientDataJSON, attestationObject []byte) {
+	clientDataJSON = a.clientData("webauthn.create", challenge)
+	attestationObject = cborMap(
+		cborText("fmt"), cborText("none"),
+		cborText("attStmt"), cborMap(),
+		cborText("authData"), cborBytes(a.authenticatorData(true)),
+	)
+
+	return
+}
+
+// Get answers a login challenge, returning the client data, authenticator data and signature of an assertion.
+func (a *Authenticator) Get(challenge string) (clientDataJSON, authenticatorData, signature []byte, err error) {
+	a.SignCount++
+
+	clientDataJSON = a.clientData("webauthn.get", challenge)
+	authenticatorData = a.authenticatorData(false)
+
+	// The authenticator signs its data followed by a hash of the client data.
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	digest := sha256.Sum256(append(append([]byte{}, authenticatorData...), clientDataHash[:]...))
+
+	signature, err = ecdsa.SignASN1(rand.Reader, a.Key, digest[:])
+	return
+}
+
+// clientData is the JSON a browser makes for a ceremony.
+func (a *Authenticator) clientData(ceremony, challenge string) []byte {
+	clientDataJSON, _ := json.Marshal(map[string]interface{}{
+		"type":        ceremony,
+		"challenge":   challenge,
+		"origin":      a.Origin,
+		"crossOrigin": false,
+	})
+
+	return clientDataJSON
+}
+
+// authenticatorData is the relying party's hash, the flags and the signature counter,
+// followed by the credential ID and public key when registering.
+func (a *Authenticator) authenticatorData(attested bool) (data []byte) {
+	rpIDHash := sha256.Sum256([]byte(a.RPID))
+	data = append(data, rpIDHash[:]...)
+
+	flags := byte(flagUserPresent)
+	if a.UserVerified {
+		flags |= flagUserVerified
+	}
+	if attested {
+		flags |= flagAttestedCredData
+	}
+	data = append(data, flags)
+
+	data = binary.BigEndian.AppendUint32(data, a.SignCount)
+	if !attested {
+		return
+	}
+
+	data = append(data, make([]byte, 16)...) // An AAGUID of zeros, as there is no attestation.
+	data = binary.BigEndian.AppendUint16(data, uint16(len(a.CredentialID)))
+	data = append(data, a.CredentialID...)
+
+	x, y := make([]byte, 32), make([]byte, 32)
+	a.Key.X.FillBytes(x)
+	a.Key.Y.FillBytes(y)
+
+	// An EC2 key on P-256 for ES256 in COSE format.
+	return append(data, cborMap(
+		cborInt(1), cborInt(2),
+		cborInt(3), cborInt(-7),
+		cborInt(-1), cborInt(1),
+		cborInt(-2), cborBytes(x),
+		cborInt(-3), cborBytes(y),
+	)...)
+}
+
+/*
+	CBOR
+*/
+
+// cborHead encodes the start of a CBOR data item.
+func cborHead(major byte, argument uint64) []byte {
+	switch {
+	case argument < 24:
+		return []byte{major<<5 | byte(argument)}
+	case argument < 1<<8:
+		return []byte{major<<5 | 24, byte(argument)}
+	case argument < 1<<16:
+		return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(argument))
+	}
+
+	return binary.BigEndian.AppendUint32([]byte{major<<5 | 26}, uint32(argument))
+}
+
+func cborInt(i int64) []byte {
+	if i >= 0 {
+		return cborHead(0, uint64(i))
+	}
+
+	return cborHead(1, uint64(-1-i))
+}
+
+func cborBytes(b []byte) []byte {
+	return append(cborHead(2, uint64(len(b))), b...)
+}
+
+func cborText(s string) []byte {
+	return append(cborHead(3, uint64(len(s))), s...)
+}
+
+// cborMap encodes a map from its keys and values in turn.
+func cborMap(keysAndValues ...[]byte) (m []byte) {
+	m = cborHead(5, uint64(len(keysAndValues)/2))
+	for _, item := range keysAndValues {
+		m = append(m, item...)
+	}
+
+	return
+}
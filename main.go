@@ -2,13 +2,24 @@ package main
 
 import (
 	"log"
+	"os"
 
 	"github.com/VolticFroogo/Bernies-Busy-Bees/db"
 	"github.com/VolticFroogo/Bernies-Busy-Bees/handler"
+	"github.com/VolticFroogo/Bernies-Busy-Bees/helpers"
 	"github.com/VolticFroogo/Bernies-Busy-Bees/middleware/myJWT"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := migrate(os.Args[2:]); err != nil {
+			log.Printf("Error migrating database: %v", err)
+			os.Exit(1)
+		}
+
+		return
+	}
+
 	if err := db.InitDB(); err != nil {
 		log.Printf("Error initializing database: %v", err)
 		return
@@ -19,5 +30,18 @@ func main() {
 		return
 	}
 
-	handler.Start()
+	captcha, err := helpers.OpenDefaultCaptcha()
+	if err != nil {
+		log.Printf("Error initializing CAPTCHA: %v", err)
+		return
+	}
+
+	mailer, err := helpers.OpenDefaultMailer()
+	if err != nil {
+		log.Printf("Error initializing mailer: %v", err)
+		return
+	}
+	helpers.InitMailer(mailer)
+
+	handler.Start(captcha)
 }
@@ -1,176 +1,323 @@
 package middleware
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"log"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/VolticFroogo/Bernies-Busy-Bees/db"
 	"github.com/VolticFroogo/Bernies-Busy-Bees/helpers"
 	"github.com/VolticFroogo/Bernies-Busy-Bees/middleware/myJWT"
 	"github.com/VolticFroogo/Bernies-Busy-Bees/models"
-	"github.com/gorilla/context"
+	"github.com/urfave/negroni"
 )
 
-// Panel handles authentication for authenticated pages.
-func Panel(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
-	authTokenString, err := r.Cookie("authToken")
-	if err != nil {
-		helpers.ThrowErr(w, r, "Reading cookie error", err)
-		return
-	}
+const (
+	bearerPrefix    = "Bearer "
+	bearerChallenge = `Bearer error="invalid_token"`
 
-	refreshTokenString, err := r.Cookie("refreshToken")
-	if err != nil {
-		helpers.ThrowErr(w, r, "Reading cookie error", err)
-		return
-	}
+	// accessTokenUseInterval is how many seconds apart an access token's last use is recorded.
+	accessTokenUseInterval = 60
 
-	if authTokenString.Value != "" {
-		authTokenValid, uuid, err := myJWT.CheckToken(authTokenString.Value, "", false, false)
-		if err != nil {
-			helpers.ThrowErr(w, r, "Checking token error", err)
-			return
-		}
+	// ajaxBodyLimit is the most of an AJAX request's JSON body read to find its CSRF secret.
+	ajaxBodyLimit = 1024 * 1024
+)
+
+/*
+	Route authorization
+*/
+
+type contextKey int
 
-		if authTokenValid {
-			context.Set(r, "uuid", uuid)
-			next(w, r)
+const (
+	userKey contextKey = iota
+	accessTokenKey
+)
+
+// Page protects panel pages, visitors who aren't logged in are sent to the login.
+// Users without the permission get a 403 with the no privileges page.
+func Page(permission string) negroni.HandlerFunc {
+	return protect(permission, func(r *http.Request) (string, bool) {
+		return "", false // Pages can't change anything so they don't need the CSRF secret.
+	}, redirectUnauthorized, pageForbidden)
+}
+
+// Form protects HTML forms, which send the CSRF secret as the csrfSecret form value.
+func Form(permission string) negroni.HandlerFunc {
+	return protect(permission, func(r *http.Request) (string, bool) {
+		return r.FormValue("csrfSecret"), true
+	}, redirectUnauthorized, pageForbidden)
+}
+
+// AJAX protects AJAX requests, which send the CSRF secret in an X-CSRF-Token header or as CsrfSecret in their JSON body.
+// Failures are a 401 or 403 with an unsuccessful JSON response.
+func AJAX(permission string) negroni.HandlerFunc {
+	return protect(permission, ajaxCsrfSecret, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		helpers.SuccessResponse(false, w, r)
+	}, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		helpers.SuccessResponse(false, w, r)
+	})
+}
+
+// protect builds a middleware which loads the logged in user into the request's context,
+// as long as they have the permission (anyone logged in does if it's empty).
+func protect(permission string, csrf func(r *http.Request) (csrfSecret string, checkCsrf bool), unauthorized, forbidden http.HandlerFunc) negroni.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+		csrfSecret, checkCsrf := csrf(r)
+
+		uuid, valid := authenticate(w, r, csrfSecret, checkCsrf)
+		if !valid {
+			unauthorized(w, r)
 			return
 		}
-	}
 
-	if refreshTokenString.Value != "" {
-		refreshTokenValid, uuid, err := myJWT.CheckToken(refreshTokenString.Value, "", true, false)
+		user, exists, err := LoadUser(uuid)
 		if err != nil {
-			helpers.ThrowErr(w, r, "Checking token error", err)
+			log.Printf("Loading user error: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
 
-		if refreshTokenValid {
-			newAuthTokenString, newRefreshTokenString, newCsrfSecret, err := myJWT.RefreshTokens(refreshTokenString.Value)
-			if err != nil {
-				helpers.ThrowErr(w, r, "Creating new tokens error", err)
-				return
-			}
-
-			WriteNewAuth(w, r, newAuthTokenString, newRefreshTokenString, newCsrfSecret)
+		if !exists {
+			// The user has been deleted since their token was made.
+			unauthorized(w, r)
+			return
+		}
 
-			context.Set(r, "uuid", uuid)
-			next(w, r)
+		if permission != "" && !models.Authorize(user, permission) {
+			forbidden(w, WithUser(r, user))
 			return
 		}
-	}
 
-	RedirectToLogin(w, r)
+		next(w, WithUser(r, user))
+	}
 }
 
-// Form is the function used to protect forms.
-func Form(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
-	authTokenString, err := r.Cookie("authToken")
+// LoadUser loads the user a token was made for, exists is false if they have since been deleted.
+func LoadUser(uuidString string) (user models.User, exists bool, err error) {
+	uuid, err := strconv.Atoi(uuidString)
 	if err != nil {
-		helpers.ThrowErr(w, r, "Reading cookie error", err)
 		return
 	}
 
-	refreshTokenString, err := r.Cookie("refreshToken")
+	user, err = db.GetUserFromID(uuid)
 	if err != nil {
-		helpers.ThrowErr(w, r, "Reading cookie error", err)
 		return
 	}
 
-	csrfSecret := r.FormValue("csrfSecret")
-
-	if authTokenString.Value != "" {
-		authTokenValid, uuid, err := myJWT.CheckToken(authTokenString.Value, csrfSecret, false, true)
-		if err != nil {
-			helpers.ThrowErr(w, r, "Checking token error", err)
-			return
+	// Until they set up two-factor authentication, users whose role requires it can only reach their settings.
+	if user.NeedsTwoFactor() {
+		permissions := []string{}
+		if user.Role.Has(models.PermPanel) {
+			permissions = append(permissions, models.PermPanel)
 		}
 
-		if authTokenValid {
-			context.Set(r, "uuid", uuid)
-			next(w, r)
-			return
-		}
+		user.Role.Permissions = permissions
 	}
 
-	if refreshTokenString.Value != "" {
-		refreshTokenValid, uuid, err := myJWT.CheckToken(refreshTokenString.Value, csrfSecret, true, true)
-		if err != nil {
-			helpers.ThrowErr(w, r, "Checking token error", err)
-			return
-		}
+	return user, user.CreateTime != "", nil
+}
 
-		if refreshTokenValid {
-			newAuthTokenString, newRefreshTokenString, newCsrfSecret, err := myJWT.RefreshTokens(refreshTokenString.Value)
-			if err != nil {
-				helpers.ThrowErr(w, r, "Creating new tokens error", err)
-				return
-			}
+// WithUser returns a copy of a request with the logged in user in its context.
+func WithUser(r *http.Request, user models.User) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), userKey, user))
+}
 
-			WriteNewAuth(w, r, newAuthTokenString, newRefreshTokenString, newCsrfSecret)
+// User returns the logged in user which the middleware put in a request's context.
+func User(r *http.Request) models.User {
+	user, _ := r.Context().Value(userKey).(models.User)
+	return user
+}
 
-			context.Set(r, "uuid", uuid)
-			next(w, r)
-			return
-		}
-	}
+// WithAccessToken returns a copy of a request with the personal access token it used in its context.
+func WithAccessToken(r *http.Request, token models.AccessToken) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), accessTokenKey, token))
+}
 
-	RedirectToLogin(w, r)
+// AccessToken returns the personal access token a request used, ok is false if it didn't use one.
+func AccessToken(r *http.Request) (token models.AccessToken, ok bool) {
+	token, ok = r.Context().Value(accessTokenKey).(models.AccessToken)
+	return
 }
 
-// AJAX is the function used to protect AJAX requests.
-func AJAX(w http.ResponseWriter, r *http.Request, data models.AJAXData) (valid bool) {
-	valid = false
+// ajaxCsrfSecret reads the CSRF secret of an AJAX request.
+// Reading it from a JSON body leaves the body for the handler to decode again.
+func ajaxCsrfSecret(r *http.Request) (csrfSecret string, checkCsrf bool) {
+	csrfSecret = r.Header.Get("X-CSRF-Token")
+	if csrfSecret != "" || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		return csrfSecret, true
+	}
 
-	authTokenString, err := r.Cookie("authToken")
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, ajaxBodyLimit))
 	if err != nil {
-		helpers.ThrowErr(w, r, "Reading cookie error", err)
+		return "", true
+	}
+
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	var data struct {
+		CsrfSecret string
+	}
+	json.Unmarshal(body, &data) // A body which isn't valid leaves the secret empty.
+
+	return data.CsrfSecret, true
+}
+
+// redirectUnauthorized sends browsers to the login, or tells clients their bearer token is invalid.
+func redirectUnauthorized(w http.ResponseWriter, r *http.Request) {
+	if _, found := bearerToken(r); found {
+		BearerUnauthorized(w)
 		return
 	}
 
-	refreshTokenString, err := r.Cookie("refreshToken")
+	RedirectToLogin(w, r)
+}
+
+// pageForbidden shows the no privileges page.
+func pageForbidden(w http.ResponseWriter, r *http.Request) {
+	t, err := template.ParseFiles("handler/templates/panel/no-priv.html") // Parse the HTML page
 	if err != nil {
-		helpers.ThrowErr(w, r, "Reading cookie error", err)
+		log.Printf("Template parsing error: %v", err)
+		w.WriteHeader(http.StatusForbidden)
 		return
 	}
 
-	if authTokenString.Value != "" {
-		authTokenValid, uuid, err := myJWT.CheckToken(authTokenString.Value, data.CsrfSecret, false, true)
-		if err != nil {
-			helpers.ThrowErr(w, r, "Checking token error", err)
-			return
-		}
+	w.WriteHeader(http.StatusForbidden)
+	t.Execute(w, User(r))
+}
 
-		if authTokenValid {
-			context.Set(r, "uuid", uuid)
-			return true
+/*
+	Authentication
+*/
+
+// authenticate checks a request's bearer token, or otherwise its cookies, and returns the uuid they're for.
+// The CSRF secret is only checked for cookies, as browsers never send the bearer header by themselves.
+// An expired auth cookie is replaced using the refresh cookie.
+func authenticate(w http.ResponseWriter, r *http.Request, csrfSecret string, checkCsrf bool) (uuid string, valid bool) {
+	if uuid, found, valid := Bearer(r); found {
+		if !valid {
+			w.Header().Set("WWW-Authenticate", bearerChallenge)
 		}
+
+		return uuid, valid
 	}
 
-	if refreshTokenString.Value != "" {
-		refreshTokenValid, uuid, err := myJWT.CheckToken(refreshTokenString.Value, data.CsrfSecret, true, true)
-		if err != nil {
-			helpers.ThrowErr(w, r, "Checking token error", err)
-			return
+	authTokenString, err := r.Cookie("authToken")
+	if err == nil && authTokenString.Value != "" {
+		authTokenValid, uuid, err := myJWT.CheckToken(authTokenString.Value, csrfSecret, false, checkCsrf)
+		if err == nil && authTokenValid {
+			return uuid, true
 		}
+	}
 
-		if refreshTokenValid {
-			newAuthTokenString, newRefreshTokenString, newCsrfSecret, err := myJWT.RefreshTokens(refreshTokenString.Value)
+	refreshTokenString, err := r.Cookie("refreshToken")
+	if err == nil && refreshTokenString.Value != "" {
+		refreshTokenValid, uuid, err := myJWT.CheckToken(refreshTokenString.Value, csrfSecret, true, checkCsrf)
+		if err == nil && refreshTokenValid {
+			newAuthTokenString, newRefreshTokenString, newCsrfSecret, err := myJWT.RefreshTokens(refreshTokenString.Value, r)
 			if err != nil {
-				helpers.ThrowErr(w, r, "Creating new tokens error", err)
-				return
+				log.Printf("Creating new tokens error: %v", err)
+				return "", false
 			}
 
 			WriteNewAuth(w, r, newAuthTokenString, newRefreshTokenString, newCsrfSecret)
+			return uuid, true
+		}
+	}
 
-			context.Set(r, "uuid", uuid)
-			return true
+	return
+}
+
+// API authenticates an API request from a personal access token, a bearer token or the auth cookies.
+// Cookie requests which can change anything must send the CSRF secret in the X-CSRF-Token header.
+// token is only set for personal access tokens, whose scopes the API has to check.
+// It never writes an error so the API can reply with its own.
+func API(w http.ResponseWriter, r *http.Request) (uuid string, token models.AccessToken, valid bool) {
+	if tokenString, found := bearerToken(r); found && strings.HasPrefix(tokenString, models.AccessTokenPrefix) {
+		token, valid = checkAccessToken(tokenString)
+		if !valid {
+			w.Header().Set("WWW-Authenticate", bearerChallenge)
+			return "", token, false
 		}
+
+		return strconv.Itoa(token.UserUUID), token, true
 	}
 
+	checkCsrf := r.Method != http.MethodGet && r.Method != http.MethodHead && r.Method != http.MethodOptions
+	uuid, valid = authenticate(w, r, r.Header.Get("X-CSRF-Token"), checkCsrf)
 	return
 }
 
+// Bearer authenticates a request from an "Authorization: Bearer <auth token>" header.
+// CSRF isn't checked as browsers never send the header by themselves.
+// If found is false the request didn't use the header and the cookies should be checked instead.
+// Personal access tokens aren't JWTs so they are never valid here, they only work with the API.
+func Bearer(r *http.Request) (uuid string, found, valid bool) {
+	tokenString, found := bearerToken(r)
+	if !found {
+		return
+	}
+
+	valid, uuid, err := myJWT.CheckAuthToken(tokenString)
+	if err != nil || !valid {
+		return "", true, false
+	}
+
+	return uuid, true, true
+}
+
+// bearerToken returns the token in a request's Authorization header.
+func bearerToken(r *http.Request) (tokenString string, found bool) {
+	header := r.Header.Get("Authorization")
+	if len(header) < len(bearerPrefix) || !strings.EqualFold(header[:len(bearerPrefix)], bearerPrefix) {
+		return
+	}
+
+	return strings.TrimSpace(header[len(bearerPrefix):]), true
+}
+
+// checkAccessToken checks a personal access token and records that it has been used.
+func checkAccessToken(tokenString string) (token models.AccessToken, valid bool) {
+	token, exists, err := db.GetAccessTokenFromHash(helpers.HashAccessToken(tokenString))
+	if err != nil {
+		log.Printf("Getting access token error: %v", err)
+		return
+	}
+
+	if !exists {
+		return
+	}
+
+	// Only record the time every so often so scripts don't write to the DB on every request.
+	now := time.Now().Unix()
+	if now-token.LastUsed >= accessTokenUseInterval {
+		token.LastUsed = now
+
+		err = db.UseAccessToken(token.ID, now)
+		if err != nil {
+			log.Printf("Using access token error: %v", err)
+		}
+	}
+
+	return token, true
+}
+
+// BearerUnauthorized tells a client its bearer token is invalid or has expired.
+func BearerUnauthorized(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", bearerChallenge)
+	w.WriteHeader(http.StatusUnauthorized)
+}
+
 // WriteNewAuth writes authentication to a user's browser.
 func WriteNewAuth(w http.ResponseWriter, r *http.Request, authTokenString, refreshTokenString, csrfSecret string) {
 	expiration := time.Now().Add(time.Hour * 24 * 365)
@@ -0,0 +1,408 @@
+package myJWT
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VolticFroogo/Bernies-Busy-Bees/models"
+	"github.com/dgrijalva/jwt-go"
+)
+
+/*
+	Key ring
+*/
+
+const (
+	// keysDir holds a PEM file for each key, named after the key's ID.
+	// Private keys like app.rsa sign and verify tokens, public keys like old.rsa.pub only verify them.
+	keysDir = "keys"
+	// signingKeyFile names the key to sign new tokens with, so it can be changed without a restart.
+	signingKeyFile = "signing"
+	// legacyKeyID is the key used to verify tokens without a kid header, which were all signed by keys/app.rsa.
+	legacyKeyID = "app"
+	// keysReloadTime is how often the keys directory is checked for changes.
+	keysReloadTime = 30 * time.Second
+)
+
+// key is a key tokens can be verified with, and signed with if the private key is known.
+type key struct {
+	ID      string
+	method  jwt.SigningMethod
+	private crypto.Signer
+	public  crypto.PublicKey
+}
+
+// keyRing is every key in the keys directory along with the one new tokens are signed with.
+type keyRing struct {
+	keys    map[string]key
+	signing key
+	// files describes the files the keys were read from, so changes can be noticed.
+	files string
+}
+
+var (
+	ring     keyRing
+	ringLock sync.RWMutex
+)
+
+// InitKeys loads the key ring and keeps reloading it whenever the keys directory changes.
+// New tokens are signed with the key named in keys/signing, or by JWT_SIGNING_KEY, or otherwise app.
+func InitKeys() (err error) {
+	files, err := keyFiles()
+	if err != nil {
+		return
+	}
+
+	loaded, err := loadKeys(files)
+	if err != nil {
+		return
+	}
+
+	ringLock.Lock()
+	ring = loaded
+	ringLock.Unlock()
+
+	go keysReloader()
+	return
+}
+
+func keysReloader() {
+	ticker := time.NewTicker(keysReloadTime)
+	for {
+		<-ticker.C
+
+		files, err := keyFiles()
+		if err != nil {
+			log.Printf("Error reading JWT keys directory: %v", err)
+			continue
+		}
+
+		ringLock.RLock()
+		changed := files != ring.files
+		ringLock.RUnlock()
+		if !changed {
+			continue
+		}
+
+		// Keep using the old keys until the new ones are valid.
+		loaded, err := loadKeys(files)
+		if err != nil {
+			log.Printf("Error reloading JWT keys: %v", err)
+			continue
+		}
+
+		ringLock.Lock()
+		ring = loaded
+		ringLock.Unlock()
+
+		log.Printf("Reloaded %v JWT keys, signing with %v", len(loaded.keys), loaded.signing.ID)
+	}
+}
+
+// keyFiles describes every file in the keys directory by its name, size and modification time.
+func keyFiles() (files string, err error) {
+	infos, err := ioutil.ReadDir(keysDir)
+	if err != nil {
+		return
+	}
+
+	for _, info := range infos {
+		files += fmt.Sprintf("%v %v %v\n", info.Name(), info.Size(), info.ModTime().UnixNano())
+	}
+
+	return
+}
+
+// loadKeys reads every key in the keys directory.
+func loadKeys(files string) (loaded keyRing, err error) {
+	infos, err := ioutil.ReadDir(keysDir)
+	if err != nil {
+		return
+	}
+
+	loaded.keys = map[string]key{}
+	loaded.files = files
+
+	for _, info := range infos {
+		if !info.Mode().IsRegular() {
+			continue
+		}
+
+		name := info.Name()
+		if name == signingKeyFile {
+			continue
+		}
+
+		id := strings.SplitN(name, ".", 2)[0]
+		public := strings.HasSuffix(name, ".pub")
+
+		// A private key already has its public key.
+		if existing, ok := loaded.keys[id]; ok && (public || existing.private != nil) {
+			if !public {
+				return loaded, fmt.Errorf("key %v has more than one private key", id)
+			}
+			continue
+		}
+
+		var data []byte
+		data, err = ioutil.ReadFile(filepath.Join(keysDir, name))
+		if err != nil {
+			return
+		}
+
+		k := key{ID: id}
+		if public {
+			k.public, err = parsePublicKey(data)
+		} else {
+			k.private, err = parsePrivateKey(data)
+			if err == nil {
+				k.public = k.private.Public()
+			}
+		}
+		if err != nil {
+			return loaded, fmt.Errorf("parsing %v: %v", name, err)
+		}
+
+		k.method, err = signingMethod(k.public)
+		if err != nil {
+			return loaded, fmt.Errorf("parsing %v: %v", name, err)
+		}
+
+		loaded.keys[id] = k
+	}
+
+	signingID := os.Getenv("JWT_SIGNING_KEY")
+	data, readErr := ioutil.ReadFile(filepath.Join(keysDir, signingKeyFile))
+	if readErr == nil {
+		signingID = strings.TrimSpace(string(data))
+	} else if !os.IsNotExist(readErr) {
+		return loaded, readErr
+	}
+
+	if signingID == "" {
+		signingID = legacyKeyID
+	}
+
+	signing, ok := loaded.keys[signingID]
+	if !ok || signing.private == nil {
+		return loaded, fmt.Errorf("there is no private key for the signing key %v", signingID)
+	}
+
+	loaded.signing = signing
+	return
+}
+
+func parsePrivateKey(data []byte) (private crypto.Signer, err error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("not a PEM file")
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+
+		private, ok := parsed.(crypto.Signer)
+		if !ok {
+			return nil, errors.New("unsupported private key")
+		}
+
+		return private, nil
+	}
+
+	return nil, fmt.Errorf("unsupported PEM type %v", block.Type)
+}
+
+func parsePublicKey(data []byte) (public crypto.PublicKey, err error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("not a PEM file")
+	}
+
+	switch block.Type {
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	case "PUBLIC KEY":
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	}
+
+	return nil, fmt.Errorf("unsupported PEM type %v", block.Type)
+}
+
+// signingMethod returns the algorithm a key signs with, RS256, ES256 or EdDSA.
+func signingMethod(public crypto.PublicKey) (method jwt.SigningMethod, err error) {
+	switch public := public.(type) {
+	case *rsa.PublicKey:
+		return jwt.SigningMethodRS256, nil
+	case *ecdsa.PublicKey:
+		if public.Curve != elliptic.P256() {
+			return nil, errors.New("only P-256 ECDSA keys are supported")
+		}
+
+		return jwt.SigningMethodES256, nil
+	case ed25519.PublicKey:
+		return SigningMethodEdDSA, nil
+	}
+
+	return nil, errors.New("unsupported key type")
+}
+
+// keyFunc returns the public key named by a token's kid header.
+// Tokens signed with a different algorithm than their key's are refused.
+func keyFunc(token *jwt.Token) (interface{}, error) {
+	id, _ := token.Header["kid"].(string)
+	if id == "" {
+		id = legacyKeyID
+	}
+
+	ringLock.RLock()
+	k, ok := ring.keys[id]
+	ringLock.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown key: %v", id)
+	}
+
+	if token.Method.Alg() != k.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+
+	return k.public, nil
+}
+
+// sign signs a token's claims with the signing key, naming it in the kid header.
+func sign(claims jwt.Claims) (tokenString string, err error) {
+	ringLock.RLock()
+	k := ring.signing
+	ringLock.RUnlock()
+
+	// Make a new unsigned token
+	unsignedToken := jwt.NewWithClaims(k.method, claims)
+	unsignedToken.Header["kid"] = k.ID
+	// Sign token
+	return unsignedToken.SignedString(k.private)
+}
+
+/*
+	JSON Web Key Set
+*/
+
+// JWKS returns the public keys tokens can be verified with, so other services can check them.
+func JWKS() (set models.JWKSet) {
+	ringLock.RLock()
+	defer ringLock.RUnlock()
+
+	set.Keys = []models.JWK{}
+	for _, k := range ring.keys {
+		jwk := models.JWK{
+			KeyID:     k.ID,
+			Use:       "sig",
+			Algorithm: k.method.Alg(),
+		}
+
+		switch public := k.public.(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = encodeBigInt(public.N, 0)
+			jwk.E = encodeBigInt(big.NewInt(int64(public.E)), 0)
+		case *ecdsa.PublicKey:
+			jwk.KeyType = "EC"
+			jwk.Curve = "P-256"
+			jwk.X = encodeBigInt(public.X, 32)
+			jwk.Y = encodeBigInt(public.Y, 32)
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		}
+
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	sort.Slice(set.Keys, func(i, j int) bool {
+		return set.Keys[i].KeyID < set.Keys[j].KeyID
+	})
+
+	return
+}
+
+// encodeBigInt encodes a number as unpadded base64url, left padding it with zeros to size bytes.
+func encodeBigInt(n *big.Int, size int) string {
+	b := n.Bytes()
+	if len(b) < size {
+		b = append(make([]byte, size-len(b)), b...)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+/*
+	EdDSA signing method
+*/
+
+// signingMethodEdDSA signs tokens with Ed25519 keys, which jwt-go doesn't support itself.
+type signingMethodEdDSA struct{}
+
+// SigningMethodEdDSA is the EdDSA signing method, for tokens signed with Ed25519 keys.
+var SigningMethodEdDSA = &signingMethodEdDSA{}
+
+func init() {
+	jwt.RegisterSigningMethod(SigningMethodEdDSA.Alg(), func() jwt.SigningMethod {
+		return SigningMethodEdDSA
+	})
+}
+
+func (m *signingMethodEdDSA) Alg() string {
+	return "EdDSA"
+}
+
+func (m *signingMethodEdDSA) Verify(signingString, signature string, key interface{}) error {
+	public, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return jwt.ErrInvalidKeyType
+	}
+
+	sig, err := jwt.DecodeSegment(signature)
+	if err != nil {
+		return err
+	}
+
+	if !ed25519.Verify(public, []byte(signingString), sig) {
+		return errors.New("ed25519: verification error")
+	}
+
+	return nil
+}
+
+func (m *signingMethodEdDSA) Sign(signingString string, key interface{}) (string, error) {
+	private, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return "", jwt.ErrInvalidKeyType
+	}
+
+	return jwt.EncodeSegment(ed25519.Sign(private, []byte(signingString))), nil
+}
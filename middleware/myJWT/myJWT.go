@@ -1,9 +1,11 @@
 package myJWT
 
 import (
-	"crypto/rsa"
+	"database/sql"
 	"fmt"
-	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/VolticFroogo/Bernies-Busy-Bees/db"
@@ -12,70 +14,54 @@ import (
 	"github.com/dgrijalva/jwt-go"
 )
 
-// Variables
-var (
-	signKey   *rsa.PrivateKey
-	verifyKey *rsa.PublicKey
-)
-
-const (
-	privKeyPath = "keys/app.rsa"
-	pubKeyPath  = "keys/app.rsa.pub"
-)
-
-// InitKeys defines the signing and verification RSA keys for JWT.
-func InitKeys() error {
-	signBytes, err := ioutil.ReadFile(privKeyPath)
-	if err != nil {
-		return err
+// DeleteJTI deletes the family of a refresh token, so no token from its login can be used again.
+func DeleteJTI(tokenString string) (err error) {
+	jti, err := refreshJTI(tokenString)
+	if err == sql.ErrNoRows {
+		return nil // The family has already been revoked or has expired.
 	}
-
-	signKey, err = jwt.ParseRSAPrivateKeyFromPEM(signBytes)
 	if err != nil {
-		return err
+		return
 	}
 
-	verifyBytes, err := ioutil.ReadFile(pubKeyPath)
-	if err != nil {
-		return err
-	}
+	err = db.DeleteJTIFamily(jti.Family)
+	return
+}
 
-	verifyKey, err = jwt.ParseRSAPublicKeyFromPEM(verifyBytes)
+// Family returns the family of a refresh token, which is the session it belongs to.
+// It is empty if the token is invalid or its session has been logged out.
+func Family(tokenString string) (family string) {
+	jti, err := refreshJTI(tokenString)
 	if err != nil {
-		return err
+		return
 	}
 
-	return nil
+	return jti.Family
 }
 
-// DeleteJTI deletes a JTI when given a refresh token.
-func DeleteJTI(tokenString string) (err error) {
-	token, _ := jwt.ParseWithClaims(tokenString, &models.TokenClaims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
+// refreshJTI returns the JTI of a refresh token, or sql.ErrNoRows if it doesn't have one.
+func refreshJTI(tokenString string) (jti models.JTI, err error) {
+	token, _ := jwt.ParseWithClaims(tokenString, &models.TokenClaims{}, keyFunc)
+	if token == nil {
+		return jti, sql.ErrNoRows
+	}
 
-		return verifyKey, nil
-	})
+	tokenClaims, ok := token.Claims.(*models.TokenClaims)
+	if !ok || tokenClaims.StandardClaims.Id == "" {
+		return jti, sql.ErrNoRows
+	}
 
-	tokenClaims, _ := token.Claims.(*models.TokenClaims)
-	err = db.DeleteJTI(tokenClaims.StandardClaims.Id)
-	return
+	return db.GetJTI(tokenClaims.StandardClaims.Id)
 }
 
 /*
 	Refreshing tokens and all related functions.
 */
 
-// RefreshTokens returns new fresh tokens with a CSRF Secret.
-func RefreshTokens(oldRefreshTokenString string) (newAuthTokenString, newRefreshTokenString, newCsrfSecret string, err error) {
-	token, err := jwt.ParseWithClaims(oldRefreshTokenString, &models.TokenClaims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-
-		return verifyKey, nil
-	})
+// RefreshTokens returns new fresh tokens with a CSRF Secret in the same family as the old refresh token.
+// The old refresh token must have already been checked, which rotates it.
+func RefreshTokens(oldRefreshTokenString string, r *http.Request) (newAuthTokenString, newRefreshTokenString, newCsrfSecret string, err error) {
+	token, err := jwt.ParseWithClaims(oldRefreshTokenString, &models.TokenClaims{}, keyFunc)
 	if err != nil {
 		return
 	}
@@ -85,7 +71,12 @@ func RefreshTokens(oldRefreshTokenString string) (newAuthTokenString, newRefresh
 		return
 	}
 
-	return CreateNewTokens(oldTokenClaims.StandardClaims.Subject)
+	jti, err := db.GetJTI(oldTokenClaims.StandardClaims.Id)
+	if err != nil {
+		return // The family may have been revoked since the token was checked.
+	}
+
+	return createTokens(oldTokenClaims.StandardClaims.Subject, jti.Family, r)
 }
 
 /*
@@ -94,13 +85,10 @@ func RefreshTokens(oldRefreshTokenString string) (newAuthTokenString, newRefresh
 
 // CheckToken checks the validity of a token.
 func CheckToken(tokenString, csrfSecret string, refresh, checkCsrf bool) (valid bool, uuid string, err error) {
-	token, err := jwt.ParseWithClaims(tokenString, &models.TokenClaims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-
-		return verifyKey, nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, &models.TokenClaims{}, keyFunc)
+	if token == nil {
+		return // The token is malformed.
+	}
 
 	tokenClaims, ok := token.Claims.(*models.TokenClaims)
 	if !ok {
@@ -112,35 +100,220 @@ func CheckToken(tokenString, csrfSecret string, refresh, checkCsrf bool) (valid
 	}
 
 	if refresh {
-		jti, err := db.GetJTI(tokenClaims.StandardClaims.Id)
-		if err != nil {
-			return false, "", fmt.Errorf("getting jti error")
+		if !token.Valid || tokenClaims.StandardClaims.Id == "" {
+			return false, "", nil
 		}
 
-		jtiValid, err := db.CheckJTI(jti)
-		if err != nil {
-			return false, "", fmt.Errorf("checking jti error")
+		// There will be a new JTI created in the same family by the middleware.
+		jtiValid, err := rotateJTI(tokenClaims.StandardClaims.Id)
+		if err != nil || !jtiValid {
+			return false, "", err
 		}
 
-		if jtiValid {
-			err = db.DeleteJTI(tokenClaims.StandardClaims.Id) // There will be a new JTI created in it's place by the middleware.
-			if err != nil {
-				return true, tokenClaims.StandardClaims.Subject, err
-			}
+		return true, tokenClaims.StandardClaims.Subject, nil
+	}
 
-			return true, tokenClaims.StandardClaims.Subject, nil
-		}
+	// Refresh and two-factor challenge tokens can't be used in place of an auth token.
+	if !token.Valid || tokenClaims.StandardClaims.Id != "" || tokenClaims.StandardClaims.Audience != "" {
+		return false, "", nil
+	}
+
+	current, err := currentVersion(tokenClaims)
+	if err != nil || !current {
+		return false, "", err
+	}
+
+	return true, tokenClaims.StandardClaims.Subject, nil
+}
+
+// CheckAuthToken checks an auth token sent without its CSRF secret, like in an Authorization header.
+// Refresh and two-factor challenge tokens are refused so they can't be used in place of an auth token.
+func CheckAuthToken(tokenString string) (valid bool, uuid string, err error) {
+	token, err := jwt.ParseWithClaims(tokenString, &models.TokenClaims{}, keyFunc)
+	if err != nil {
+		return false, "", nil // An invalid or expired token isn't an error.
+	}
+
+	tokenClaims, ok := token.Claims.(*models.TokenClaims)
+	if !ok || !token.Valid || tokenClaims.StandardClaims.Id != "" || tokenClaims.StandardClaims.Audience != "" {
+		return
+	}
+
+	current, err := currentVersion(tokenClaims)
+	if err != nil || !current {
+		return false, "", err
+	}
+
+	return true, tokenClaims.StandardClaims.Subject, nil
+}
+
+// currentVersion returns if an auth token still has its user's token version, so it hasn't been revoked.
+func currentVersion(tokenClaims *models.TokenClaims) (current bool, err error) {
+	uuid, err := strconv.Atoi(tokenClaims.StandardClaims.Subject)
+	if err != nil {
+		return false, nil
+	}
+
+	version, exists, err := db.TokenVersion(uuid)
+	if err != nil {
+		return
+	}
+
+	return exists && tokenClaims.Version == version, nil
+}
+
+// CheckRefreshToken checks a refresh token sent without its CSRF secret and rotates its JTI.
+func CheckRefreshToken(tokenString string) (valid bool, uuid string, err error) {
+	token, err := jwt.ParseWithClaims(tokenString, &models.TokenClaims{}, keyFunc)
+	if err != nil {
+		return false, "", nil // An invalid or expired token isn't an error.
+	}
+
+	tokenClaims, ok := token.Claims.(*models.TokenClaims)
+	if !ok || !token.Valid || tokenClaims.StandardClaims.Id == "" {
+		return
+	}
+
+	valid, err = rotateJTI(tokenClaims.StandardClaims.Id)
+	if err != nil || !valid {
+		return
+	}
+
+	return true, tokenClaims.StandardClaims.Subject, nil
+}
+
+// timeNow returns the current time, tests replace it to check what happens later on.
+var timeNow = time.Now
+
+// rotateJTI uses up a refresh token's JTI so the token is only ever valid once.
+// A token which has already been rotated must have been stolen, so its whole family is revoked.
+func rotateJTI(id string) (valid bool, err error) {
+	jti, err := db.GetJTI(id)
+	if err == sql.ErrNoRows {
+		return false, nil // The family has been revoked or has expired.
+	}
+	if err != nil {
+		return
 	}
 
-	return token.Valid, tokenClaims.StandardClaims.Subject, nil
+	jtiValid, err := db.CheckJTI(jti)
+	if err != nil || !jtiValid {
+		return
+	}
+
+	rotated, err := db.RotateJTI(jti)
+	if err != nil || rotated {
+		return rotated, err
+	}
+
+	// A browser sending several requests at once sends the same refresh token with each, which only the first
+	// can rotate. A reuse this soon is refused without revoking the family, as it's unlikely to be a stolen token.
+	if jti.RotatedAt == 0 || timeNow().Sub(time.Unix(jti.RotatedAt, 0)) < models.RefreshTokenReuseGrace {
+		return false, nil
+	}
+
+	log.Printf("Security: refresh token reused for user %v, revoking token family %v issued %v to %q",
+		jti.UserUUID, jti.Family, time.Unix(jti.IssuedAt, 0).Format(time.RFC3339), jti.UserAgent)
+
+	err = db.DeleteJTIFamily(jti.Family)
+	return false, err
+}
+
+/*
+	Two-factor challenges and all related functions.
+*/
+
+// challengeAudience is the audience of two-factor challenge tokens, which no other token has.
+const challengeAudience = "two-factor"
+
+// CreateChallengeToken creates a token showing someone got a user's password right.
+// It is sent back along with their two-factor code to finish logging in.
+func CreateChallengeToken(uuid string) (challengeTokenString string, err error) {
+	challengeClaims := models.TokenClaims{
+		StandardClaims: jwt.StandardClaims{
+			Subject:   uuid,
+			Audience:  challengeAudience,
+			ExpiresAt: time.Now().Add(models.TwoFactorChallengeValidTime).Unix(),
+		},
+	}
+
+	challengeTokenString, err = sign(challengeClaims)
+
+	return
+}
+
+// CheckChallengeToken checks a two-factor challenge token, returning the user who got their password right.
+func CheckChallengeToken(tokenString string) (valid bool, uuid string) {
+	token, err := jwt.ParseWithClaims(tokenString, &models.TokenClaims{}, keyFunc)
+	if err != nil {
+		return
+	}
+
+	tokenClaims, ok := token.Claims.(*models.TokenClaims)
+	if !ok || !token.Valid || tokenClaims.StandardClaims.Audience != challengeAudience {
+		return
+	}
+
+	return true, tokenClaims.StandardClaims.Subject
+}
+
+// invitationAudience is the audience of invitation tokens, which no other token has.
+const invitationAudience = "invitation"
+
+// CreateInvitationToken creates the token in an invitation's link.
+// It stops working when the invitation expires or is resent, as resending changes its version.
+func CreateInvitationToken(invitation models.Invitation) (invitationTokenString string, err error) {
+	invitationClaims := models.TokenClaims{
+		StandardClaims: jwt.StandardClaims{
+			Subject:   strconv.Itoa(invitation.ID),
+			Audience:  invitationAudience,
+			ExpiresAt: invitation.Expiry,
+		},
+		Version: invitation.Version,
+	}
+
+	invitationTokenString, err = sign(invitationClaims)
+
+	return
+}
+
+// CheckInvitationToken checks an invitation token, returning the ID and version of the invitation it was made for.
+func CheckInvitationToken(tokenString string) (valid bool, id, version int) {
+	token, err := jwt.ParseWithClaims(tokenString, &models.TokenClaims{}, keyFunc)
+	if err != nil {
+		return
+	}
+
+	tokenClaims, ok := token.Claims.(*models.TokenClaims)
+	if !ok || !token.Valid || tokenClaims.StandardClaims.Audience != invitationAudience {
+		return
+	}
+
+	id, err = strconv.Atoi(tokenClaims.StandardClaims.Subject)
+	if err != nil {
+		return
+	}
+
+	return true, id, tokenClaims.Version
 }
 
 /*
 	Creating tokens and all related functions.
 */
 
-// CreateNewTokens creates an auth and refresh token.
-func CreateNewTokens(uuid string) (authTokenString, refreshTokenString, csrfSecret string, err error) {
+// CreateNewTokens creates an auth and refresh token for a new login, starting a new family of refresh tokens.
+// The request is recorded so the session can be recognised.
+func CreateNewTokens(uuid string, r *http.Request) (authTokenString, refreshTokenString, csrfSecret string, err error) {
+	family, err := helpers.GenerateRandomString(32)
+	if err != nil {
+		return
+	}
+
+	return createTokens(uuid, family, r)
+}
+
+// createTokens creates an auth and refresh token, adding the refresh token to a family.
+func createTokens(uuid, family string, r *http.Request) (authTokenString, refreshTokenString, csrfSecret string, err error) {
 	// Generate the CSRF Secret
 	csrfSecret, err = generateCSRFSecret()
 	if err != nil {
@@ -148,7 +321,7 @@ func CreateNewTokens(uuid string) (authTokenString, refreshTokenString, csrfSecr
 	}
 
 	// Generate the refresh token
-	refreshTokenString, err = createRefreshTokenString(uuid, csrfSecret)
+	refreshTokenString, err = createRefreshTokenString(uuid, family, csrfSecret, r)
 	if err != nil {
 		return
 	}
@@ -159,26 +332,33 @@ func CreateNewTokens(uuid string) (authTokenString, refreshTokenString, csrfSecr
 	return
 }
 
-func createRefreshTokenString(uuid, csrfSecret string) (refreshTokenString string, err error) {
+func createRefreshTokenString(uuid, family, csrfSecret string, r *http.Request) (refreshTokenString string, err error) {
+	userUUID, err := strconv.Atoi(uuid)
+	if err != nil {
+		return
+	}
+
+	userAgent := r.UserAgent()
+	if len(userAgent) > 256 {
+		userAgent = userAgent[:256]
+	}
+
 	refreshTokenExp := time.Now().Add(models.RefreshTokenValidTime).Unix()
-	refreshJti, err := db.StoreRefreshToken()
+	refreshJti, err := db.StoreRefreshToken(userUUID, family, userAgent, helpers.ClientIP(r))
 	if err != nil {
 		return
 	}
 
 	refreshClaims := models.TokenClaims{
-		jwt.StandardClaims{
+		StandardClaims: jwt.StandardClaims{
 			Id:        refreshJti.JTI,  // Token Id
 			Subject:   uuid,            // Universally Unique Identifier
 			ExpiresAt: refreshTokenExp, // Expiry time in UNIX
 		},
-		csrfSecret, // CSRF Secret to prevent CSRF
+		CSRF: csrfSecret, // CSRF Secret to prevent CSRF
 	}
 
-	// Make a new unsigned token
-	unsignedToken := jwt.NewWithClaims(jwt.SigningMethodRS256, refreshClaims)
-	// Sign token
-	refreshTokenString, err = unsignedToken.SignedString(signKey)
+	refreshTokenString, err = sign(refreshClaims)
 
 	return
 }
@@ -186,18 +366,26 @@ func createRefreshTokenString(uuid, csrfSecret string) (refreshTokenString strin
 func createAuthTokenString(uuid, csrfSecret string) (authTokenString string, err error) {
 	authTokenExp := time.Now().Add(models.AuthTokenValidTime).Unix()
 
+	userUUID, err := strconv.Atoi(uuid)
+	if err != nil {
+		return
+	}
+
+	version, _, err := db.TokenVersion(userUUID)
+	if err != nil {
+		return
+	}
+
 	authClaims := models.TokenClaims{
-		jwt.StandardClaims{
+		StandardClaims: jwt.StandardClaims{
 			Subject:   uuid,
 			ExpiresAt: authTokenExp,
 		},
-		csrfSecret,
+		CSRF:    csrfSecret,
+		Version: version, // Revoking the user's tokens changes their version.
 	}
 
-	// Make a new unsigned token
-	unsignedToken := jwt.NewWithClaims(jwt.SigningMethodRS256, authClaims)
-	// Sign token
-	authTokenString, err = unsignedToken.SignedString(signKey)
+	authTokenString, err = sign(authClaims)
 
 	return
 }
@@ -0,0 +1,122 @@
+package myJWT
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/VolticFroogo/Bernies-Busy-Bees/db"
+	"github.com/VolticFroogo/Bernies-Busy-Bees/models"
+	"github.com/dgrijalva/jwt-go"
+)
+
+// setup signs tokens with a new key and stores them in an empty database, returning a user to log in as.
+func setup(t *testing.T) (uuid string) {
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	k := key{ID: "test", method: jwt.SigningMethodES256, private: private, public: &private.PublicKey}
+	ringLock.Lock()
+	ring = keyRing{keys: map[string]key{k.ID: k}, signing: k}
+	ringLock.Unlock()
+
+	s, err := db.NewSQLite(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.InitStore(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := db.NewUser("test@example.com", "", "Test", "User", models.RoleParent)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return strconv.Itoa(id)
+}
+
+// refresh rotates a refresh token like the middleware does, returning the next one in its family.
+func refresh(t *testing.T, refreshTokenString string) (newRefreshTokenString string) {
+	valid, _, err := CheckRefreshToken(refreshTokenString)
+	if err != nil || !valid {
+		t.Fatalf("refresh token wasn't valid: %v", err)
+	}
+
+	_, newRefreshTokenString, _, err = RefreshTokens(refreshTokenString, httptest.NewRequest("GET", "/", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return
+}
+
+func TestRefreshTokenReuseWithinGrace(t *testing.T) {
+	uuid := setup(t)
+
+	_, first, _, err := CreateNewTokens(uuid, httptest.NewRequest("GET", "/", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second := refresh(t, first)
+
+	// Another request sent at the same time as the first.
+	valid, _, err := CheckRefreshToken(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if valid {
+		t.Fatal("a rotated refresh token was accepted")
+	}
+
+	valid, _, err = CheckRefreshToken(second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !valid {
+		t.Fatal("a reuse within the grace window revoked the family")
+	}
+}
+
+func TestRefreshTokenReuseAfterGrace(t *testing.T) {
+	uuid := setup(t)
+
+	_, first, _, err := CreateNewTokens(uuid, httptest.NewRequest("GET", "/", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second := refresh(t, first)
+
+	timeNow = func() time.Time {
+		return time.Now().Add(models.RefreshTokenReuseGrace + time.Second)
+	}
+	defer func() {
+		timeNow = time.Now
+	}()
+
+	valid, _, err := CheckRefreshToken(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if valid {
+		t.Fatal("a reused refresh token was accepted")
+	}
+
+	valid, _, err = CheckRefreshToken(second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if valid {
+		t.Fatal("a reuse after the grace window didn't revoke the family")
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/VolticFroogo/Bernies-Busy-Bees/db"
+)
+
+// migrate handles the "migrate up|down|status" subcommand.
+func migrate(args []string) (err error) {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: migrate up|down|status")
+	}
+
+	store, err := db.OpenDefault()
+	if err != nil {
+		return
+	}
+
+	defer store.Close()
+
+	switch args[0] {
+	case "up":
+		return store.MigrateUp()
+
+	case "down":
+		return store.MigrateDown()
+
+	case "status":
+		status, err := store.MigrationStatus()
+		if err != nil {
+			return err
+		}
+
+		for _, m := range status {
+			applied := "pending"
+			if m.Applied {
+				applied = "applied " + m.AppliedTime
+			}
+
+			fmt.Printf("%4d  %-60s %s\n", m.Version, m.Description, applied)
+		}
+
+		return nil
+
+	default:
+		return fmt.Errorf("unknown migrate command: %v", args[0])
+	}
+}
@@ -1,6 +1,8 @@
 package models
 
 import (
+	"strconv"
+	"strings"
 	"time"
 
 	jwt "github.com/dgrijalva/jwt-go"
@@ -12,47 +14,233 @@ const (
 	AuthTokenValidTime = time.Minute * 15
 	// RefreshTokenValidTime is the lifetime of a refresh token.
 	RefreshTokenValidTime = time.Hour * 72
+	// RefreshTokenReuseGrace is how soon after a refresh token is rotated it can be reused without revoking its family.
+	RefreshTokenReuseGrace = time.Second * 5
+	// TwoFactorChallengeValidTime is how long someone has to enter their two-factor code after their password.
+	TwoFactorChallengeValidTime = time.Minute * 5
+	// InvitationValidTime is how long an invitation link works for after it is sent.
+	InvitationValidTime = time.Hour * 24 * 7
 )
 
-// Privileges
+// Login lockouts
 const (
-	PrivNone = iota
-	PrivUser
-	PrivAdmin
-	PrivSuperAdmin
+	// LoginFailuresAllowed is how many times logging in to an account can fail before it is locked.
+	LoginFailuresAllowed = 5
+	// LoginFailuresAllowedIP is how many failures an IP address is allowed, which is higher as people can share one.
+	LoginFailuresAllowedIP = 20
+	// LoginLockoutTime is how long the first lockout lasts, each failure after it doubles it.
+	LoginLockoutTime = time.Second * 30
+	// LoginLockoutMaxTime is the longest a lockout can last.
+	LoginLockoutMaxTime = time.Hour
+	// LoginFailureResetTime is how long after the last failure they are forgotten.
+	LoginFailureResetTime = time.Hour * 24
+	// PasswordGrantsAllowed is how many times an IP address can try the API's password grant each PasswordGrantTime.
+	// API clients can't solve a CAPTCHA, so this stands in for it.
+	PasswordGrantsAllowed = 10
+	// PasswordGrantTime is how long password grants are counted for.
+	PasswordGrantTime = time.Minute
+)
+
+// What login failures are counted for.
+const (
+	LoginFailureEmail = "email"
+	LoginFailureIP    = "ip"
+)
+
+// SiteURL is the public address of the website.
+const SiteURL = "https://berniesbusybees.co.uk"
+
+// Image storage
+const (
+	// ImageBucket is the S3 bucket post images are uploaded to.
+	ImageBucket = "s.froogo.co.uk"
+	// ImageKeyPrefix is the directory in the bucket post images are uploaded to.
+	ImageKeyPrefix = "Static/berniesbusybees.co.uk/img/"
+)
+
+// Permissions a role can be given.
+const (
+	PermPanel             = "panel.access"
+	PermCommentsCreate    = "comments.create"
+	PermCommentsEditAny   = "comments.edit-any"
+	PermCommentsDeleteAny = "comments.delete-any"
+	PermPostsUnpublished  = "posts.view-unpublished"
+	PermPostsCreate       = "posts.create"
+	PermPostsEdit         = "posts.edit"
+	PermPostsDelete       = "posts.delete"
+	PermUsersManage       = "users.manage"
+	PermRolesManage       = "roles.manage"
+	PermLockoutsManage    = "lockouts.manage"
+)
+
+// Permission is a permission along with what it allows, for the role editor.
+type Permission struct {
+	Name, Description string
+}
+
+// Permissions are every permission a role can have.
+var Permissions = []Permission{
+	{PermPanel, "Use the panel and read published posts."},
+	{PermCommentsCreate, "Comment on posts and edit or delete their own comments."},
+	{PermCommentsEditAny, "Edit anyone's comments."},
+	{PermCommentsDeleteAny, "Delete anyone's comments."},
+	{PermPostsUnpublished, "See drafts and scheduled posts."},
+	{PermPostsCreate, "Create posts."},
+	{PermPostsEdit, "Edit any post, its images and its status."},
+	{PermPostsDelete, "Delete any post."},
+	{PermUsersManage, "Create, edit and delete users."},
+	{PermRolesManage, "Create, edit and delete roles."},
+	{PermLockoutsManage, "See and clear login lockouts."},
+}
+
+// Default roles, users' old privilege levels were migrated to these.
+const (
+	RoleNone = iota + 1
+	RoleParent
+	RoleModerator
+	RoleAdmin
+)
+
+// Role is a named set of permissions given to users.
+type Role struct {
+	ID          int
+	Name        string
+	Permissions []string
+	// RequireTwoFactor stops users with the role using its permissions until they set up two-factor authentication.
+	RequireTwoFactor bool
+}
+
+// Has returns if a role has a permission.
+func (role Role) Has(permission string) bool {
+	for _, p := range role.Permissions {
+		if p == permission {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Roles is an array of Role.
+type Roles []Role
+
+// Authorize returns if a user's role gives them a permission.
+// Every permission check should go through here.
+func Authorize(user User, permission string) bool {
+	return user.Role.Has(permission)
+}
+
+// ValidPermission returns if a permission exists.
+func ValidPermission(permission string) bool {
+	for _, p := range Permissions {
+		if p.Name == permission {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Post statuses
+const (
+	PostDraft = iota
+	PostScheduled
+	PostPublished
 )
 
 // Post is the struct used for a post.
 type Post struct {
-	ID                                                       int
-	Title, Description, ImagesJSON, CommentsJSON, CreateTime string
-	Images                                                   []string
-	Comments                                                 []DisplayComment
+	ID, Status                     int
+	PublishTime                    int64
+	Title, Description, CreateTime string
+	Images                         []Image
+	Comments                       []DisplayComment
+}
+
+// Slug returns a readable version of a post's title for its URL.
+func (post Post) Slug() string {
+	var slug []rune
+	for _, r := range strings.ToLower(post.Title) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			slug = append(slug, r)
+		} else if len(slug) != 0 && slug[len(slug)-1] != '-' {
+			slug = append(slug, '-') // Replace anything else with a single dash.
+		}
+	}
+
+	return strings.TrimSuffix(string(slug), "-")
+}
+
+// URL returns the public URL of a post.
+func (post Post) URL() string {
+	url := "/post/" + strconv.Itoa(post.ID)
+
+	slug := post.Slug()
+	if slug != "" {
+		url += "/" + slug
+	}
+
+	return url
+}
+
+// StatusName returns the name of a post's status for displaying.
+func (post Post) StatusName() string {
+	switch post.Status {
+	case PostDraft:
+		return "Draft"
+	case PostScheduled:
+		return "Scheduled"
+	default:
+		return "Published"
+	}
 }
 
 // Posts is an array of Post.
 type Posts []Post
 
+// Image is an image on a post stored in S3.
+type Image struct {
+	ID, PostID, Position, Width, Height int
+	Size                                int64
+	Key, Filename, ContentType, Caption string
+}
+
+// URL returns the public URL of an image.
+func (image Image) URL() string {
+	return "https://" + ImageBucket + "/" + image.Key
+}
+
+// ImageEdit is the struct recieved by an admin when they reorder or caption an image.
+type ImageEdit struct {
+	ID, Position int
+	Caption      string
+}
+
 // PostEdit is the struct recieved by an admin when they change a post.
 type PostEdit struct {
-	ID                             int
-	CsrfSecret, Title, Description string
+	ID                 int
+	Title, Description string
+}
+
+// PostStatusEdit is the struct recieved by an admin when they publish, schedule or unpublish a post.
+type PostStatusEdit struct {
+	ID, Status  int
+	PublishTime int64
 }
 
 // PostDelete is the struct recieved by an admin when they delete a post.
 type PostDelete struct {
-	ID         int
-	CsrfSecret string
+	ID int
 }
 
 // NewComment is the struct recieved by a user when they comment on something.
 type NewComment struct {
-	ID, UserUUID        int
-	Timestamp           int64
-	CsrfSecret, Comment string
+	ID, UserUUID      int
+	Timestamp         int64
+	Comment, ParentID string
 }
 
-// Comment is the struct used to save comments in a DB.
+// Comment is the struct used to save comments in the old JSON column of a post.
 type Comment struct {
 	UserUUID    int
 	Timestamp   int64
@@ -61,28 +249,89 @@ type Comment struct {
 
 // DisplayComment is the struct used to display a comment on the website.
 type DisplayComment struct {
-	UserUUID    int
-	Timestamp   int64
-	Comment, ID string
-	User        User
+	UserUUID                     int
+	Timestamp, Edited            int64
+	Comment, ID, ParentID        string
+	Deleted, Deletable, Editable bool
+	User                         User
+	Revisions                    []CommentRevision
+	Replies                      []DisplayComment
 }
 
-// Comments is an array of comments to be stored in a DB on a post.
+// CommentRevision is a previous version of an edited comment.
+type CommentRevision struct {
+	Timestamp int64
+	Comment   string
+}
+
+// Comments is an array of comments stored in the old JSON column of a post.
 type Comments []Comment
 
 // User is a user retrieved from a Database.
 type User struct {
-	UUID, Priv                                int
+	UUID                                      int
+	Role                                      Role
 	Email, Password, Fname, Lname, CreateTime string
+	// TwoFactor is true if the user logs in with a TOTP code as well as their password.
+	TwoFactor bool
+	// Passkeys is true if the user has a passkey, which can be used instead of a TOTP code after their password.
+	Passkeys bool
+	// Registration is how far a user who signed up themselves is from being approved.
+	Registration int
+}
+
+// Registration states of users who signed up themselves.
+const (
+	// RegistrationNone is every approved user, and every user made by an admin.
+	RegistrationNone = iota
+	// RegistrationUnverified users haven't verified their email address yet.
+	RegistrationUnverified
+	// RegistrationPending users are waiting for an admin to approve them.
+	RegistrationPending
+)
+
+// VerificationResendTime is how long someone signing up again with an unverified email waits for another verification email.
+const VerificationResendTime = time.Minute * 10
+
+// HasTwoFactor returns if logging in as a user needs a TOTP code or a passkey as well as their password.
+func (user User) HasTwoFactor() bool {
+	return user.TwoFactor || user.Passkeys
+}
+
+// NeedsTwoFactor returns if a user's role requires two-factor authentication which they haven't set up.
+func (user User) NeedsTwoFactor() bool {
+	return user.Role.RequireTwoFactor && !user.HasTwoFactor()
 }
 
 // Users is an array of User for the admin page.
 type Users []User
 
 // TokenClaims are the claims in a token.
+// Version is set for auth tokens, which stop working once the user's token version changes,
+// and for invitation tokens, which stop working once the invitation is resent.
 type TokenClaims struct {
 	jwt.StandardClaims
-	CSRF string `json:"csrf"`
+	CSRF    string `json:"csrf"`
+	Version int    `json:"ver,omitempty"`
+}
+
+// JWK is a public key in a JSON Web Key Set.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	// N and E are set for RSA keys, Curve and X for elliptic curve keys and Y for ECDSA keys.
+	N     string `json:"n,omitempty"`
+	E     string `json:"e,omitempty"`
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+	Y     string `json:"y,omitempty"`
+}
+
+// JWKSet is a JSON Web Key Set, the public keys tokens can be verified with.
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
 }
 
 // TemplateVariables is the struct used when executing a template.
@@ -90,24 +339,145 @@ type TemplateVariables struct {
 	CsrfSecret string
 	User       User
 	Users      Users
-	Posts      Posts
-	Post       Post
-	UnixTime   int64
-	Page       Page
+	// Registrations are the users who signed up themselves and are waiting for approval.
+	Registrations Users
+	Posts         Posts
+	Post          Post
+	UnixTime      int64
+	Page          Page
+	AccessTokens  []AccessToken
+	Sessions      []Session
+	// RecoveryCodes is how many unused two-factor recovery codes the user has.
+	RecoveryCodes int
+	Passkeys      []Passkey
+	LoginFailures []LoginFailure
+	Invitations   []Invitation
+	Scopes        []Scope
+	Roles         Roles
+	// GrantableRoles are the roles the user is allowed to give to someone.
+	GrantableRoles Roles
+	Permissions    []Permission
 }
 
-// AJAXData is the struct used with the AJAX middleware.
-type AJAXData struct {
-	CsrfSecret string
+// AccessTokenPrefix starts every personal access token so they can be told apart from JWTs.
+const AccessTokenPrefix = "bbb_"
+
+// AccessToken is a personal access token, only a hash of the token itself is stored.
+type AccessToken struct {
+	ID, UserUUID int
+	// Prefix is the start of the token so people can recognise it.
+	Name, Prefix string
+	Scopes       []string
+	CreateTime   int64
+	// LastUsed is 0 if the token has never been used.
+	LastUsed int64
+}
+
+// Passkey is a WebAuthn credential a user can log in with instead of their password, or as their second factor.
+type Passkey struct {
+	ID, UserUUID int
+	// CredentialID and PublicKey are base64url, the public key is PKIX DER.
+	CredentialID, PublicKey, Name string
+	// SignCount is the authenticator's signature counter, which should only ever go up.
+	SignCount  int64
+	CreateTime int64
+	// LastUsed is 0 if the passkey has never been used.
+	LastUsed int64
+}
+
+// PasskeyOptions are what the browser needs to create or use a passkey, binary values are base64url.
+type PasskeyOptions struct {
+	Success   bool   `json:"success"`
+	Challenge string `json:"challenge"`
+	RPID      string `json:"rpId"`
+	RPName    string `json:"rpName,omitempty"`
+	// The user is only set when creating a passkey.
+	UserID          string `json:"userId,omitempty"`
+	UserName        string `json:"userName,omitempty"`
+	UserDisplayName string `json:"userDisplayName,omitempty"`
+	// CredentialIDs are the passkeys which can be used, or which already exist when creating one.
+	CredentialIDs    []string `json:"credentialIds"`
+	UserVerification string   `json:"userVerification"`
+}
+
+// HasScope returns if a token has been given a scope.
+func (token AccessToken) HasScope(scope string) bool {
+	for _, s := range token.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Scope is a permission a personal access token can be given.
+type Scope struct {
+	Name, Description string
+	// Permission is the permission needed to give a token the scope, anyone can if it's empty.
+	Permission string
+}
+
+// Scopes are every scope an access token can have.
+var Scopes = []Scope{
+	{"profile:read", "Read your own account.", ""},
+	{"posts:read", "Read posts and their comments.", PermPanel},
+	{"posts:write", "Create, edit and delete posts.", PermPostsEdit},
+	{"comments:write", "Write, edit and delete your own comments.", PermCommentsCreate},
+	{"comments:moderate", "Edit and delete anyone's comments, along with comments:write.", PermCommentsDeleteAny},
+	{"users:admin", "Create, edit and delete users.", PermUsersManage},
 }
 
 // JTI is the struct used for JTIs in the DB.
+// Every refresh token from the same login shares a family, which is revoked if a rotated token is reused.
 type JTI struct {
-	ID     int
-	Expiry int64
-	JTI    string
+	ID, UserUUID                int
+	Expiry, IssuedAt, RotatedAt int64
+	JTI, Family, UserAgent, IP  string
+}
+
+// Session is a login on one device, made of a family of refresh tokens.
+type Session struct {
+	Family, UserAgent, IP string
+	// LastSeen is when the session last refreshed its tokens.
+	LastSeen int64
+	// Current is true for the session viewing the page.
+	Current bool
+}
+
+// LoginFailure counts failed logins for an email address or an IP address.
+type LoginFailure struct {
+	ID int
+	// Kind is LoginFailureEmail or LoginFailureIP, Subject is the address.
+	Kind, Subject string
+	Failures      int
+	LastFailure   int64
+	// LockedUntil is when logging in is allowed again, it is in the past if it isn't locked.
+	LockedUntil int64
+}
+
+// Invitation lets someone create their own account with a role chosen by whoever invited them.
+type Invitation struct {
+	ID    int
+	Email string
+	Role  Role
+	// Version goes up each time the invitation is resent, so only the newest link works.
+	Version   int
+	InvitedBy int
+	// CreateTime is when the invitation was first sent and Expiry is when its newest link stops working.
+	CreateTime, Expiry int64
+}
+
+// Migration is the status of a schema migration.
+type Migration struct {
+	Version                  int
+	Applied                  bool
+	Description, AppliedTime string
 }
 
+// Migrations is an array of Migration.
+type Migrations []Migration
+
 // Page is a convenience for template execution.
 type Page struct {
 	Next, Current, Last int
@@ -124,3 +494,34 @@ type ResponseWithIDInt struct {
 	Success bool `json:"success"`
 	ID      int  `json:"id"`
 }
+
+// TwoFactorChallenge is the response to a correct password from a user with two-factor authentication.
+// The challenge is sent back along with their code to finish logging in.
+type TwoFactorChallenge struct {
+	Success   bool   `json:"success"`
+	TwoFactor bool   `json:"twoFactor"`
+	Challenge string `json:"challenge"`
+	// Code is true if a code from an authenticator app can be sent, otherwise only a passkey can be used.
+	Code bool `json:"code"`
+}
+
+// LoginLocked is the response to a login while the account or IP address is locked.
+type LoginLocked struct {
+	Success bool `json:"success"`
+	Locked  bool `json:"locked"`
+	// RetryAfter is how many seconds until logging in is allowed again.
+	RetryAfter int64 `json:"retryAfter"`
+}
+
+// TwoFactorSecret is a new TOTP secret for a user to add to their authenticator app.
+type TwoFactorSecret struct {
+	Success bool   `json:"success"`
+	Secret  string `json:"secret"`
+	URI     string `json:"uri"`
+}
+
+// RecoveryCodes are two-factor recovery codes, which are only ever shown once.
+type RecoveryCodes struct {
+	Success       bool     `json:"success"`
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
@@ -0,0 +1,70 @@
+// captcha is the CAPTCHA the server checks, which decides the widget shown in #captcha.
+var captcha = {provider: "", siteKey: "", invisible: false};
+var captchaWidget = null; // The ID of the rendered widget.
+
+$(document).ready(function(){
+    $.getJSON("/captcha", function(c) {
+        captcha = c;
+
+        switch(captcha.provider) {
+            case "recaptcha": {
+                if (captcha.invisible) {
+                    // reCAPTCHA v3 has no widget, it scores the user each time a response is asked for.
+                    CaptchaScript("https://www.google.com/recaptcha/api.js?render=" + encodeURIComponent(captcha.siteKey));
+                } else {
+                    window.CaptchaLoaded = function() {
+                        captchaWidget = grecaptcha.render("captcha", {sitekey: captcha.siteKey});
+                    };
+                    CaptchaScript("https://www.google.com/recaptcha/api.js?onload=CaptchaLoaded&render=explicit");
+                }
+                break;
+            }
+            case "hcaptcha": {
+                window.CaptchaLoaded = function() {
+                    captchaWidget = hcaptcha.render("captcha", {sitekey: captcha.siteKey});
+                };
+                CaptchaScript("https://js.hcaptcha.com/1/api.js?onload=CaptchaLoaded&render=explicit");
+                break;
+            }
+        }
+    });
+});
+
+// CaptchaScript loads a provider's script.
+function CaptchaScript(src) {
+    var script = document.createElement("script");
+    script.src = src;
+    script.async = true;
+    document.head.appendChild(script);
+}
+
+// CaptchaResponse resolves to the response to send with a form, action names the form to reCAPTCHA v3.
+// It is empty if the widget hasn't loaded, which only the fake provider accepts.
+function CaptchaResponse(action) {
+    return new Promise(function(resolve) {
+        if (captcha.provider == "recaptcha" && captcha.invisible && window.grecaptcha) {
+            grecaptcha.ready(function() {
+                grecaptcha.execute(captcha.siteKey, {action: action}).then(resolve, function() {
+                    resolve("");
+                });
+            });
+        } else if (captcha.provider == "recaptcha" && captchaWidget !== null) {
+            resolve(grecaptcha.getResponse(captchaWidget));
+        } else if (captcha.provider == "hcaptcha" && captchaWidget !== null) {
+            resolve(hcaptcha.getResponse(captchaWidget));
+        } else {
+            resolve("");
+        }
+    });
+}
+
+// CaptchaReset clears the widget after its response has been used.
+function CaptchaReset() {
+    if (captchaWidget === null) return;
+
+    if (captcha.provider == "recaptcha") {
+        grecaptcha.reset(captchaWidget);
+    } else if (captcha.provider == "hcaptcha") {
+        hcaptcha.reset(captchaWidget);
+    }
+}
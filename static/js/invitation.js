@@ -0,0 +1,70 @@
+$(document).ready(function(){
+    M.AutoInit();
+    Waves.displayEffect();
+
+    $("#button").click(function(){
+        if ($("#password").val() !== $("#confirmPassword").val()) {
+            M.toast({html: "Passwords are different."});
+            return;
+        }
+
+        if ($("#password").val().length < 8) {
+            M.toast({html: "Your password needs to be at least 8 characters long."});
+            return;
+        }
+
+        M.toast({html: "Creating your account!"});
+
+        $.ajax({
+            url: "/invitation",
+            type: "POST",
+            contentType: "application/json; charset=utf-8",
+            data: JSON.stringify({
+                Token: getUrlParameter("token"),
+                Fname: $("#fname").val(),
+                Lname: $("#lname").val(),
+                Password: $("#password").val()
+            }),
+            dataType: "json",
+            success: function(r) {
+                switch(r.Code) {
+                    case 0: {
+                        window.location.replace("/panel");
+                        break;
+                    }
+                    case 1: {
+                        M.toast({html: "Please enter your first and last name, and a password of at least 8 characters."});
+                        break;
+                    }
+                    case 2: {
+                        M.toast({html: "Your invitation has expired or has already been used, ask for a new one."});
+                        break;
+                    }
+                    case 3: {
+                        M.toast({html: "Error 500: Internal server error."});
+                        break;
+                    }
+                    default: {
+                        M.toast({html: "Unknown error..."});
+                        break;
+                    }
+                }
+            }
+        });
+    });
+
+    var getUrlParameter = function getUrlParameter(sParam) {
+        var sPageURL = decodeURIComponent(window.location.search.substring(1)),
+            sURLVariables = sPageURL.split('&'),
+            sParameterName,
+            i;
+
+        for (i = 0; i < sURLVariables.length; i++) {
+            sParameterName = sURLVariables[i].split('=');
+
+            if (sParameterName[0] === sParam) {
+                return sParameterName[1] === undefined ? true : sParameterName[1];
+            }
+        }
+    };
+});
@@ -1,3 +1,5 @@
+var challenge = ""; // Sent back with a two-factor code once the password is right.
+
 $(document).ready(function(){
     M.AutoInit();
     Waves.displayEffect();
@@ -5,26 +7,137 @@ $(document).ready(function(){
     $("#login-button").click(function(){
         M.toast({html: "Sending login request!"});
  
+        CaptchaResponse("login").then(function(response) {
+            $.ajax({
+                url: "/login",
+                type: "POST",
+                contentType: "application/json; charset=utf-8",
+                data: JSON.stringify({
+                    Email: $("#email").val(),
+                    Password: $("#password").val(),
+                    Captcha: response
+                }),
+                dataType: "json",
+                success: function(r) {
+                    if(r.success) {
+                        window.location.replace("/panel");
+                    } else if(r.locked) {
+                        M.Toast.dismissAll(); // Clear all other toasts.
+                        M.toast({html: LockedMessage(r.retryAfter)});
+                    } else if(r.twoFactor) {
+                        // The password was right, now ask for a two-factor code or passkey.
+                        M.Toast.dismissAll(); // Clear all other toasts.
+                        challenge = r.challenge;
+                        $("#credentials").hide();
+                        $("#two-factor").show();
+                        if(r.code) {
+                            $("#two-factor-code").focus();
+                        } else {
+                            // Users without an authenticator app can only use one of their passkeys.
+                            $("#two-factor-code").closest(".input-field").hide();
+                            $("#two-factor-button").hide();
+                        }
+                    } else {
+                        M.Toast.dismissAll(); // Clear all other toasts.
+                        M.toast({html: "Invalid login credentials."});
+                    }
+                }
+            });
+
+            CaptchaReset(); // The response can only be used once.
+        });
+    });
+
+    $("#two-factor-button").click(function(){
+        M.toast({html: "Sending two-factor code!"});
+
         $.ajax({
-            url: "/login",
+            url: "/login/two-factor",
             type: "POST",
             contentType: "application/json; charset=utf-8",
             data: JSON.stringify({
-                Email: $("#email").val(),
-                Password: $("#password").val(),
-                Captcha: grecaptcha.getResponse()
+                Challenge: challenge,
+                Code: $("#two-factor-code").val().trim()
             }),
             dataType: "json",
             success: function(r) {
                 if(r.success) {
                     window.location.replace("/panel");
+                } else if(r.locked) {
+                    M.Toast.dismissAll(); // Clear all other toasts.
+                    M.toast({html: LockedMessage(r.retryAfter)});
                 } else {
                     M.Toast.dismissAll(); // Clear all other toasts.
-                    M.toast({html: "Invalid login credentials."});
+                    M.toast({html: "Invalid two-factor code."});
                 }
             }
         });
+    });
+
+    // Passkeys can be used instead of a password, or instead of a two-factor code.
+    $("#passkey-button").click(function(){
+        PasskeyLogin("");
+    });
+
+    $("#two-factor-passkey-button").click(function(){
+        PasskeyLogin(challenge);
+    });
+
+    $("#two-factor-code").keypress(function(e){
+        if(e.which == 13) {
+            $("#two-factor-button").click();
+        }
+    });
+});
+
+// LockedMessage tells the user how long until they can try logging in again.
+function LockedMessage(retryAfter) {
+    var minutes = Math.ceil(retryAfter / 60);
+    return "Too many failed logins, try again in " + minutes + (minutes == 1 ? " minute." : " minutes.");
+}
+
+function PasskeyLogin(twoFactorChallenge) {
+    if (!window.PublicKeyCredential) {
+        M.toast({html: "Your browser doesn't support passkeys."});
+        return;
+    }
+
+    $.ajax({
+        url: "/login/passkey/begin",
+        type: "POST",
+        contentType: "application/json; charset=utf-8",
+        data: JSON.stringify({
+            Challenge: twoFactorChallenge
+        }),
+        dataType: "json",
+        success: function(r) {
+            if(!r.success) {
+                M.Toast.dismissAll(); // Clear all other toasts.
+                M.toast({html: "You don't have any passkeys."});
+                return;
+            }
+
+            PasskeyGet(r).then(function(assertion) {
+                assertion.Challenge = twoFactorChallenge;
 
-        grecaptcha.reset(); // Reset the recaptcha
+                $.ajax({
+                    url: "/login/passkey",
+                    type: "POST",
+                    contentType: "application/json; charset=utf-8",
+                    data: JSON.stringify(assertion),
+                    dataType: "json",
+                    success: function(r) {
+                        if(r.success) {
+                            window.location.replace("/panel");
+                        } else {
+                            M.Toast.dismissAll(); // Clear all other toasts.
+                            M.toast({html: "Invalid passkey."});
+                        }
+                    }
+                });
+            }).catch(function() {
+                M.toast({html: "Passkey login cancelled."});
+            });
+        }
     });
-});
\ No newline at end of file
+}
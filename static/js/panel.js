@@ -6,13 +6,6 @@ $(document).ready(function(){
     // User Update
     $("#users").on("click", ".user-update", function(){
         var user = $(this).closest(".user-li");
-        var local = parseInt(user.attr("data-local"));
-
-        if (local === 1) {
-            UserNew(user);
-            return;
-        }
-
         var id = parseInt(user.attr("data-id"));
 
         M.toast({html: "Updating user."});
@@ -28,7 +21,7 @@ $(document).ready(function(){
                 Password: user.find(".user-password").val(),
                 Fname: user.find(".user-fname").val(),
                 Lname: user.find(".user-lname").val(),
-                Privileges: parseInt(user.find(".user-privileges").val())
+                Role: parseInt(user.find(".user-role").val())
             }),
             dataType: "json",
             success: function(r) {
@@ -43,78 +36,323 @@ $(document).ready(function(){
         });
     });
 
-    // User New
-    function UserNew(user) {
-        M.toast({html: "Adding new user."});
-    
+    // User Delete
+   $("#users").on("click", ".user-delete", function(){
+        M.toast({html: "Deleting user."});
+
+        var user = $(this).closest(".user-li");
+        var id = parseInt(user.attr("data-id"));
+
         $.ajax({
-            url: "/panel/user/new",
+            url: "/panel/user/delete",
             type: "POST",
             contentType: "application/json; charset=utf-8",
             data: JSON.stringify({
                 CsrfSecret: CsrfSecret,
-                Email: user.find(".user-email").val(),
-                Password: user.find(".user-password").val(),
-                Fname: user.find(".user-fname").val(),
-                Lname: user.find(".user-lname").val(),
-                Privileges: parseInt(user.find(".user-privileges").val())
+                ID: id
             }),
             dataType: "json",
             success: function(r) {
                 M.Toast.dismissAll(); // Clear all other toasts.
                 if (r.success) {
-                    user.attr("data-local", "0");
-                    user.find(".user-header").text(user.find(".user-fname").val() + " " + user.find(".user-lname").val());
-                    user.attr("data-id", r.id);
-                    M.toast({html: "Successfully added new user."});
+                    user.remove();
+                    M.toast({html: "Successfully deleted user."});
                 } else {
-                    M.toast({html: "Error adding new user, refresh the page."});
+                    M.toast({html: "Error deleting user, refresh the page."});
                 }
             }
         });
-    }
+    });
 
-    // User Delete
-   $("#users").on("click", ".user-delete", function(){
-        M.toast({html: "Deleting user."});
+    // User Sessions Delete
+    $("#users").on("click", ".user-sessions-delete", function(){
+        M.toast({html: "Logging user out everywhere."});
 
         var user = $(this).closest(".user-li");
-        var id = parseInt(user.attr("data-id"));
-        var local = parseInt(user.attr("data-local"));
+
+        $.ajax({
+            url: "/panel/user/sessions/delete",
+            type: "POST",
+            contentType: "application/json; charset=utf-8",
+            data: JSON.stringify({
+                CsrfSecret: CsrfSecret,
+                ID: parseInt(user.attr("data-id"))
+            }),
+            dataType: "json",
+            success: function(r) {
+                M.Toast.dismissAll(); // Clear all other toasts.
+                if (r.success) {
+                    M.toast({html: "Successfully logged user out everywhere."});
+                } else {
+                    M.toast({html: "Error logging user out, refresh the page."});
+                }
+            }
+        });
+    });
+
+    // Invitation New
+    $("#invitation-new").click(function() {
+        M.toast({html: "Sending invitation."});
+
+        var email = $("#invitation-email").val();
+        var role = $("#invitation-role option:selected");
+
+        $.ajax({
+            url: "/panel/invitation/new",
+            type: "POST",
+            contentType: "application/json; charset=utf-8",
+            data: JSON.stringify({
+                CsrfSecret: CsrfSecret,
+                Email: email,
+                Role: parseInt(role.val())
+            }),
+            dataType: "json",
+            success: function(r) {
+                M.Toast.dismissAll(); // Clear all other toasts.
+                if (r.success) {
+                    var invitation = $('<li class="collection-item invitation-li"> <a class="secondary-content red-text invitation-revoke" href="#!"><i class="material-icons">delete</i></a> <a class="secondary-content invitation-resend" href="#!" style="margin-right: 16px;"><i class="material-icons">send</i></a> <span class="title"></span> <p class="grey-text"></p> </li>');
+                    invitation.attr("data-id", r.id);
+                    invitation.find(".title").text(email);
+                    invitation.find("p").text(role.text() + ", invited just now");
+                    $("#invitations .invitation-none").remove();
+                    $("#invitations ul").prepend(invitation);
+                    $("#invitation-email").val("");
+                    M.toast({html: "Successfully sent invitation."});
+                } else {
+                    M.toast({html: "Error sending invitation, check the email doesn't already have an account."});
+                }
+            }
+        });
+    });
+
+    // Invitation Resend
+    $("#invitations").on("click", ".invitation-resend", function() {
+        M.toast({html: "Resending invitation."});
+
+        var invitation = $(this).closest(".invitation-li");
+
+        $.ajax({
+            url: "/panel/invitation/resend",
+            type: "POST",
+            contentType: "application/json; charset=utf-8",
+            data: JSON.stringify({
+                CsrfSecret: CsrfSecret,
+                ID: parseInt(invitation.attr("data-id"))
+            }),
+            dataType: "json",
+            success: function(r) {
+                M.Toast.dismissAll(); // Clear all other toasts.
+                if (r.success) {
+                    invitation.find(".badge").remove();
+                    M.toast({html: "Successfully resent invitation, the old link no longer works."});
+                } else {
+                    M.toast({html: "Error resending invitation, refresh the page."});
+                }
+            }
+        });
+    });
+
+    // Invitation Revoke
+    $("#invitations").on("click", ".invitation-revoke", function() {
+        M.toast({html: "Revoking invitation."});
+
+        var invitation = $(this).closest(".invitation-li");
+
+        $.ajax({
+            url: "/panel/invitation/revoke",
+            type: "POST",
+            contentType: "application/json; charset=utf-8",
+            data: JSON.stringify({
+                CsrfSecret: CsrfSecret,
+                ID: parseInt(invitation.attr("data-id"))
+            }),
+            dataType: "json",
+            success: function(r) {
+                M.Toast.dismissAll(); // Clear all other toasts.
+                if (r.success) {
+                    invitation.remove();
+                    M.toast({html: "Successfully revoked invitation."});
+                } else {
+                    M.toast({html: "Error revoking invitation, refresh the page."});
+                }
+            }
+        });
+    });
+
+    // Registration Approve
+    $("#registrations").on("click", ".registration-approve", function() {
+        M.toast({html: "Approving user."});
+
+        var registration = $(this).closest(".registration-li");
+
+        $.ajax({
+            url: "/panel/registration/approve",
+            type: "POST",
+            contentType: "application/json; charset=utf-8",
+            data: JSON.stringify({
+                CsrfSecret: CsrfSecret,
+                ID: parseInt(registration.attr("data-id")),
+                Role: parseInt(registration.find(".registration-role").val())
+            }),
+            dataType: "json",
+            success: function(r) {
+                M.Toast.dismissAll(); // Clear all other toasts.
+                if (r.success) {
+                    registration.remove();
+                    M.toast({html: "Successfully approved user, refresh the page to edit them."});
+                } else {
+                    M.toast({html: "Error approving user, refresh the page."});
+                }
+            }
+        });
+    });
+
+    // Registration Reject
+    $("#registrations").on("click", ".registration-reject", function() {
+        M.toast({html: "Rejecting user."});
+
+        var registration = $(this).closest(".registration-li");
+
+        $.ajax({
+            url: "/panel/registration/reject",
+            type: "POST",
+            contentType: "application/json; charset=utf-8",
+            data: JSON.stringify({
+                CsrfSecret: CsrfSecret,
+                ID: parseInt(registration.attr("data-id"))
+            }),
+            dataType: "json",
+            success: function(r) {
+                M.Toast.dismissAll(); // Clear all other toasts.
+                if (r.success) {
+                    registration.remove();
+                    M.toast({html: "Successfully rejected user."});
+                } else {
+                    M.toast({html: "Error rejecting user, refresh the page."});
+                }
+            }
+        });
+    });
+
+    // Role Update
+    $("#roles").on("click", ".role-update", function(){
+        var role = $(this).closest(".role-li");
+        var local = parseInt(role.attr("data-local"));
+
+        if (local === 1) {
+            RoleNew(role);
+            return;
+        }
+
+        M.toast({html: "Updating role."});
+
+        $.ajax({
+            url: "/panel/role/update",
+            type: "POST",
+            contentType: "application/json; charset=utf-8",
+            data: JSON.stringify({
+                CsrfSecret: CsrfSecret,
+                ID: parseInt(role.attr("data-id")),
+                Name: role.find(".role-name").val(),
+                Permissions: RolePermissions(role),
+                RequireTwoFactor: role.find(".role-two-factor").is(":checked")
+            }),
+            dataType: "json",
+            success: function(r) {
+                M.Toast.dismissAll(); // Clear all other toasts.
+                if (r.success) {
+                    role.find(".role-header").text(role.find(".role-name").val());
+                    M.toast({html: "Successfully updated role."});
+                } else {
+                    M.toast({html: "Error updating role, names must be unique and you can't remove your own roles.manage."});
+                }
+            }
+        });
+    });
+
+    // Role New
+    function RoleNew(role) {
+        M.toast({html: "Adding new role."});
+
+        $.ajax({
+            url: "/panel/role/new",
+            type: "POST",
+            contentType: "application/json; charset=utf-8",
+            data: JSON.stringify({
+                CsrfSecret: CsrfSecret,
+                Name: role.find(".role-name").val(),
+                Permissions: RolePermissions(role),
+                RequireTwoFactor: role.find(".role-two-factor").is(":checked")
+            }),
+            dataType: "json",
+            success: function(r) {
+                M.Toast.dismissAll(); // Clear all other toasts.
+                if (r.success) {
+                    role.attr("data-local", "0");
+                    role.attr("data-id", r.id);
+                    role.find(".role-header").text(role.find(".role-name").val());
+                    M.toast({html: "Successfully added new role, refresh the page to give it to users."});
+                } else {
+                    M.toast({html: "Error adding new role, names must be unique."});
+                }
+            }
+        });
+    }
+
+    // RolePermissions returns the checked permissions of a role.
+    function RolePermissions(role) {
+        return role.find(".role-permission:checked").map(function() {
+            return $(this).val();
+        }).get();
+    }
+
+    // Role Delete
+    $("#roles").on("click", ".role-delete", function(){
+        M.toast({html: "Deleting role."});
+
+        var role = $(this).closest(".role-li");
+        var local = parseInt(role.attr("data-local"));
 
         if (local === 1) {
-            user.remove();
+            role.remove();
             M.Toast.dismissAll(); // Clear all other toasts.
-            M.toast({html: "Successfully deleted user."});
+            M.toast({html: "Successfully deleted role."});
             return;
         }
 
         $.ajax({
-            url: "/panel/user/delete",
+            url: "/panel/role/delete",
             type: "POST",
             contentType: "application/json; charset=utf-8",
             data: JSON.stringify({
                 CsrfSecret: CsrfSecret,
-                ID: id
+                ID: parseInt(role.attr("data-id"))
             }),
             dataType: "json",
             success: function(r) {
                 M.Toast.dismissAll(); // Clear all other toasts.
                 if (r.success) {
-                    user.remove();
-                    M.toast({html: "Successfully deleted user."});
+                    role.remove();
+                    M.toast({html: "Successfully deleted role."});
                 } else {
-                    M.toast({html: "Error deleting user, refresh the page."});
+                    M.toast({html: "Error deleting role, it can't be deleted while any users or invitations have it."});
                 }
             }
         });
     });
 
-    // User Add
-    $("#user-add").click(function() {
-        $("#users ul").append('<li class="user-li" data-local="1"> <div class="collapsible-header user-header">New User</div> <div class="collapsible-body"><span> <div class="row"> <div class="input-field col s12"> <input class="user-email" type="text" data-length="256" maxlength="256"> <label>Email</label> </div> <div class="input-field col s12"> <input class="user-password tooltipped" data-position="top" data-delay="50" data-tooltip="You can leave the password blank to not change it." type="password" data-length="64" maxlength="64"> <label>Password</label> </div> <div class="input-field col s12"> <input class="user-fname" type="text" data-length="16" maxlength="16"> <label>First Name</label> </div> <div class="input-field col s12"> <input class="user-lname" type="text" data-length="16" maxlength="16"> <label>Last Name</label> </div> <div class="input-field col s12"> <select class="user-privileges" autocomplete="off"> <option value="1" selected>Parent</option> <option value="2">Moderator</option> <option value="3">Admin</option> </select> <label>Privileges</label> </div> <div class="input-field col"> <a class="btn waves-effect waves-light purple darken-3 user-update">Submit<i class="material-icons right">send</i></a> <a class="btn waves-effect waves-light red user-delete">Delete<i class="material-icons right">delete</i></a> </div> </div> </span></div></li>');
-        $("select").formSelect();
-        $('.collapsible').collapsible('open', $('#users ul .user-li').length - 1);
+    // Role Add
+    $("#role-add").click(function() {
+        var role = $('<li class="role-li" data-local="1"> <div class="collapsible-header role-header">New Role</div> <div class="collapsible-body"><span> <div class="row"> <div class="input-field col s12"> <input class="role-name" type="text" data-length="32" maxlength="32"> <label>Name</label> </div> <div class="col s12 role-permissions"></div> <div class="col s12"> <p> <label> <input type="checkbox" class="filled-in role-two-factor"/> <span><b>Require two-factor authentication</b>: Users with this role can only reach their settings until they set it up.</span> </label> </p> </div> <div class="input-field col"> <a class="btn waves-effect waves-light purple darken-3 role-update">Save<i class="material-icons right">send</i></a> <a class="btn waves-effect waves-light red role-delete">Delete<i class="material-icons right">delete</i></a> </div> </div> </span></div></li>');
+        $.each(Permissions, function(i, permission) {
+            var checkbox = $('<p><label><input type="checkbox" class="filled-in role-permission"/><span><b></b>: </span></label></p>');
+            checkbox.find("input").val(permission.Name);
+            checkbox.find("b").text(permission.Name);
+            checkbox.find("span").append(document.createTextNode(permission.Description));
+            role.find(".role-permissions").append(checkbox);
+        });
+        $("#roles ul").append(role);
+        $('#roles .collapsible').collapsible('open', $('#roles ul .role-li').length - 1);
     });
 
     // Settings Update
@@ -137,6 +375,11 @@ $(document).ready(function(){
             success: function(r) {
                 M.Toast.dismissAll(); // Clear all other toasts.
                 if (r.success) {
+                    if ($(".password").val() !== "") {
+                        location.reload(); // Changing the password logs in again with a new CSRF secret.
+                        return;
+                    }
+
                     M.toast({html: "Successfully updated your settings."});
                     if (email !== $(".email").val()) {
                         M.toast({html: "Please check your email for a verification message."});
@@ -147,4 +390,352 @@ $(document).ready(function(){
             }
         });
     });
-});
\ No newline at end of file
+
+    // Access Token New
+    $("#token-new").click(function() {
+        var scopes = $(".token-scope:checked").map(function() {
+            return $(this).val();
+        }).get();
+
+        if ($("#token-name").val() === "" || scopes.length === 0) {
+            M.toast({html: "A token needs a name and at least one scope."});
+            return;
+        }
+
+        M.toast({html: "Creating access token."});
+
+        $.ajax({
+            url: "/panel/settings/token/new",
+            type: "POST",
+            contentType: "application/json; charset=utf-8",
+            data: JSON.stringify({
+                CsrfSecret: CsrfSecret,
+                Name: $("#token-name").val(),
+                Scopes: scopes
+            }),
+            dataType: "json",
+            success: function(r) {
+                M.Toast.dismissAll(); // Clear all other toasts.
+                if (r.success) {
+                    var token = $('<li class="collection-item token-li"> <a class="secondary-content red-text token-delete" href="#!"><i class="material-icons">delete</i></a> <span class="title"></span> <code></code> <p><br><span class="grey-text">Created just now, never used</span></p> </li>');
+                    token.attr("data-id", r.id);
+                    token.find(".title").text($("#token-name").val());
+                    token.find("code").text(r.prefix + "…");
+                    $.each(scopes.reverse(), function(i, scope) {
+                        token.find("p").prepend($('<span class="new badge purple darken-3 left" data-badge-caption="" style="margin: 0 5px 0 0;"></span>').text(scope));
+                    });
+                    $("#access-tokens .collection").prepend(token);
+
+                    $("#token-value").val(r.token);
+                    $("#token-created").show();
+                    $("#token-name").val("");
+                    $(".token-scope").prop("checked", false);
+                    M.toast({html: "Successfully created access token."});
+                } else {
+                    M.toast({html: "Error creating access token, refresh the page."});
+                }
+            }
+        });
+    });
+
+    // Access Token Delete
+    $("#access-tokens").on("click", ".token-delete", function() {
+        M.toast({html: "Revoking access token."});
+
+        var token = $(this).closest(".token-li");
+
+        $.ajax({
+            url: "/panel/settings/token/delete",
+            type: "POST",
+            contentType: "application/json; charset=utf-8",
+            data: JSON.stringify({
+                CsrfSecret: CsrfSecret,
+                ID: parseInt(token.attr("data-id"))
+            }),
+            dataType: "json",
+            success: function(r) {
+                M.Toast.dismissAll(); // Clear all other toasts.
+                if (r.success) {
+                    token.remove();
+                    M.toast({html: "Successfully revoked access token."});
+                } else {
+                    M.toast({html: "Error revoking access token, refresh the page."});
+                }
+            }
+        });
+    });
+
+    // Session Delete
+    $("#sessions").on("click", ".session-delete", function() {
+        M.toast({html: "Logging out session."});
+
+        var session = $(this).closest(".session-li");
+
+        $.ajax({
+            url: "/panel/settings/session/delete",
+            type: "POST",
+            contentType: "application/json; charset=utf-8",
+            data: JSON.stringify({
+                CsrfSecret: CsrfSecret,
+                Family: session.attr("data-family")
+            }),
+            dataType: "json",
+            success: function(r) {
+                M.Toast.dismissAll(); // Clear all other toasts.
+                if (r.success) {
+                    session.remove();
+                    M.toast({html: "Successfully logged out session."});
+                } else {
+                    M.toast({html: "Error logging out session, refresh the page."});
+                }
+            }
+        });
+    });
+
+    // Lockout Clear
+    $("#lockouts").on("click", ".lockout-clear", function() {
+        M.toast({html: "Clearing lockout."});
+
+        var lockout = $(this).closest(".lockout-li");
+
+        $.ajax({
+            url: "/panel/lockout/clear",
+            type: "POST",
+            contentType: "application/json; charset=utf-8",
+            data: JSON.stringify({
+                CsrfSecret: CsrfSecret,
+                ID: parseInt(lockout.attr("data-id"))
+            }),
+            dataType: "json",
+            success: function(r) {
+                M.Toast.dismissAll(); // Clear all other toasts.
+                if (r.success) {
+                    lockout.remove();
+                    M.toast({html: "Successfully cleared lockout."});
+                } else {
+                    M.toast({html: "Error clearing lockout, refresh the page."});
+                }
+            }
+        });
+    });
+
+    // Two-Factor New
+    var twoFactorSecret = "";
+    $("#two-factor-new").click(function() {
+        $.ajax({
+            url: "/panel/settings/two-factor/new",
+            type: "POST",
+            contentType: "application/json; charset=utf-8",
+            data: JSON.stringify({
+                CsrfSecret: CsrfSecret
+            }),
+            dataType: "json",
+            success: function(r) {
+                if (r.success) {
+                    twoFactorSecret = r.secret;
+                    $("#two-factor-secret").text(r.secret);
+                    $("#two-factor-qr").empty();
+                    new QRCode(document.getElementById("two-factor-qr"), {text: r.uri, width: 200, height: 200});
+                    $("#two-factor-setup").show();
+                    $("#two-factor-new").hide();
+                    $("#two-factor-enable").show();
+                } else {
+                    M.toast({html: "Error setting up two-factor authentication, refresh the page."});
+                }
+            }
+        });
+    });
+
+    // Two-Factor Enable
+    $("#two-factor-enable").click(function() {
+        M.toast({html: "Turning on two-factor authentication."});
+
+        $.ajax({
+            url: "/panel/settings/two-factor/enable",
+            type: "POST",
+            contentType: "application/json; charset=utf-8",
+            data: JSON.stringify({
+                CsrfSecret: CsrfSecret,
+                Secret: twoFactorSecret,
+                Code: $("#two-factor-code").val().trim()
+            }),
+            dataType: "json",
+            success: function(r) {
+                M.Toast.dismissAll(); // Clear all other toasts.
+                if (r.success) {
+                    $("#two-factor-setup").hide();
+                    $("#two-factor-enable").hide();
+                    ShowRecoveryCodes(r.recoveryCodes);
+                    M.toast({html: "Successfully turned on two-factor authentication."});
+                } else {
+                    M.toast({html: "Error turning on two-factor authentication, check the code."});
+                }
+            }
+        });
+    });
+
+    // Two-Factor Disable
+    $("#two-factor-disable").click(function() {
+        M.toast({html: "Turning off two-factor authentication."});
+
+        $.ajax({
+            url: "/panel/settings/two-factor/disable",
+            type: "POST",
+            contentType: "application/json; charset=utf-8",
+            data: JSON.stringify({
+                CsrfSecret: CsrfSecret,
+                Code: $("#two-factor-code").val().trim()
+            }),
+            dataType: "json",
+            success: function(r) {
+                M.Toast.dismissAll(); // Clear all other toasts.
+                if (r.success) {
+                    location.reload();
+                } else {
+                    M.toast({html: "Error turning off two-factor authentication, check the code."});
+                }
+            }
+        });
+    });
+
+    // Two-Factor Recovery Codes
+    $("#two-factor-recovery-codes").click(function() {
+        M.toast({html: "Creating new recovery codes."});
+
+        $.ajax({
+            url: "/panel/settings/two-factor/recovery-codes",
+            type: "POST",
+            contentType: "application/json; charset=utf-8",
+            data: JSON.stringify({
+                CsrfSecret: CsrfSecret,
+                Code: $("#two-factor-code").val().trim()
+            }),
+            dataType: "json",
+            success: function(r) {
+                M.Toast.dismissAll(); // Clear all other toasts.
+                if (r.success) {
+                    $("#two-factor-code").val("");
+                    ShowRecoveryCodes(r.recoveryCodes);
+                    M.toast({html: "Successfully created new recovery codes, the old ones no longer work."});
+                } else {
+                    M.toast({html: "Error creating recovery codes, check the code."});
+                }
+            }
+        });
+    });
+
+    // ShowRecoveryCodes shows recovery codes, which the server only sends once.
+    function ShowRecoveryCodes(codes) {
+        $("#recovery-codes-list").text(codes.join("\n"));
+        $("#recovery-codes").show();
+    }
+
+    // Passkey New
+    $("#passkey-new").click(function() {
+        var name = $("#passkey-name").val();
+        if (name === "") {
+            M.toast({html: "A passkey needs a name."});
+            return;
+        }
+
+        if (!window.PublicKeyCredential) {
+            M.toast({html: "Your browser doesn't support passkeys."});
+            return;
+        }
+
+        $.ajax({
+            url: "/panel/settings/passkey/begin",
+            type: "POST",
+            contentType: "application/json; charset=utf-8",
+            data: JSON.stringify({
+                CsrfSecret: CsrfSecret
+            }),
+            dataType: "json",
+            success: function(r) {
+                if (!r.success) {
+                    M.toast({html: "Error adding passkey, refresh the page."});
+                    return;
+                }
+
+                PasskeyCreate(r).then(function(registration) {
+                    M.toast({html: "Adding passkey."});
+                    registration.CsrfSecret = CsrfSecret;
+                    registration.Name = name;
+
+                    $.ajax({
+                        url: "/panel/settings/passkey/new",
+                        type: "POST",
+                        contentType: "application/json; charset=utf-8",
+                        data: JSON.stringify(registration),
+                        dataType: "json",
+                        success: function(r) {
+                            M.Toast.dismissAll(); // Clear all other toasts.
+                            if (r.success) {
+                                var passkey = $('<li class="collection-item passkey-li"> <a class="secondary-content red-text passkey-delete" href="#!"><i class="material-icons">delete</i></a> <span class="title"></span> <p class="grey-text">Added just now, never used</p> </li>');
+                                passkey.attr("data-id", r.id);
+                                passkey.find(".title").text(name);
+                                $("#passkeys .collection").append(passkey);
+                                $("#passkey-name").val("");
+                                M.toast({html: "Successfully added passkey."});
+                            } else {
+                                M.toast({html: "Error adding passkey, it may already be added."});
+                            }
+                        }
+                    });
+                }).catch(function() {
+                    M.toast({html: "Adding passkey cancelled."});
+                });
+            }
+        });
+    });
+
+    // Passkey Delete
+    $("#passkeys").on("click", ".passkey-delete", function() {
+        M.toast({html: "Removing passkey."});
+
+        var passkey = $(this).closest(".passkey-li");
+
+        $.ajax({
+            url: "/panel/settings/passkey/delete",
+            type: "POST",
+            contentType: "application/json; charset=utf-8",
+            data: JSON.stringify({
+                CsrfSecret: CsrfSecret,
+                ID: parseInt(passkey.attr("data-id"))
+            }),
+            dataType: "json",
+            success: function(r) {
+                M.Toast.dismissAll(); // Clear all other toasts.
+                if (r.success) {
+                    passkey.remove();
+                    M.toast({html: "Successfully removed passkey."});
+                } else {
+                    M.toast({html: "Error removing passkey, refresh the page."});
+                }
+            }
+        });
+    });
+
+    // Session Delete All
+    $("#session-delete-all").click(function() {
+        M.toast({html: "Logging out everywhere."});
+
+        $.ajax({
+            url: "/panel/settings/session/delete-all",
+            type: "POST",
+            contentType: "application/json; charset=utf-8",
+            data: JSON.stringify({
+                CsrfSecret: CsrfSecret
+            }),
+            dataType: "json",
+            success: function(r) {
+                M.Toast.dismissAll(); // Clear all other toasts.
+                if (r.success) {
+                    window.location.href = "/login";
+                } else {
+                    M.toast({html: "Error logging out everywhere, refresh the page."});
+                }
+            }
+        });
+    });
+});
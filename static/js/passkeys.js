@@ -0,0 +1,75 @@
+// PasskeyCreate asks the browser to create a passkey with options from the server.
+function PasskeyCreate(options) {
+    return navigator.credentials.create({
+        publicKey: {
+            challenge: Base64URLToBuffer(options.challenge),
+            rp: {id: options.rpId, name: options.rpName},
+            user: {
+                id: Base64URLToBuffer(options.userId),
+                name: options.userName,
+                displayName: options.userDisplayName
+            },
+            pubKeyCredParams: [
+                {type: "public-key", alg: -7}, // ES256
+                {type: "public-key", alg: -8}, // EdDSA
+                {type: "public-key", alg: -257} // RS256
+            ],
+            excludeCredentials: options.credentialIds.map(function(id) {
+                return {type: "public-key", id: Base64URLToBuffer(id)};
+            }),
+            authenticatorSelection: {
+                residentKey: "preferred",
+                userVerification: options.userVerification
+            },
+            attestation: "none",
+            timeout: 300000
+        }
+    }).then(function(credential) {
+        return {
+            ClientDataJSON: BufferToBase64URL(credential.response.clientDataJSON),
+            AttestationObject: BufferToBase64URL(credential.response.attestationObject)
+        };
+    });
+}
+
+// PasskeyGet asks the browser to sign a login challenge from the server with a passkey.
+function PasskeyGet(options) {
+    return navigator.credentials.get({
+        publicKey: {
+            challenge: Base64URLToBuffer(options.challenge),
+            rpId: options.rpId,
+            allowCredentials: options.credentialIds.map(function(id) {
+                return {type: "public-key", id: Base64URLToBuffer(id)};
+            }),
+            userVerification: options.userVerification,
+            timeout: 300000
+        }
+    }).then(function(credential) {
+        return {
+            CredentialID: BufferToBase64URL(credential.rawId),
+            ClientDataJSON: BufferToBase64URL(credential.response.clientDataJSON),
+            AuthenticatorData: BufferToBase64URL(credential.response.authenticatorData),
+            Signature: BufferToBase64URL(credential.response.signature),
+            UserHandle: credential.response.userHandle ? BufferToBase64URL(credential.response.userHandle) : ""
+        };
+    });
+}
+
+function Base64URLToBuffer(value) {
+    var base64 = value.replace(/-/g, "+").replace(/_/g, "/");
+    var binary = atob(base64 + "===".slice((base64.length + 3) % 4));
+    var bytes = new Uint8Array(binary.length);
+    for (var i = 0; i < binary.length; i++) {
+        bytes[i] = binary.charCodeAt(i);
+    }
+    return bytes.buffer;
+}
+
+function BufferToBase64URL(buffer) {
+    var bytes = new Uint8Array(buffer);
+    var binary = "";
+    for (var i = 0; i < bytes.length; i++) {
+        binary += String.fromCharCode(bytes[i]);
+    }
+    return btoa(binary).replace(/\+/g, "-").replace(/\//g, "_").replace(/=+$/, "");
+}
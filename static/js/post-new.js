@@ -11,7 +11,23 @@ $(document).ready(function(){
         $(".images").trigger('click');
     });
 
+    $("#status").change(function(){
+        $("#publish-time-field").toggle($(this).val() === "1");
+    });
+
     $(".submit-btn").click(function(){
+        if ($("#status").val() === "1") {
+            var publishTime = new Date($("#publish-time").val()).getTime();
+            if (isNaN(publishTime)) {
+                M.toast({html: "You need to select a publish time."});
+                return;
+            }
+
+            $("#publish-time-unix").val(Math.floor(publishTime / 1000)); // The server uses unix time in seconds.
+        } else {
+            $("#publish-time-unix").val("");
+        }
+
         M.toast({html: "Sending new post request!"});
         var formData = new FormData($(this).parents("form")[0]);
 
@@ -24,6 +40,7 @@ $(document).ready(function(){
         $.ajax({
             type: "POST",
             url: "/panel/post/new",
+            headers: {"X-CSRF-Token": CsrfSecret},
             data: formData,
             cache: false,
             contentType: false,
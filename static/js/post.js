@@ -42,6 +42,53 @@ $(document).ready(function(){
         });
     }
 
+    if (PublishTime !== 0) {
+        // Show the publish time in the local time zone as datetime-local inputs expect.
+        var publishDate = new Date(PublishTime * 1000);
+        publishDate.setMinutes(publishDate.getMinutes() - publishDate.getTimezoneOffset());
+        $("#publish-time").val(publishDate.toISOString().slice(0, 16));
+    }
+
+    $("#status").change(function(){
+        $("#publish-time-field").toggle($(this).val() === "1");
+    });
+
+    $("#status-btn").click(function(){
+        var status = parseInt($("#status").val());
+        var publishTime = 0;
+
+        if (status === 1) {
+            publishTime = new Date($("#publish-time").val()).getTime();
+            if (isNaN(publishTime)) {
+                M.toast({html: "You need to select a publish time."});
+                return;
+            }
+
+            publishTime = Math.floor(publishTime / 1000); // The server uses unix time in seconds.
+        }
+
+        $.ajax({
+            url: "/panel/post/status/update",
+            type: "post",
+            contentType: "application/json; charset=utf-8",
+            data: JSON.stringify({
+                ID: PostID,
+                Status: status,
+                PublishTime: publishTime,
+                CsrfSecret: CsrfSecret
+            }),
+            dataType: "json",
+            success: function(r) {
+                M.Toast.dismissAll(); // Clear all other toasts.
+                if(r.success) {
+                    M.toast({html: "Successfully saved status!"});
+                } else {
+                    M.toast({html: "Error saving status, refresh the page."});
+                }
+            }
+        });
+    });
+
     $(document).keypress(function(event){
         if (event.keyCode === 10 || event.keyCode === 13) 
             event.preventDefault();
@@ -78,50 +125,126 @@ $(document).ready(function(){
             return;
         }
 
-        M.toast({html: "Submitting comment."});
+        SubmitComment(comment, "", function(commentID) {
+            $("#comments").prepend(NewComment(commentID, comment));
+            $('#comment-textarea').val(""); // Make the comment box empty.
+        });
+    });
+
+    // Show a reply box under the comment.
+    $("#comment-section").on("click", ".reply-comment-btn", function(){
+        var comment = $(this).closest(".comment");
+        var card = comment.children(".card-panel");
+
+        if (card.find(".reply-box").length === 0) {
+            card.append('<div class="reply-box"><div class="input-field"><textarea class="materialize-textarea reply-textarea" data-length="256" maxlength="256"></textarea><label>Reply</label></div><a class="waves-effect waves-light btn purple darken-3 reply-submit-btn"><i class="material-icons left">reply</i>Reply</a></div>');
+        }
+
+        card.find(".reply-textarea").focus();
+    });
+
+    $("#comment-section").on("click", ".reply-submit-btn", function(){
+        var comment = $(this).closest(".comment");
+        var replyBox = $(this).closest(".reply-box");
+        var reply = replyBox.find(".reply-textarea").val();
+
+        if (reply === "") {
+            M.toast({html: "You need to enter a reply first."});
+            return;
+        }
+
+        SubmitComment(reply, comment.attr("data-id"), function(commentID) {
+            comment.children(".replies").append(NewComment(commentID, reply));
+            replyBox.remove();
+        });
+    });
+
+    // Show an edit box in place of the comment's text.
+    $("#comment-section").on("click", ".edit-comment-btn", function(){
+        var card = $(this).closest(".comment").children(".card-panel");
+        var text = card.children(".comment-text");
+
+        if (card.find(".edit-box").length === 0) {
+            var editBox = $('<div class="edit-box"><div class="input-field"><textarea class="materialize-textarea edit-textarea" data-length="256" maxlength="256"></textarea></div><a class="waves-effect waves-light btn purple darken-3 edit-submit-btn"><i class="material-icons left">save</i>Save</a> <a class="waves-effect waves-light btn-flat edit-cancel-btn">Cancel</a></div>');
+            editBox.find(".edit-textarea").val(text.text());
+            text.hide().after(editBox);
+            M.textareaAutoResize(editBox.find(".edit-textarea"));
+        }
+
+        card.find(".edit-textarea").focus();
+    });
+
+    $("#comment-section").on("click", ".edit-cancel-btn", function(){
+        var card = $(this).closest(".card-panel");
+        card.find(".edit-box").remove();
+        card.children(".comment-text").show();
+    });
+
+    $("#comment-section").on("click", ".edit-submit-btn", function(){
+        var comment = $(this).closest(".comment");
+        var card = comment.children(".card-panel");
+        var text = card.children(".comment-text");
+        var edit = card.find(".edit-textarea").val();
+
+        if (edit === "") {
+            M.toast({html: "You need to enter a comment first."});
+            return;
+        }
+
+        M.toast({html: "Editing comment."});
 
         $.ajax({
-            url: "/panel/post/comment",
-            type: "post",
+            url: "/panel/post/comment/update",
+            type: "POST",
             contentType: "application/json; charset=utf-8",
             data: JSON.stringify({
-                ID: PostID,
-                Comment: comment,
-                CsrfSecret: CsrfSecret
+                CsrfSecret: CsrfSecret,
+                PostID: PostID,
+                CommentID: comment.attr("data-id"),
+                Comment: edit
             }),
             dataType: "json",
             success: function(r) {
                 M.Toast.dismissAll(); // Clear all other toasts.
-                if(r.success) {
-                    var commentID = r.id;
-                    $("#comment-section").append('<div class="col s12 comment"> <div class="card-panel grey lighten-5 z-depth-1 hoverable"> <div style="font-size: 140%;">' + Fname + ' ' + Lname + '</div><span>Just now</span> <p>' + comment + '</p><a class="delete-comment-btn btn-floating waves-effect waves-light red right" style="top: -30px; right: -5px;" data-id="' + commentID + '"><i class="material-icons">delete</i></a> </div></div>');
-                    $('#comment-textarea').val(""); // Make the comment box empty.
-                    M.toast({html: "Successfully added comment!"});
+                if (r.success) {
+                    if (edit !== text.text()) {
+                        AddRevision(card, text.text());
+                        text.text(edit);
+                    }
+
+                    card.find(".edit-box").remove();
+                    text.show();
+                    M.toast({html: "Successfully edited comment!"});
                 } else {
-                    M.toast({html: "Error submitting comment, refresh the page."});
+                    M.toast({html: "Error editing comment, refresh the page."});
                 }
             }
         });
     });
 
+    $("#comment-section").on("click", ".history-comment-btn", function(){
+        $(this).closest(".card-panel").children(".history").toggle();
+    });
+
     $("#comment-section").on("click", ".delete-comment-btn", function(){
         M.toast({html: "Deleting comment."});
         var id = $(this).attr("data-id");
         var comment = $(this).closest(".comment");
 
         $.ajax({
-            url: "/admin/user/delete",
+            url: "/panel/post/comment/delete",
             type: "POST",
             contentType: "application/json; charset=utf-8",
             data: JSON.stringify({
                 CsrfSecret: CsrfSecret,
-                ID: ID
+                PostID: PostID,
+                CommentID: id
             }),
             dataType: "json",
             success: function(r) {
                 M.Toast.dismissAll(); // Clear all other toasts.
                 if (r.success) {
-                    $(user).remove();
+                    RemoveComment(comment);
                     M.toast({html: "Successfully deleted comment!"});
                 } else {
                     M.toast({html: "Error deleting comment, refresh the page."});
@@ -129,39 +252,69 @@ $(document).ready(function(){
             }
         });
     });
-});
 
+    // SubmitComment sends a comment, or a reply if parentID isn't empty, then calls done with the new comment's ID.
+    function SubmitComment(comment, parentID, done) {
+        M.toast({html: "Submitting comment."});
 
-function TimeAgo(current, previous) {
-    var secPerMinute = 60;
-    var secPerHour = secPerMinute * 60;
-    var secPerDay = secPerHour * 24;
-    var secPerMonth = secPerDay * 30;
-    var secPerYear = secPerDay * 365;
-    
-    var elapsed = current - previous;
-    
-    if (elapsed < secPerMinute) {
-        return "Just now";
-    } else if (elapsed < secPerHour) {
-        return timeDifference(elapsed, secPerMinute, "minute");
-    } else if (elapsed < secPerDay ) {
-        return timeDifference(elapsed, secPerHour, "hour");
-    } else if (elapsed < secPerMonth) {
-        return timeDifference(elapsed, secPerDay, "day");
-    } else if (elapsed < secPerYear) {
-        return timeDifference(elapsed, secPerMonth, "month");
-    } else {
-        return timeDifference(elapsed, secPerYear, "year");
+        $.ajax({
+            url: "/panel/post/comment",
+            type: "post",
+            contentType: "application/json; charset=utf-8",
+            data: JSON.stringify({
+                ID: PostID,
+                ParentID: parentID,
+                Comment: comment,
+                CsrfSecret: CsrfSecret
+            }),
+            dataType: "json",
+            success: function(r) {
+                M.Toast.dismissAll(); // Clear all other toasts.
+                if(r.success) {
+                    done(r.id);
+                    M.toast({html: "Successfully added comment!"});
+                } else {
+                    M.toast({html: "Error submitting comment, refresh the page."});
+                }
+            }
+        });
+    }
+
+    // NewComment creates the element for a comment the user just sent.
+    function NewComment(commentID, comment) {
+        var element = $('<div class="comment"><div class="card-panel grey lighten-5 z-depth-1 hoverable"><div style="font-size: 140%;"></div><span>Just now</span><p class="comment-text"></p><a class="reply-comment-btn purple-text text-darken-3">Reply</a> <a class="edit-comment-btn purple-text text-darken-3">Edit</a><a class="delete-comment-btn btn-floating waves-effect waves-light red right" style="top: -30px; right: -5px;"><i class="material-icons">delete</i></a></div><div class="replies" style="margin-left: 30px;"></div></div>');
+        element.attr("data-id", commentID);
+        element.find(".reply-comment-btn, .edit-comment-btn, .delete-comment-btn").attr("data-id", commentID);
+        element.find("div[style]").first().text(Fname + " " + Lname);
+        element.find(".comment-text").text(comment);
+        return element;
     }
-}
 
-function timeDifference(elapsed, period, periodName) {
-    var rounded = Math.round(elapsed/period);
+    // AddRevision adds the text a comment had before an edit to its history, adding the edited marker if needed.
+    function AddRevision(card, previous) {
+        if (card.children(".history").length === 0) {
+            card.children(".comment-text").after('<a class="history-comment-btn grey-text"></a><div class="history grey-text" style="display: none;"></div>');
+        }
+
+        card.children(".history-comment-btn").text("(edited Just now)");
 
-    if (rounded === 1) {
-        return rounded + " " + periodName + " ago";
+        var revision = $('<p><span>Earlier</span>: <span class="revision-text"></span></p>');
+        revision.find(".revision-text").text(previous);
+        card.children(".history").append(revision);
     }
 
-    return rounded + " " + periodName + "s ago";
-}
\ No newline at end of file
+    // RemoveComment removes a deleted comment, leaving a placeholder if it has replies like the server does.
+    function RemoveComment(comment) {
+        if (comment.children(".replies").children(".comment").length > 0) {
+            comment.children(".card-panel").html('<p class="grey-text">Comment deleted</p>').addClass("deleted");
+            return;
+        }
+
+        var parent = comment.parent().closest(".comment");
+        comment.remove();
+
+        if (parent.length > 0 && parent.children(".card-panel").hasClass("deleted")) {
+            RemoveComment(parent);
+        }
+    }
+});
@@ -0,0 +1,59 @@
+$(document).ready(function(){
+    M.AutoInit();
+    Waves.displayEffect();
+
+    $("#button").click(function(){
+        if ($("#password").val().length < 8) {
+            $("#message").html("Your password needs to be at least 8 characters long.");
+            return;
+        }
+
+        $("#message").html("Registering!");
+
+        CaptchaResponse("register").then(function(response) {
+            $.ajax({
+                url: "/register",
+                type: "POST",
+                contentType: "application/json; charset=utf-8",
+                data: JSON.stringify({
+                    Email: $("#email").val(),
+                    Fname: $("#fname").val(),
+                    Lname: $("#lname").val(),
+                    Password: $("#password").val(),
+                    Captcha: response
+                }),
+                dataType: "json",
+                success: function(r) {
+                    switch(r.Code) {
+                        case 0: {
+                            $("#message").html("Check " + $("#email").val() + " for an email to verify it. Once it's verified, your account will be approved by Bernie.");
+                            break;
+                        }
+                        case 1: {
+                            $("#message").html("Please enter a valid email, your first and last name, and a password of at least 8 characters.");
+                            break;
+                        }
+                        case 2: {
+                            $("#message").html("Please check the CAPTCHA and try again.");
+                            break;
+                        }
+                        case 3: {
+                            $("#message").html("Error 500: Internal server error.");
+                            break;
+                        }
+                        case 4: {
+                            $("#message").html("Error sending email.");
+                            break;
+                        }
+                        default: {
+                            $("#message").html("Unknown error...");
+                            break;
+                        }
+                    }
+                }
+            });
+
+            CaptchaReset(); // The response can only be used once.
+        });
+    });
+});
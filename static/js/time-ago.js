@@ -0,0 +1,33 @@
+function TimeAgo(current, previous) {
+    var secPerMinute = 60;
+    var secPerHour = secPerMinute * 60;
+    var secPerDay = secPerHour * 24;
+    var secPerMonth = secPerDay * 30;
+    var secPerYear = secPerDay * 365;
+    
+    var elapsed = current - previous;
+    
+    if (elapsed < secPerMinute) {
+        return "Just now";
+    } else if (elapsed < secPerHour) {
+        return timeDifference(elapsed, secPerMinute, "minute");
+    } else if (elapsed < secPerDay ) {
+        return timeDifference(elapsed, secPerHour, "hour");
+    } else if (elapsed < secPerMonth) {
+        return timeDifference(elapsed, secPerDay, "day");
+    } else if (elapsed < secPerYear) {
+        return timeDifference(elapsed, secPerMonth, "month");
+    } else {
+        return timeDifference(elapsed, secPerYear, "year");
+    }
+}
+
+function timeDifference(elapsed, period, periodName) {
+    var rounded = Math.round(elapsed/period);
+
+    if (rounded === 1) {
+        return rounded + " " + periodName + " ago";
+    }
+
+    return rounded + " " + periodName + "s ago";
+}
\ No newline at end of file